@@ -0,0 +1,386 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "image/gif" // 注册 GIF 解码器
+)
+
+// ImageOptions 图片附件选项
+type ImageOptions struct {
+	Detail       string // 细节等级：auto、low、high，为空时不设置
+	MaxBytes     int    // 编码后大小上限，超过时缩小并重新编码为 JPEG，0 表示不限制
+	MaxDimension int    // 最长边像素上限，超过时等比缩小，0 表示不限制
+	JPEGQuality  int    // 重新编码时的 JPEG 质量，默认 85
+}
+
+// 重新编码相关的默认值
+const (
+	defaultJPEGQuality  = 85
+	minImageDimension   = 64
+	maxShrinkIterations = 8
+)
+
+// DataURL 生成 base64 编码的 data URL
+func DataURL(mimeType string, data []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// DetectMIMEType 根据内容嗅探 MIME 类型，无法识别时按文件扩展名推断
+func DetectMIMEType(data []byte, filename string) string {
+	sniffed := http.DetectContentType(data)
+	if idx := strings.Index(sniffed, ";"); idx >= 0 {
+		sniffed = sniffed[:idx]
+	}
+	if sniffed != "application/octet-stream" && sniffed != "text/plain" {
+		return sniffed
+	}
+
+	if ext := filepath.Ext(filename); ext != "" {
+		if byExt := mime.TypeByExtension(ext); byExt != "" {
+			if idx := strings.Index(byExt, ";"); idx >= 0 {
+				byExt = byExt[:idx]
+			}
+			return byExt
+		}
+	}
+	return sniffed
+}
+
+// ImagePartFromFile 读取本地图片并生成图片片段
+func ImagePartFromFile(path string, opts *ImageOptions) (ContentPart, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("failed to read image: %w", err)
+	}
+	return imagePart(data, path, opts)
+}
+
+// ImagePartFromReader 从 io.Reader 读取图片并生成图片片段
+func ImagePartFromReader(r io.Reader, opts *ImageOptions) (ContentPart, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("failed to read image: %w", err)
+	}
+	return imagePart(data, "", opts)
+}
+
+// ImagePartFromBytes 从内存数据生成图片片段
+func ImagePartFromBytes(data []byte, opts *ImageOptions) (ContentPart, error) {
+	return imagePart(data, "", opts)
+}
+
+// imagePart 嗅探类型、按需压缩并编码为 data URL
+func imagePart(data []byte, filename string, opts *ImageOptions) (ContentPart, error) {
+	if opts == nil {
+		opts = &ImageOptions{}
+	}
+
+	mimeType := DetectMIMEType(data, filename)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return ContentPart{}, fmt.Errorf("unsupported image type %s", mimeType)
+	}
+
+	data, mimeType, err := fitImage(data, mimeType, opts)
+	if err != nil {
+		return ContentPart{}, err
+	}
+
+	return ImagePart(DataURL(mimeType, data), opts.Detail), nil
+}
+
+// fitImage 在图片超出尺寸或大小限制时缩小并重新编码
+func fitImage(data []byte, mimeType string, opts *ImageOptions) ([]byte, string, error) {
+	tooLarge := opts.MaxBytes > 0 && len(data) > opts.MaxBytes
+	tooBig := false
+	if opts.MaxDimension > 0 {
+		// 无法读取尺寸的格式（如 webp）只按大小判断，未超限时原样发送
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			tooBig = cfg.Width > opts.MaxDimension || cfg.Height > opts.MaxDimension
+		}
+	}
+	if !tooLarge && !tooBig {
+		return data, mimeType, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot resize %s image: %w", mimeType, err)
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if opts.MaxDimension > 0 {
+		width, height = fitDimensions(width, height, opts.MaxDimension)
+	}
+
+	quality := opts.JPEGQuality
+	if quality <= 0 || quality > 100 {
+		quality = defaultJPEGQuality
+	}
+
+	for i := 0; i < maxShrinkIterations; i++ {
+		scaled := scaleImage(img, width, height)
+
+		// PNG 在满足大小限制时保持原格式以保留透明度
+		var buf bytes.Buffer
+		outType := "image/jpeg"
+		if mimeType == "image/png" {
+			if err := png.Encode(&buf, scaled); err != nil {
+				return nil, "", fmt.Errorf("failed to encode image: %w", err)
+			}
+			outType = "image/png"
+		}
+		if outType != "image/png" || (opts.MaxBytes > 0 && buf.Len() > opts.MaxBytes) {
+			buf.Reset()
+			if err := jpeg.Encode(&buf, flattenImage(scaled), &jpeg.Options{Quality: quality}); err != nil {
+				return nil, "", fmt.Errorf("failed to encode image: %w", err)
+			}
+			outType = "image/jpeg"
+		}
+
+		if opts.MaxBytes <= 0 || buf.Len() <= opts.MaxBytes {
+			return buf.Bytes(), outType, nil
+		}
+
+		longest := width
+		if height > longest {
+			longest = height
+		}
+		if longest <= minImageDimension {
+			break
+		}
+		width, height = fitDimensions(width, height, longest*3/4)
+	}
+
+	return nil, "", fmt.Errorf("image cannot be reduced below %d bytes", opts.MaxBytes)
+}
+
+// fitDimensions 等比缩放到最长边不超过 max
+func fitDimensions(width, height, max int) (int, int) {
+	if width <= max && height <= max {
+		return width, height
+	}
+	if width >= height {
+		h := height * max / width
+		if h < 1 {
+			h = 1
+		}
+		return max, h
+	}
+	w := width * max / height
+	if w < 1 {
+		w = 1
+	}
+	return w, max
+}
+
+// scaleImage 使用区域平均缩放图片
+func scaleImage(src image.Image, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	}
+
+	srcW, srcH := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	if srcW == width && srcH == height {
+		return rgba
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcH / height
+		y1 := (y + 1) * srcH / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := x * srcW / width
+			x1 := (x + 1) * srcW / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				offset := rgba.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(rgba.Pix[offset])
+					g += uint32(rgba.Pix[offset+1])
+					b += uint32(rgba.Pix[offset+2])
+					a += uint32(rgba.Pix[offset+3])
+					offset += 4
+					n++
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / n)
+			dst.Pix[offset+1] = uint8(g / n)
+			dst.Pix[offset+2] = uint8(b / n)
+			dst.Pix[offset+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// flattenImage 将透明图片合成到白色背景上，用于 JPEG 编码
+func flattenImage(src *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(src.Bounds())
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Over)
+	return dst
+}
+
+// AudioPartFromFile 读取本地音频并生成输入音频片段，格式由内容或扩展名推断
+func AudioPartFromFile(path string) (ContentPart, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("failed to read audio: %w", err)
+	}
+	return audioPart(data, path, "")
+}
+
+// AudioPartFromReader 从 io.Reader 读取音频，format 为空时自动推断
+func AudioPartFromReader(r io.Reader, format string) (ContentPart, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("failed to read audio: %w", err)
+	}
+	return audioPart(data, "", format)
+}
+
+// AudioPartFromBytes 从内存数据生成输入音频片段，format 为空时自动推断
+func AudioPartFromBytes(data []byte, format string) (ContentPart, error) {
+	return audioPart(data, "", format)
+}
+
+// audioPart 推断音频格式并编码为 base64
+func audioPart(data []byte, filename, format string) (ContentPart, error) {
+	if format == "" {
+		switch DetectMIMEType(data, filename) {
+		case "audio/wave", "audio/wav", "audio/x-wav", "audio/vnd.wave":
+			format = "wav"
+		case "audio/mpeg", "audio/mp3":
+			format = "mp3"
+		default:
+			return ContentPart{}, fmt.Errorf("cannot detect audio format, expected wav or mp3")
+		}
+	}
+	return AudioPart(base64.StdEncoding.EncodeToString(data), format), nil
+}
+
+// FilePartFromFile 读取本地文件（如 PDF）并生成文件片段
+func FilePartFromFile(path string) (ContentPart, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("failed to read file: %w", err)
+	}
+	return FilePartFromBytes(filepath.Base(path), data), nil
+}
+
+// FilePartFromReader 从 io.Reader 读取文件并生成文件片段
+func FilePartFromReader(filename string, r io.Reader) (ContentPart, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("failed to read file: %w", err)
+	}
+	return FilePartFromBytes(filename, data), nil
+}
+
+// FilePartFromBytes 从内存数据生成文件片段
+func FilePartFromBytes(filename string, data []byte) ContentPart {
+	return FilePart(filename, DataURL(DetectMIMEType(data, filename), data))
+}
+
+// UserWithImageFiles 添加带本地图片的用户消息
+func (b *MessageBuilder) UserWithImageFiles(text string, opts *ImageOptions, paths ...string) *MessageBuilder {
+	parts := make([]ContentPart, 0, len(paths))
+	for _, path := range paths {
+		part, err := ImagePartFromFile(path, opts)
+		if err != nil {
+			return b.fail(err)
+		}
+		parts = append(parts, part)
+	}
+	return b.userWithAttachments(text, parts...)
+}
+
+// UserWithImageData 添加带内存图片的用户消息
+func (b *MessageBuilder) UserWithImageData(text string, opts *ImageOptions, images ...[]byte) *MessageBuilder {
+	parts := make([]ContentPart, 0, len(images))
+	for _, data := range images {
+		part, err := ImagePartFromBytes(data, opts)
+		if err != nil {
+			return b.fail(err)
+		}
+		parts = append(parts, part)
+	}
+	return b.userWithAttachments(text, parts...)
+}
+
+// UserWithImageReader 添加从 io.Reader 读取图片的用户消息
+func (b *MessageBuilder) UserWithImageReader(text string, opts *ImageOptions, r io.Reader) *MessageBuilder {
+	part, err := ImagePartFromReader(r, opts)
+	if err != nil {
+		return b.fail(err)
+	}
+	return b.userWithAttachments(text, part)
+}
+
+// UserWithAudioFile 添加带本地音频的用户消息
+func (b *MessageBuilder) UserWithAudioFile(text, path string) *MessageBuilder {
+	part, err := AudioPartFromFile(path)
+	if err != nil {
+		return b.fail(err)
+	}
+	return b.userWithAttachments(text, part)
+}
+
+// UserWithAudio 添加带音频数据的用户消息，format 为空时自动推断
+func (b *MessageBuilder) UserWithAudio(text string, data []byte, format string) *MessageBuilder {
+	part, err := AudioPartFromBytes(data, format)
+	if err != nil {
+		return b.fail(err)
+	}
+	return b.userWithAttachments(text, part)
+}
+
+// UserWithFile 添加带本地文件（如 PDF）的用户消息
+func (b *MessageBuilder) UserWithFile(text, path string) *MessageBuilder {
+	part, err := FilePartFromFile(path)
+	if err != nil {
+		return b.fail(err)
+	}
+	return b.userWithAttachments(text, part)
+}
+
+// UserWithFileData 添加带内存文件的用户消息
+func (b *MessageBuilder) UserWithFileData(text, filename string, data []byte) *MessageBuilder {
+	return b.userWithAttachments(text, FilePartFromBytes(filename, data))
+}
+
+// userWithAttachments 组合文本和附件片段
+func (b *MessageBuilder) userWithAttachments(text string, attachments ...ContentPart) *MessageBuilder {
+	parts := make([]ContentPart, 0, len(attachments)+1)
+	if text != "" {
+		parts = append(parts, TextPart(text))
+	}
+	parts = append(parts, attachments...)
+	return b.UserWithParts(parts...)
+}
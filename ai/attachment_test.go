@@ -0,0 +1,158 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testPNG 生成带噪点的测试图片，避免被过度压缩
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 7), uint8(y * 13), uint8((x * y) % 251), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("生成测试图片失败: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// decodeDataURL 解析 data URL
+func decodeDataURL(t *testing.T, url string) (string, []byte) {
+	t.Helper()
+	if !strings.HasPrefix(url, "data:") {
+		t.Fatalf("不是data URL: %.40s", url)
+	}
+	meta, payload, _ := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		t.Fatalf("base64解码失败: %v", err)
+	}
+	return strings.TrimSuffix(meta, ";base64"), data
+}
+
+// TestImageAttachments 测试本地图片附件
+func TestImageAttachments(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "photo.png")
+	if err := os.WriteFile(path, testPNG(t, 800, 600), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	builder := NewMessageBuilder().
+		UserWithImageFiles("描述这张图片", &ImageOptions{Detail: ImageDetailLow, MaxDimension: 200}, path)
+	if err := builder.Err(); err != nil {
+		t.Fatalf("添加图片失败: %v", err)
+	}
+
+	parts := builder.Build()[0].Content.Parts
+	if len(parts) != 2 || parts[0].Text != "描述这张图片" || parts[1].ImageURL.Detail != ImageDetailLow {
+		t.Fatalf("图片消息结构错误: %+v", parts)
+	}
+
+	mimeType, data := decodeDataURL(t, parts[1].ImageURL.URL)
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("解码缩放后的图片失败: %v", err)
+	}
+	if mimeType != "image/png" || cfg.Width != 200 || cfg.Height != 150 {
+		t.Errorf("缩放结果错误: %s %dx%d", mimeType, cfg.Width, cfg.Height)
+	}
+
+	// 超过大小限制时重新编码为 JPEG
+	const maxBytes = 20 * 1024
+	part, err := ImagePartFromReader(bytes.NewReader(testPNG(t, 800, 600)), &ImageOptions{MaxBytes: maxBytes})
+	if err != nil {
+		t.Fatalf("压缩图片失败: %v", err)
+	}
+	mimeType, data = decodeDataURL(t, part.ImageURL.URL)
+	if mimeType != "image/jpeg" || len(data) > maxBytes {
+		t.Errorf("压缩结果错误: %s %d字节", mimeType, len(data))
+	}
+
+	// 未超限时原样嵌入
+	original := testPNG(t, 16, 16)
+	part, _ = ImagePartFromBytes(original, nil)
+	if _, data = decodeDataURL(t, part.ImageURL.URL); !bytes.Equal(data, original) {
+		t.Error("未超限的图片不应该被重新编码")
+	}
+
+	// 无法读取尺寸的格式在大小未超限时原样嵌入，超限时报错
+	webp := append([]byte("RIFF\x1a\x00\x00\x00WEBPVP8 "), make([]byte, 14)...)
+	builder = NewMessageBuilder().UserWithImageReader("webp", &ImageOptions{MaxDimension: 200, MaxBytes: 1024}, bytes.NewReader(webp))
+	if err := builder.Err(); err != nil {
+		t.Fatalf("未超限的webp图片不应该报错: %v", err)
+	}
+	if mimeType, data = decodeDataURL(t, builder.Build()[0].Content.Parts[1].ImageURL.URL); mimeType != "image/webp" || !bytes.Equal(data, webp) {
+		t.Errorf("webp图片应该原样嵌入: %s %d字节", mimeType, len(data))
+	}
+	if _, err := ImagePartFromBytes(webp, &ImageOptions{MaxBytes: 16}); err == nil {
+		t.Error("超过大小限制且无法解码的图片应该报错")
+	}
+
+	t.Logf("图片附件测试通过")
+}
+
+// TestAudioAndFileAttachments 测试音频和文件附件
+func TestAudioAndFileAttachments(t *testing.T) {
+	wav := append([]byte("RIFF\x24\x00\x00\x00WAVEfmt "), make([]byte, 32)...)
+	pdf := []byte("%PDF-1.4\n1 0 obj\n<<>>\nendobj\n%%EOF")
+
+	builder := NewMessageBuilder().
+		UserWithAudio("转写这段音频", wav, "").
+		UserWithFileData("总结这份文档", "report.pdf", pdf)
+	if err := builder.Err(); err != nil {
+		t.Fatalf("添加附件失败: %v", err)
+	}
+
+	messages := builder.Build()
+	audio := messages[0].Content.Parts[1]
+	if audio.Type != ContentTypeInputAudio || audio.InputAudio.Format != "wav" {
+		t.Errorf("音频片段错误: %+v", audio)
+	}
+
+	file := messages[1].Content.Parts[1]
+	mimeType, data := decodeDataURL(t, file.File.FileData)
+	if file.Type != ContentTypeFile || file.File.Filename != "report.pdf" || mimeType != "application/pdf" || !bytes.Equal(data, pdf) {
+		t.Errorf("文件片段错误: %s %+v", mimeType, file.File.Filename)
+	}
+
+	// 出错的附件不会被添加，错误通过 Err 返回
+	builder = NewMessageBuilder().
+		UserWithImageFiles("不存在的图片", nil, filepath.Join(t.TempDir(), "missing.png")).
+		UserWithAudio("未知格式", []byte("not audio"), "").
+		User("继续")
+	if builder.Err() == nil || !strings.Contains(builder.Err().Error(), "failed to read image") {
+		t.Errorf("应该记录第一个错误，实际: %v", builder.Err())
+	}
+	if len(builder.Build()) != 1 {
+		t.Errorf("出错的消息不应该被添加，实际%d条", len(builder.Build()))
+	}
+	if messages, err := builder.BuildE(); err == nil || messages != nil {
+		t.Errorf("BuildE 应该返回错误而不是不完整的消息: %v", err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("MustBuild 出错时应该 panic")
+			}
+		}()
+		builder.MustBuild()
+	}()
+	if messages, err := NewMessageBuilder().User("hi").BuildE(); err != nil || len(messages) != 1 {
+		t.Errorf("没有错误时 BuildE 应该返回消息: %v", err)
+	}
+
+	t.Logf("音频和文件附件测试通过")
+}
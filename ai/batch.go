@@ -0,0 +1,403 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 批量执行的默认参数
+const (
+	DefaultBatchConcurrency = 4
+	DefaultBatchRetries     = 2
+	DefaultBatchRetryDelay  = time.Second
+)
+
+// BatchRunner 以有限并发批量执行聊天请求
+//
+// 结果按输入顺序返回，单个请求的失败记录在对应结果中，不影响其他请求。
+// 设置 Checkpoint 后每个成功的结果会追加到 JSONL 文件，任务中断后用同样的输入重新运行会跳过已完成的请求；
+// 写检查点失败时停止发出新的请求，Run 返回该错误。
+type BatchRunner struct {
+	Client *Client
+	// Concurrency 同时执行的请求数，为 0 时使用 DefaultBatchConcurrency
+	Concurrency int
+	// MaxRetries 单个请求失败后的重试次数，为 0 时使用 DefaultBatchRetries，小于 0 时不重试
+	MaxRetries int
+	// RetryDelay 首次重试前的等待时间，之后每次翻倍；速率限制错误优先使用 Retry-After
+	RetryDelay time.Duration
+	// RetryIf 判断错误是否重试，为 nil 时重试速率限制、服务端错误和超时
+	RetryIf func(err error) bool
+	// Checkpoint 检查点文件路径，为空时不记录
+	Checkpoint string
+	// OnProgress 每个请求完成（包括从检查点恢复）后调用，调用是串行的
+	OnProgress func(BatchProgress)
+
+	// openCheckpoint 打开检查点文件，为 nil 时以追加方式打开 Checkpoint
+	openCheckpoint func(path string) (io.WriteCloser, error)
+}
+
+// BatchResult 单个请求的结果
+type BatchResult struct {
+	Index    int
+	Response *ChatResponse
+	Err      error
+	// Attempts 实际发出的次数，从检查点恢复时为 0
+	Attempts int
+	// Resumed 结果是否来自检查点
+	Resumed bool
+}
+
+// BatchProgress 批量执行的进度
+type BatchProgress struct {
+	// Total 请求总数，输入为通道时为 0
+	Total     int
+	Completed int
+	Failed    int
+	Resumed   int
+	Usage     Usage
+	// Last 刚完成的结果
+	Last *BatchResult
+}
+
+// BatchReport 批量执行的汇总
+type BatchReport struct {
+	Results   []BatchResult
+	Usage     Usage
+	Succeeded int
+	Failed    int
+	Resumed   int
+}
+
+// Errors 返回所有失败的结果
+func (r *BatchReport) Errors() []BatchResult {
+	var failed []BatchResult
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// NewBatchRunner 创建批量执行器
+func NewBatchRunner(client *Client) *BatchRunner {
+	return &BatchRunner{Client: client}
+}
+
+// Run 批量执行请求，返回按输入顺序排列的结果
+//
+// ctx 取消或写检查点失败后不再发出新的请求，未执行的请求记录同样的错误，Run 也返回该错误。
+func (r *BatchRunner) Run(ctx context.Context, requests []*ChatRequest) (*BatchReport, error) {
+	ch := make(chan *ChatRequest, len(requests))
+	for _, req := range requests {
+		ch <- req
+	}
+	close(ch)
+	return r.run(ctx, ch, len(requests))
+}
+
+// RunChan 批量执行通道中的请求，通道关闭后返回，结果按接收顺序排列
+func (r *BatchRunner) RunChan(ctx context.Context, requests <-chan *ChatRequest) (*BatchReport, error) {
+	return r.run(ctx, requests, 0)
+}
+
+// batchState 一次批量执行的共享状态
+type batchState struct {
+	mu         sync.Mutex
+	report     BatchReport
+	progress   BatchProgress
+	checkpoint io.WriteCloser
+	// stop 写检查点失败时停止批量执行
+	stop context.CancelCauseFunc
+}
+
+func (r *BatchRunner) run(ctx context.Context, requests <-chan *ChatRequest, total int) (*BatchReport, error) {
+	done, err := loadBatchCheckpoint(r.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	state := &batchState{progress: BatchProgress{Total: total}, stop: stop}
+	if r.Checkpoint != "" {
+		open := r.openCheckpoint
+		if open == nil {
+			open = func(path string) (io.WriteCloser, error) {
+				return os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+			}
+		}
+		state.checkpoint, err = open(r.Checkpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open checkpoint: %w", err)
+		}
+		defer state.checkpoint.Close()
+	}
+
+	concurrency := r.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	index := 0
+	for req := range requests {
+		i := index
+		index++
+		state.mu.Lock()
+		state.report.Results = append(state.report.Results, BatchResult{Index: i})
+		state.mu.Unlock()
+
+		hash := batchRequestHash(req)
+		if entry, ok := done[i]; ok && entry.Hash == hash {
+			r.finish(state, BatchResult{Index: i, Response: entry.response(), Resumed: true}, "")
+			continue
+		}
+
+		// 取消后把剩余的请求都记为未执行
+		if ctx.Err() != nil {
+			r.finish(state, BatchResult{Index: i, Err: context.Cause(ctx)}, "")
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			r.finish(state, BatchResult{Index: i, Err: context.Cause(ctx)}, "")
+			continue
+		}
+
+		wg.Add(1)
+		go func(req *ChatRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			resp, attempts, err := r.execute(ctx, req)
+			r.finish(state, BatchResult{Index: i, Response: resp, Err: err, Attempts: attempts}, hash)
+		}(req)
+	}
+	wg.Wait()
+
+	report := &state.report
+	if ctx.Err() != nil {
+		return report, context.Cause(ctx)
+	}
+	return report, nil
+}
+
+// execute 执行单个请求，按 RetryIf 重试
+func (r *BatchRunner) execute(ctx context.Context, req *ChatRequest) (*ChatResponse, int, error) {
+	retries := r.MaxRetries
+	if retries == 0 {
+		retries = DefaultBatchRetries
+	}
+	delay := r.RetryDelay
+	if delay <= 0 {
+		delay = DefaultBatchRetryDelay
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := r.Client.ChatCompletion(ctx, req)
+		if err == nil {
+			return resp, attempt, nil
+		}
+		if attempt > retries || ctx.Err() != nil || !r.shouldRetry(err) {
+			return nil, attempt, err
+		}
+
+		wait := delay << (attempt - 1)
+		var rateErr *RateLimitError
+		if errors.As(err, &rateErr) && rateErr.RetryAfter > 0 {
+			wait = time.Duration(rateErr.RetryAfter) * time.Second
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, attempt, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// shouldRetry 判断错误是否重试
+func (r *BatchRunner) shouldRetry(err error) bool {
+	if r.RetryIf != nil {
+		return r.RetryIf(err)
+	}
+	switch ClassifyError(err) {
+	case ErrorKindRateLimit, ErrorKindServer, ErrorKindTimeout:
+		return true
+	}
+	return false
+}
+
+// finish 记录结果、写检查点并通知进度，hash 为空时不写检查点；写检查点失败时停止批量执行
+func (r *BatchRunner) finish(state *batchState, result BatchResult, hash string) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	state.report.Results[result.Index] = result
+	progress := &state.progress
+	progress.Completed++
+	switch {
+	case result.Err != nil:
+		progress.Failed++
+		state.report.Failed++
+	case result.Resumed:
+		progress.Resumed++
+		state.report.Resumed++
+	default:
+		state.report.Succeeded++
+	}
+	if result.Response != nil && result.Response.Usage != nil {
+		usage := result.Response.Usage
+		for _, u := range []*Usage{&progress.Usage, &state.report.Usage} {
+			u.PromptTokens += usage.PromptTokens
+			u.CompletionTokens += usage.CompletionTokens
+			u.TotalTokens += usage.TotalTokens
+		}
+	}
+
+	if hash != "" && result.Err == nil && state.checkpoint != nil {
+		if err := writeBatchCheckpoint(state.checkpoint, result, hash); err != nil {
+			state.stop(fmt.Errorf("failed to write checkpoint: %w", err))
+		}
+	}
+
+	if r.OnProgress != nil {
+		snapshot := *progress
+		snapshot.Last = &result
+		r.OnProgress(snapshot)
+	}
+}
+
+// batchCheckpointEntry 检查点文件中的一行，Hash 用于确认输入没有变化
+type batchCheckpointEntry struct {
+	Index       int             `json:"index"`
+	Hash        string          `json:"hash"`
+	Response    json.RawMessage `json:"response"`
+	ServedModel string          `json:"served_model,omitempty"`
+}
+
+// writeBatchCheckpoint 把成功的结果追加为检查点文件中的一行
+func writeBatchCheckpoint(w io.Writer, result BatchResult, hash string) error {
+	raw := result.Response.Raw
+	if len(raw) == 0 {
+		var err error
+		if raw, err = json.Marshal(result.Response); err != nil {
+			return err
+		}
+	}
+	line, err := json.Marshal(batchCheckpointEntry{
+		Index:       result.Index,
+		Hash:        hash,
+		Response:    raw,
+		ServedModel: result.Response.ServedModel,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+// response 还原检查点中的响应
+func (e batchCheckpointEntry) response() *ChatResponse {
+	var resp ChatResponse
+	if err := json.Unmarshal(e.Response, &resp); err != nil {
+		return nil
+	}
+	resp.Raw = e.Response
+	resp.ServedModel = e.ServedModel
+	return &resp
+}
+
+// loadBatchCheckpoint 读取检查点，文件不存在时返回空；无法解析的行（如中断时写了一半）会被忽略
+func loadBatchCheckpoint(path string) (map[int]batchCheckpointEntry, error) {
+	done := make(map[int]batchCheckpointEntry)
+	if path == "" {
+		return done, nil
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry batchCheckpointEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Hash == "" {
+			continue
+		}
+		if entry.response() == nil {
+			continue
+		}
+		done[entry.Index] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	return done, nil
+}
+
+// batchRequestHash 计算请求的摘要，用于判断检查点中的结果是否对应同一个请求
+func batchRequestHash(req *ChatRequest) string {
+	data, _ := json.Marshal(struct {
+		Request   *ChatRequest `json:"request"`
+		Fallbacks []string     `json:"fallbacks,omitempty"`
+	}{req, req.Fallbacks})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ReadBatchFile 读取 JSONL 格式的请求文件，每行一个请求，忽略空行和 # 开头的注释行
+//
+// 每行可以是 ChatRequest，也可以是 OpenAI Batch API 格式（请求体在 body 字段中）。
+func ReadBatchFile(path string) ([]*ChatRequest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var requests []*ChatRequest
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var envelope struct {
+			Body json.RawMessage `json:"body"`
+		}
+		data := []byte(text)
+		if err := json.Unmarshal(data, &envelope); err == nil && len(envelope.Body) > 0 {
+			data = envelope.Body
+		}
+		var req ChatRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		requests = append(requests, &req)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
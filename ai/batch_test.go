@@ -0,0 +1,208 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newBatchServer 按请求内容回复的测试服务器：内容为 fail 时返回 400，flaky 首次返回 503
+func newBatchServer(t *testing.T) (*Client, *int32) {
+	var calls int32
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		var req ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		content := req.Messages[len(req.Messages)-1].Content.Text
+
+		mu.Lock()
+		first := !seen[content]
+		seen[content] = true
+		mu.Unlock()
+
+		switch {
+		case content == "fail":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"bad","type":"invalid_request_error"}}`))
+			return
+		case content == "flaky" && first:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"message":"busy","type":"server_error"}}`))
+			return
+		case content == "slow":
+			time.Sleep(20 * time.Millisecond)
+		}
+		resp, _ := json.Marshal(map[string]interface{}{
+			"id":      "r-" + content,
+			"choices": []interface{}{map[string]interface{}{"index": 0, "message": map[string]interface{}{"role": "assistant", "content": "echo " + content}}},
+			"usage":   map[string]int{"prompt_tokens": 2, "completion_tokens": 1, "total_tokens": 3},
+		})
+		w.Write(resp)
+	}))
+	t.Cleanup(server.Close)
+	return NewClient(NewConfig(server.URL, "k")), &calls
+}
+
+func batchRequests(contents ...string) []*ChatRequest {
+	requests := make([]*ChatRequest, len(contents))
+	for i, content := range contents {
+		requests[i] = NewRequest("m").Messages(NewMessageBuilder().User(content).Build()).Build()
+	}
+	return requests
+}
+
+// TestBatchRunner 测试批量执行的顺序、错误、重试、用量和进度
+func TestBatchRunner(t *testing.T) {
+	client, calls := newBatchServer(t)
+	runner := NewBatchRunner(client)
+	runner.Concurrency = 3
+	runner.RetryDelay = time.Millisecond
+
+	var progress []BatchProgress
+	runner.OnProgress = func(p BatchProgress) { progress = append(progress, p) }
+
+	report, err := runner.Run(context.Background(), batchRequests("slow", "a", "fail", "flaky", "b"))
+	if err != nil {
+		t.Fatalf("批量执行失败: %v", err)
+	}
+	for i, want := range []string{"echo slow", "echo a", "", "echo flaky", "echo b"} {
+		result := report.Results[i]
+		if result.Index != i {
+			t.Errorf("结果%d的序号错误: %d", i, result.Index)
+		}
+		if want == "" {
+			if result.Err == nil || result.Attempts != 1 {
+				t.Errorf("4xx错误不应重试: %+v", result)
+			}
+			continue
+		}
+		if result.Err != nil || ExtractContent(result.Response.Choices[0].Message) != want {
+			t.Errorf("结果%d错误: %+v", i, result)
+		}
+	}
+	if report.Results[3].Attempts != 2 {
+		t.Errorf("503应该重试一次，实际尝试%d次", report.Results[3].Attempts)
+	}
+	if report.Succeeded != 4 || report.Failed != 1 || report.Usage.TotalTokens != 12 || len(report.Errors()) != 1 {
+		t.Errorf("汇总错误: %+v", report)
+	}
+	if atomic.LoadInt32(calls) != 6 {
+		t.Errorf("应该发出6个请求，实际%d个", *calls)
+	}
+	last := progress[len(progress)-1]
+	if len(progress) != 5 || last.Total != 5 || last.Completed != 5 || last.Failed != 1 || last.Usage.TotalTokens != 12 || last.Last == nil {
+		t.Errorf("进度回调错误: %+v", last)
+	}
+
+	// 通道输入
+	ch := make(chan *ChatRequest)
+	go func() {
+		for _, req := range batchRequests("x", "y") {
+			ch <- req
+		}
+		close(ch)
+	}()
+	runner.OnProgress = nil
+	report, err = runner.RunChan(context.Background(), ch)
+	if err != nil || len(report.Results) != 2 || ExtractContent(report.Results[1].Response.Choices[0].Message) != "echo y" {
+		t.Errorf("通道输入的结果错误: %+v %v", report, err)
+	}
+
+	t.Logf("批量执行测试通过")
+}
+
+// TestBatchCheckpoint 测试检查点恢复和取消
+func TestBatchCheckpoint(t *testing.T) {
+	client, calls := newBatchServer(t)
+	dir := t.TempDir()
+	checkpoint := filepath.Join(dir, "checkpoint.jsonl")
+
+	// 取消后剩余的请求不执行
+	ctx, cancel := context.WithCancel(context.Background())
+	runner := NewBatchRunner(client)
+	runner.Concurrency = 1
+	runner.Checkpoint = checkpoint
+	runner.OnProgress = func(p BatchProgress) {
+		if p.Completed == 2 {
+			cancel()
+		}
+	}
+	requests := batchRequests("a", "b", "c", "d")
+	report, err := runner.Run(ctx, requests)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("取消后应该返回context.Canceled，实际%v", err)
+	}
+	if report.Succeeded != 2 || !errors.Is(report.Results[3].Err, context.Canceled) {
+		t.Errorf("取消后的结果错误: %+v", report)
+	}
+
+	// 模拟中断时写了一半的行
+	f, _ := os.OpenFile(checkpoint, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString(`{"index":2,"hash":"trunc`)
+	f.Close()
+
+	// 用同样的输入恢复，只执行未完成的请求；修改过的请求重新执行
+	atomic.StoreInt32(calls, 0)
+	requests[1] = batchRequests("b2")[0]
+	runner.OnProgress = nil
+	report, err = runner.Run(context.Background(), requests)
+	if err != nil {
+		t.Fatalf("恢复执行失败: %v", err)
+	}
+	if report.Resumed != 1 || !report.Results[0].Resumed || report.Results[0].Attempts != 0 {
+		t.Errorf("第一个请求应该从检查点恢复: %+v", report.Results[0])
+	}
+	if got := ExtractContent(report.Results[1].Response.Choices[0].Message); got != "echo b2" {
+		t.Errorf("修改过的请求应该重新执行，实际%s", got)
+	}
+	if atomic.LoadInt32(calls) != 3 || report.Usage.TotalTokens != 12 {
+		t.Errorf("应该只执行3个请求，实际%d个，用量%d", *calls, report.Usage.TotalTokens)
+	}
+
+	// 写检查点失败时停止执行并返回错误
+	atomic.StoreInt32(calls, 0)
+	failing := NewBatchRunner(client)
+	failing.Concurrency = 1
+	failing.Checkpoint = filepath.Join(dir, "failing.jsonl")
+	failing.openCheckpoint = func(string) (io.WriteCloser, error) { return &failingWriter{}, nil }
+	report, err = failing.Run(context.Background(), batchRequests("a", "b", "c"))
+	if err == nil || !strings.Contains(err.Error(), "failed to write checkpoint") {
+		t.Fatalf("写检查点失败时应该返回错误，实际%v", err)
+	}
+	if report.Results[0].Err != nil || report.Results[2].Err == nil || atomic.LoadInt32(calls) > 2 {
+		t.Errorf("写检查点失败后不应继续执行: %+v，请求%d个", report.Results, *calls)
+	}
+
+	// 请求文件支持 ChatRequest 和 Batch API 两种格式
+	path := filepath.Join(dir, "requests.jsonl")
+	os.WriteFile(path, []byte(strings.Join([]string{
+		`{"model":"m","messages":[{"role":"user","content":"plain"}]}`,
+		`# 注释`,
+		``,
+		`{"custom_id":"1","method":"POST","url":"/v1/chat/completions","body":{"model":"m","messages":[{"role":"user","content":"batch"}]}}`,
+	}, "\n")), 0o644)
+	loaded, err := ReadBatchFile(path)
+	if err != nil || len(loaded) != 2 || loaded[1].Messages[0].Content.Text != "batch" {
+		t.Errorf("读取请求文件错误: %v %v", loaded, err)
+	}
+
+	t.Logf("批量检查点测试通过")
+}
+
+// failingWriter 写入总是失败的检查点文件
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+func (failingWriter) Close() error                { return nil }
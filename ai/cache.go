@@ -0,0 +1,366 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheEntries MemoryCache 未指定容量时的最大条目数
+const DefaultCacheEntries = 1000
+
+// ResponseCache 响应缓存，值为序列化后的聊天响应
+//
+// 客户端在缓存读写出错时视为未命中，不影响请求本身。ttl 为 0 表示不过期。
+// Get 返回的切片会成为响应的 Raw 字段，实现不应返回与内部存储共享的切片。
+type ResponseCache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// CacheKey 返回请求的规范化摘要，用作缓存键
+//
+// 摘要覆盖模型、消息、工具、采样参数和 Extra 等所有发送给服务端的字段，与字段顺序无关；
+// stream 和 stream_options 不参与计算，因此流式和非流式请求共用缓存。
+func CacheKey(req *ChatRequest) (string, error) {
+	normalized := *req
+	normalized.Stream = nil
+	if _, ok := req.Extra["stream_options"]; ok {
+		normalized.Extra = make(map[string]interface{}, len(req.Extra))
+		for k, v := range req.Extra {
+			if k != "stream_options" {
+				normalized.Extra[k] = v
+			}
+		}
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+	// 重新编码一次，使 Extra 覆盖的字段和嵌套对象的键都按字典序排列
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var canonical interface{}
+	if err := decoder.Decode(&canonical); err != nil {
+		return "", fmt.Errorf("failed to normalize request: %w", err)
+	}
+	if data, err = json.Marshal(canonical); err != nil {
+		return "", fmt.Errorf("failed to normalize request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// cacheKey 返回请求的缓存键，未配置缓存或请求设置了 NoCache 时返回空字符串
+func (c *Config) cacheKey(req *ChatRequest) string {
+	if c.Cache == nil || req.NoCache {
+		return ""
+	}
+	key, err := CacheKey(req)
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+// cachedResponse 读取缓存的响应，key 为空或未命中时返回 nil
+func (c *Config) cachedResponse(ctx context.Context, key string) *ChatResponse {
+	if key == "" {
+		return nil
+	}
+	data, ok, err := c.Cache.Get(ctx, key)
+	if err != nil || !ok {
+		return nil
+	}
+	var response ChatResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil
+	}
+	response.Raw = data
+	response.CacheHit = true
+	return &response
+}
+
+// storeResponse 写入缓存，key 为空或响应不完整时不写入
+func (c *Config) storeResponse(ctx context.Context, key string, resp *ChatResponse) {
+	if key == "" || len(resp.Choices) == 0 {
+		return
+	}
+	for _, choice := range resp.Choices {
+		// 中途断开的流没有结束原因，不应被当作完整结果重放
+		if choice.FinishReason == "" {
+			return
+		}
+	}
+	data := []byte(resp.Raw)
+	if len(data) == 0 {
+		var err error
+		if data, err = json.Marshal(resp); err != nil {
+			return
+		}
+	}
+	c.Cache.Set(ctx, key, data, c.CacheTTL)
+}
+
+// newCachedStream 把缓存的响应重放为流：每个选择一个数据块，有用量时追加一个用量数据块
+func newCachedStream(ctx context.Context, resp *ChatResponse) *StreamReader {
+	var buf bytes.Buffer
+	write := func(chunk StreamResponse) {
+		data, _ := json.Marshal(chunk)
+		buf.WriteString("data: ")
+		buf.Write(data)
+		buf.WriteString("\n\n")
+	}
+	chunk := func(choices []StreamChoice, usage *Usage) StreamResponse {
+		return StreamResponse{
+			ID:                resp.ID,
+			Object:            "chat.completion.chunk",
+			Created:           resp.Created,
+			Model:             resp.Model,
+			Choices:           choices,
+			Usage:             usage,
+			SystemFingerprint: resp.SystemFingerprint,
+			ServiceTier:       resp.ServiceTier,
+		}
+	}
+
+	for _, choice := range resp.Choices {
+		var delta Message
+		if choice.Message != nil {
+			delta = *choice.Message
+		}
+		if len(delta.ToolCalls) > 0 {
+			calls := make([]ToolCall, len(delta.ToolCalls))
+			copy(calls, delta.ToolCalls)
+			for i := range calls {
+				calls[i].Index = &[]int{i}[0]
+			}
+			delta.ToolCalls = calls
+		}
+		write(chunk([]StreamChoice{{
+			Index:        choice.Index,
+			Delta:        &delta,
+			FinishReason: choice.FinishReason,
+			Logprobs:     choice.Logprobs,
+		}}, nil))
+	}
+	if resp.Usage != nil {
+		write(chunk([]StreamChoice{}, resp.Usage))
+	}
+	buf.WriteString("data: [DONE]\n\n")
+
+	// 整个响应可能在一个数据块中，缓冲区需要容纳最长的一行
+	reader := io.NopCloser(bytes.NewReader(buf.Bytes()))
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), buf.Len()+1)
+	return &StreamReader{
+		reader:   reader,
+		scanner:  scanner,
+		ctx:      ctx,
+		cacheHit: true,
+	}
+}
+
+// MemoryCache 进程内的 LRU 缓存，可被多个 goroutine 并发使用
+//
+// 写入和读取时都会复制值，调用方修改返回的切片不影响缓存的内容。
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // 最近使用的在前
+	now        func() time.Time
+}
+
+// memoryEntry MemoryCache 中的一条记录
+type memoryEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemoryCache 创建 LRU 缓存，maxEntries 为 0 时使用 DefaultCacheEntries
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheEntries
+	}
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// Get 读取缓存，过期的记录会被删除
+func (m *MemoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*memoryEntry)
+	if !entry.expiresAt.IsZero() && !m.now().Before(entry.expiresAt) {
+		m.order.Remove(element)
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+	m.order.MoveToFront(element)
+	return bytes.Clone(entry.value), true, nil
+}
+
+// Set 写入缓存，超出容量时淘汰最久未使用的记录
+func (m *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := &memoryEntry{key: key, value: bytes.Clone(value)}
+	if ttl > 0 {
+		entry.expiresAt = m.now().Add(ttl)
+	}
+	if element, ok := m.entries[key]; ok {
+		element.Value = entry
+		m.order.MoveToFront(element)
+		return nil
+	}
+	m.entries[key] = m.order.PushFront(entry)
+	for m.order.Len() > m.maxEntries {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+// Delete 删除缓存
+func (m *MemoryCache) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if element, ok := m.entries[key]; ok {
+		m.order.Remove(element)
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+// Len 返回当前的条目数，包括尚未清理的过期记录
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// DiskCache 每条记录保存为目录中的一个文件，可在多个进程之间共享
+//
+// 文件第一行是过期时间（Unix 纳秒，0 表示不过期），其余为缓存的值。
+type DiskCache struct {
+	Dir string
+	now func() time.Time
+}
+
+// NewDiskCache 创建磁盘缓存，目录不存在时自动创建
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &DiskCache{Dir: dir, now: time.Now}, nil
+}
+
+// clock 返回当前时间，直接构造的 DiskCache 使用 time.Now
+func (d *DiskCache) clock() time.Time {
+	if d.now == nil {
+		return time.Now()
+	}
+	return d.now()
+}
+
+func (d *DiskCache) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return "", fmt.Errorf("invalid cache key %q", key)
+	}
+	return filepath.Join(d.Dir, key+".cache"), nil
+}
+
+// Get 读取缓存，过期的文件会被删除
+func (d *DiskCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	path, err := d.path(key)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	header, value, ok := bytes.Cut(data, []byte("\n"))
+	expiresAt, err := strconv.ParseInt(string(header), 10, 64)
+	if !ok || err != nil {
+		return nil, false, fmt.Errorf("corrupted cache file %s", path)
+	}
+	if expiresAt != 0 && d.clock().UnixNano() >= expiresAt {
+		os.Remove(path)
+		return nil, false, nil
+	}
+	return value, true, nil
+}
+
+// Set 写入缓存，先写临时文件再重命名，避免并发读到写了一半的文件
+func (d *DiskCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = d.clock().Add(ttl).UnixNano()
+	}
+
+	tmp, err := os.CreateTemp(d.Dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(tmp, "%d\n", expiresAt)
+	if err == nil {
+		_, err = tmp.Write(value)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Delete 删除缓存，文件不存在时不报错
+func (d *DiskCache) Delete(ctx context.Context, key string) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestResponseCache 测试缓存命中、绕过和流式重放
+func TestResponseCache(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.Header.Get("Accept") == "text/event-stream" {
+			w.Write([]byte("data: {\"id\":\"s1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"流\"}}]}\n\n" +
+				"data: {\"id\":\"s1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"式\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n"))
+			return
+		}
+		w.Write([]byte(`{"id":"r1","model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"hi","tool_calls":[{"id":"c1","type":"function","function":{"name":"f","arguments":"{}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(NewConfig(server.URL, "k").WithCache(NewMemoryCache(10), time.Minute))
+	ctx := context.Background()
+	newRequest := func(content string) *ChatRequest {
+		return NewRequest("m").Messages(NewMessageBuilder().User(content).Build()).Temperature(0.5).Build()
+	}
+
+	resp, err := client.ChatCompletion(ctx, newRequest("a"))
+	if err != nil || resp.CacheHit {
+		t.Fatalf("首次请求不应命中缓存: %v", err)
+	}
+	resp, err = client.ChatCompletion(ctx, newRequest("a"))
+	if err != nil || !resp.CacheHit || resp.ID != "r1" || resp.Usage.TotalTokens != 5 || resp.ServedModel != "m" {
+		t.Errorf("相同请求应该命中缓存: %+v %v", resp, err)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("命中缓存时不应发出请求，实际%d次", calls)
+	}
+
+	// 修改命中的 Raw 不影响之后的命中
+	for i := range resp.Raw {
+		resp.Raw[i] = ' '
+	}
+	if resp, err = client.ChatCompletion(ctx, newRequest("a")); err != nil || !resp.CacheHit || resp.ID != "r1" {
+		t.Errorf("修改返回的Raw不应破坏缓存: %+v %v", resp, err)
+	}
+
+	// 绕过缓存
+	bypass := newRequest("a")
+	bypass.NoCache = true
+	if resp, _ := client.ChatCompletion(ctx, bypass); resp.CacheHit || atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("NoCache 的请求不应读取缓存")
+	}
+
+	// 非流式的缓存可以作为流重放，工具调用和用量保持不变
+	stream, err := client.ChatCompletionStream(ctx, newRequest("a"))
+	if err != nil {
+		t.Fatalf("流式请求失败: %v", err)
+	}
+	if !stream.CacheHit() {
+		t.Errorf("流式请求应该命中缓存")
+	}
+	replayed, err := stream.Collect()
+	if err != nil {
+		t.Fatalf("重放失败: %v", err)
+	}
+	message := replayed.Choices[0].Message
+	if !replayed.CacheHit || ExtractContent(message) != "hi" || len(message.ToolCalls) != 1 || message.ToolCalls[0].Function.Name != "f" ||
+		message.ToolCalls[0].Index != nil || replayed.Choices[0].FinishReason != "tool_calls" || replayed.Usage.TotalTokens != 5 {
+		t.Errorf("重放的响应错误: %+v", replayed)
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("重放不应发出请求")
+	}
+
+	// 读完的流写入缓存，之后的非流式请求直接命中
+	stream, _ = client.ChatCompletionStream(ctx, newRequest("b"))
+	if _, err := stream.Collect(); err != nil {
+		t.Fatalf("流式请求失败: %v", err)
+	}
+	resp, err = client.ChatCompletion(ctx, newRequest("b"))
+	if err != nil || !resp.CacheHit || ExtractContent(resp.Choices[0].Message) != "流式" || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("流式响应应该被缓存: %+v %v", resp, err)
+	}
+
+	t.Logf("响应缓存测试通过")
+}
+
+// TestCacheKey 测试缓存键的规范化
+func TestCacheKey(t *testing.T) {
+	base := func() *ChatRequest {
+		return NewRequest("m").Messages(NewMessageBuilder().User("hi").Build()).Temperature(0.2).Build()
+	}
+	key := func(req *ChatRequest) string {
+		k, err := CacheKey(req)
+		if err != nil {
+			t.Fatalf("计算缓存键失败: %v", err)
+		}
+		return k
+	}
+
+	a, b := base(), base()
+	a.Extra["x"], a.Extra["y"] = 1, map[string]interface{}{"p": 1, "q": 2}
+	b.Extra["y"], b.Extra["x"] = map[string]interface{}{"q": 2, "p": 1}, 1
+	b.Stream = &[]bool{true}[0]
+	b.Extra["stream_options"] = map[string]bool{"include_usage": true}
+	if key(a) != key(b) {
+		t.Errorf("字段顺序和流式参数不应影响缓存键")
+	}
+
+	c := base()
+	c.Temperature = &[]float64{0.3}[0]
+	d := base()
+	d.Extra["top_k"] = 5
+	e := base()
+	e.Model = "other"
+	for _, other := range []*ChatRequest{c, d, e} {
+		if key(other) == key(base()) {
+			t.Errorf("参数不同的请求缓存键不应相同")
+		}
+	}
+
+	t.Logf("缓存键测试通过")
+}
+
+// TestCacheStores 测试内存缓存和磁盘缓存
+func TestCacheStores(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	clock := func() time.Time { return now }
+
+	memory := NewMemoryCache(2)
+	memory.now = clock
+	memory.Set(ctx, "a", []byte("1"), 0)
+	memory.Set(ctx, "b", []byte("2"), time.Second)
+	memory.Get(ctx, "a")
+	memory.Set(ctx, "c", []byte("3"), 0)
+	if _, ok, _ := memory.Get(ctx, "b"); ok {
+		t.Errorf("最久未使用的记录应该被淘汰")
+	}
+	if v, ok, _ := memory.Get(ctx, "a"); !ok || string(v) != "1" || memory.Len() != 2 {
+		t.Errorf("最近使用的记录应该保留")
+	}
+	memory.Set(ctx, "d", []byte("4"), time.Second)
+	now = now.Add(time.Second)
+	if _, ok, _ := memory.Get(ctx, "d"); ok {
+		t.Errorf("过期的记录不应返回")
+	}
+	memory.Delete(ctx, "a")
+	if _, ok, _ := memory.Get(ctx, "a"); ok || memory.Len() != 0 {
+		t.Errorf("删除后不应返回")
+	}
+
+	dir := filepath.Join(t.TempDir(), "cache")
+	disk, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatalf("创建磁盘缓存失败: %v", err)
+	}
+	disk.now = clock
+	disk.Set(ctx, "k1", []byte("{\"a\":1}\n"), 0)
+	disk.Set(ctx, "k2", []byte("x"), time.Minute)
+	if v, ok, err := disk.Get(ctx, "k1"); !ok || err != nil || string(v) != "{\"a\":1}\n" {
+		t.Errorf("磁盘缓存读取错误: %q %v %v", v, ok, err)
+	}
+
+	// 另一个实例共享同一目录
+	other := &DiskCache{Dir: dir, now: clock}
+	if _, ok, _ := other.Get(ctx, "k2"); !ok {
+		t.Errorf("磁盘缓存应该在实例之间共享")
+	}
+	now = now.Add(time.Minute)
+	if _, ok, _ := disk.Get(ctx, "k2"); ok {
+		t.Errorf("过期的文件不应返回")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "k2.cache")); !os.IsNotExist(err) {
+		t.Errorf("过期的文件应该被删除")
+	}
+	if err := disk.Set(ctx, "../x", nil, 0); err == nil {
+		t.Errorf("包含路径分隔符的键应该报错")
+	}
+	disk.Delete(ctx, "k1")
+	if _, ok, _ := disk.Get(ctx, "k1"); ok {
+		t.Errorf("删除后不应返回")
+	}
+
+	t.Logf("缓存存储测试通过")
+}
@@ -2,6 +2,7 @@ package ai
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -18,8 +19,8 @@ func init() {
 	config, configFile, err := LoadConfigFromFile("config.json")
 	if err != nil {
 		// 如果配置文件不存在，从环境变量加载
-		config = LoadConfigFromEnv()
-		if config.APIKey == "" {
+		config, err = ConfigFromEnv(EnvPrefix)
+		if err != nil || config.APIKey == "" {
 			fmt.Println("Warning: No API key found in config.json or environment variables")
 			// 使用测试用的默认配置
 			config = NewConfig("https://api.openai.com", "test-key")
@@ -187,9 +188,9 @@ func TestCustomParameters(t *testing.T) {
 		Messages(messages).
 		Temperature(0.5).
 		MaxTokens(100).
-		Extra("presence_penalty", 0.1).
-		Extra("frequency_penalty", 0.1).
-		Extra("top_p", 0.9).
+		PresencePenalty(0.1).
+		FrequencyPenalty(0.1).
+		TopP(0.9).
 		Build()
 
 	resp, err := testClient.ChatCompletion(ctx, req)
@@ -200,7 +201,7 @@ func TestCustomParameters(t *testing.T) {
 
 	t.Logf("自定义参数测试通过")
 	t.Logf("响应: %s", ExtractContent(resp.Choices[0].Message))
-	t.Logf("使用的额外参数: presence_penalty=0.1, frequency_penalty=0.1, top_p=0.9")
+	t.Logf("使用的参数: presence_penalty=0.1, frequency_penalty=0.1, top_p=0.9")
 }
 
 // TestJSONMode 测试JSON模式
@@ -215,7 +216,7 @@ func TestJSONMode(t *testing.T) {
 	req := NewRequest(getTestModel("chat")).
 		Messages(messages).
 		MaxTokens(200).
-		Extra("response_format", map[string]string{"type": "json_object"}).
+		JSONMode().
 		Build()
 
 	resp, err := testClient.ChatCompletion(ctx, req)
@@ -248,7 +249,7 @@ func TestConfigValidation(t *testing.T) {
 	// 测试有效请求
 	validReq := &ChatRequest{
 		Model:       "gpt-4.1",
-		Messages:    []Message{{Role: "user", Content: "test"}},
+		Messages:    []Message{{Role: "user", Content: TextContent("test")}},
 		Temperature: &[]float64{0.7}[0],
 		TopP:        &[]float64{0.9}[0],
 	}
@@ -354,7 +355,7 @@ func TestDynamicConfig(t *testing.T) {
 // TestExtractContent 测试内容提取
 func TestExtractContent(t *testing.T) {
 	// 测试字符串内容
-	msg1 := &Message{Content: "简单文本"}
+	msg1 := &Message{Content: TextContent("简单文本")}
 	content1 := ExtractContent(msg1)
 	if content1 != "简单文本" {
 		t.Errorf("字符串内容提取失败，期望'简单文本'，实际'%s'", content1)
@@ -362,22 +363,11 @@ func TestExtractContent(t *testing.T) {
 
 	// 测试多模态内容
 	msg2 := &Message{
-		Content: []interface{}{
-			map[string]interface{}{
-				"type": "text",
-				"text": "文本部分1",
-			},
-			map[string]interface{}{
-				"type": "image_url",
-				"image_url": map[string]interface{}{
-					"url": "https://example.com/image.jpg",
-				},
-			},
-			map[string]interface{}{
-				"type": "text",
-				"text": "文本部分2",
-			},
-		},
+		Content: PartsContent(
+			TextPart("文本部分1"),
+			ImagePart("https://example.com/image.jpg", ""),
+			TextPart("文本部分2"),
+		),
 	}
 	content2 := ExtractContent(msg2)
 	expected := "[文本部分1 文本部分2]"
@@ -385,6 +375,16 @@ func TestExtractContent(t *testing.T) {
 		t.Errorf("多模态内容提取失败，期望'%s'，实际'%s'", expected, content2)
 	}
 
+	// 测试从响应解码的多模态内容
+	var msg3 Message
+	err := json.Unmarshal([]byte(`{"role":"user","content":[{"type":"text","text":"文本部分1"},{"type":"image_url","image_url":{"url":"https://example.com/image.jpg"}},{"type":"text","text":"文本部分2"}]}`), &msg3)
+	if err != nil {
+		t.Fatalf("解码多模态消息失败: %v", err)
+	}
+	if content3 := ExtractContent(&msg3); content3 != expected {
+		t.Errorf("解码后的多模态内容提取失败，期望'%s'，实际'%s'", expected, content3)
+	}
+
 	t.Logf("内容提取测试通过")
 }
 
@@ -442,15 +442,8 @@ func BenchmarkRequestBuilder(b *testing.B) {
 
 // getTestModel 获取测试模型名称
 func getTestModel(modelType string) string {
-	if testConfig != nil {
-		switch modelType {
-		case "chat":
-			return testConfig.Models.Chat
-		case "vision":
-			return testConfig.Models.Vision
-		case "function":
-			return testConfig.Models.Function
-		}
+	if model := testClient.GetConfig().ResolveModel(modelType); model != modelType {
+		return model
 	}
 	return "gpt-4.1" // 默认模型
 }
@@ -4,51 +4,274 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Client OpenAI API 客户端
+// Client OpenAI API 客户端，可被多个 goroutine 并发使用
 type Client struct {
+	state atomic.Pointer[clientState]
+
+	// mu 串行化配置更新和订阅者管理，请求路径不加锁
+	mu          sync.Mutex
+	subscribers map[int]func(old, new *Config)
+	nextSubID   int
+
+	// flights 开启 Dedupe 时进行中的请求
+	flights flightGroup
+}
+
+// clientState 一次配置对应的客户端状态，替换时整体换新
+type clientState struct {
 	config *Config
 	http   *http.Client
+	// transport 按代理和 TLS 设置创建的传输层，使用自定义 HTTPClient 或 Transport 时为 nil
+	transport    *http.Transport
+	transportKey string
+	keys         *keyPool
+	keyPoolKey   string
+	endpoints    *endpointPool
+	endpointKey  string
+	limiter      *rateLimiter
+	limiterKey   string
 }
 
 // NewClient 创建新的客户端
+//
+// 代理或 TLS 设置无效时使用默认传输层，需要检查错误时使用 SetConfig。
 func NewClient(config *Config) *Client {
 	if config.Timeout == 0 {
 		config.Timeout = 30 * time.Second
 	}
 
-	return &Client{
-		config: config,
-		http:   &http.Client{Timeout: config.Timeout},
+	c := &Client{}
+	state, err := newClientState(config, nil)
+	if err != nil {
+		state = &clientState{
+			config:    config,
+			http:      config.newHTTPClient(http.DefaultTransport),
+			keys:      newKeyPool(config, nil),
+			endpoints: newEndpointPool(config, nil),
+			limiter:   newRateLimiter(config),
+		}
+	}
+	c.state.Store(state)
+	return c
+}
+
+// newClientState 按配置创建状态，传输层设置未变时复用 previous 的传输层
+//
+// 配置了 HTTPClient 或 Transport 时使用自定义的传输层，两种情况都会套上 TransportMiddlewares。
+// 密钥池、端点池和限流器的设置未变时同样复用，统计、暂停、熔断和限流状态不受配置替换影响。
+func newClientState(config *Config, previous *clientState) (*clientState, error) {
+	state := &clientState{
+		config:       config,
+		transportKey: config.transportKey(),
+		keyPoolKey:   config.keyPoolKey(),
+		endpointKey:  config.endpointPoolKey(),
+		limiterKey:   config.rateLimitKey(),
+	}
+
+	if custom := config.customTransport(); custom != nil {
+		state.http = config.newHTTPClient(custom)
+	} else {
+		if previous != nil && previous.transport != nil && previous.transportKey == state.transportKey {
+			state.transport = previous.transport
+		} else {
+			transport, err := config.buildTransport()
+			if err != nil {
+				return nil, err
+			}
+			state.transport = transport
+		}
+		state.http = config.newHTTPClient(state.transport)
+	}
+
+	if previous != nil && previous.keyPoolKey == state.keyPoolKey {
+		state.keys = previous.keys
+	} else {
+		var previousKeys *keyPool
+		if previous != nil {
+			previousKeys = previous.keys
+		}
+		state.keys = newKeyPool(config, previousKeys)
+	}
+
+	if previous != nil && previous.endpointKey == state.endpointKey {
+		state.endpoints = previous.endpoints
+	} else {
+		var previousEndpoints *endpointPool
+		if previous != nil {
+			previousEndpoints = previous.endpoints
+		}
+		state.endpoints = newEndpointPool(config, previousEndpoints)
+	}
+
+	if previous != nil && previous.limiterKey == state.limiterKey {
+		state.limiter = previous.limiter
+	} else {
+		state.limiter = newRateLimiter(config)
 	}
+	return state, nil
+}
+
+// load 返回当前状态，一次请求内应只调用一次以使用一致的配置
+func (c *Client) load() *clientState {
+	return c.state.Load()
 }
 
 // ChatCompletion 创建聊天补全
+//
+// 请求失败且错误类别在 FallbackOn 中时，依次尝试回退链中的模型，响应的 ServedModel 为实际使用的模型。
+// 配置了 Cache 时，回退链中每个模型的请求都先查缓存；开启 Dedupe 时，并发的相同请求共享一次上游请求。
 func (c *Client) ChatCompletion(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
 	if req.Stream != nil && *req.Stream {
 		return nil, fmt.Errorf("use ChatCompletionStream for streaming requests")
 	}
 
-	return c.doChatRequest(ctx, req)
+	state := c.load()
+	handler := state.config.chatHandler(func(ctx context.Context, prepared *ChatRequest) (*ChatResponse, error) {
+		key := state.config.cacheKey(prepared)
+		if resp := state.config.cachedResponse(ctx, key); resp != nil {
+			resp.ServedModel = prepared.Model
+			return resp, nil
+		}
+		resp, err := c.doChatShared(ctx, state, prepared, func(ctx context.Context) (*ChatResponse, error) {
+			resp, err := c.doChatRequest(ctx, state, prepared)
+			if err == nil {
+				state.config.storeResponse(ctx, key, resp)
+			}
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp.ServedModel = prepared.Model
+		return resp, nil
+	})
+	return withFallbacks(ctx, state.config, req, func(prepared *ChatRequest) (*ChatResponse, error) {
+		candidate := *prepared
+		return handler(ctx, &candidate)
+	})
 }
 
 // ChatCompletionStream 创建流式聊天补全
+//
+// 模型回退只在收到响应之前发生，已经开始的流中断时不会切换模型。
+// 命中缓存时把缓存的响应重放为数据块；未命中时完整读完的流会写入缓存。
 func (c *Client) ChatCompletionStream(ctx context.Context, req *ChatRequest) (*StreamReader, error) {
 	req.Stream = &[]bool{true}[0]
-	return c.doChatStreamRequest(ctx, req)
+	state := c.load()
+	handler := state.config.streamHandler(func(ctx context.Context, prepared *ChatRequest) (*StreamReader, error) {
+		key := state.config.cacheKey(prepared)
+		if resp := state.config.cachedResponse(ctx, key); resp != nil {
+			stream := newCachedStream(ctx, resp)
+			stream.servedModel = prepared.Model
+			return stream, nil
+		}
+		stream, err := c.doChatStreamRequest(ctx, state, prepared)
+		if err != nil {
+			return nil, err
+		}
+		stream.servedModel = prepared.Model
+		if key != "" {
+			stream.OnComplete(func(resp *ChatResponse) {
+				state.config.storeResponse(ctx, key, resp)
+			})
+		}
+		return stream, nil
+	})
+	return withFallbacks(ctx, state.config, req, func(prepared *ChatRequest) (*StreamReader, error) {
+		candidate := *prepared
+		return handler(ctx, &candidate)
+	})
 }
 
-// SetConfig 更新配置
-func (c *Client) SetConfig(config *Config) {
-	c.config = config
-	if config.Timeout > 0 {
-		c.http.Timeout = config.Timeout
+// prepareRequest 解析模型角色并用配置中的默认参数填充未设置的字段
+//
+// 需要修改时返回浅拷贝，调用方的请求保持不变。
+func (c *Config) prepareRequest(req *ChatRequest) *ChatRequest {
+	model := c.ResolveModel(req.Model)
+	defaults := c.DefaultsFor(req.Model, model)
+
+	prepared := *req
+	prepared.Model = model
+	changed := defaults.fill(&prepared)
+	if !changed && model == req.Model {
+		return req
 	}
+	return &prepared
+}
+
+// SetConfig 原子地替换配置，进行中的请求继续使用旧配置
+//
+// 代理或 TLS 设置变化时会重建传输层并关闭旧传输层的空闲连接，自定义的传输层由调用方管理；
+// 配置未通过 Validate 时返回错误并保留当前配置。替换成功后通知所有订阅者。
+func (c *Client) SetConfig(config *Config) error {
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	previous := c.load()
+	state, err := newClientState(config, previous)
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	c.state.Store(state)
+
+	subscribers := make([]func(old, new *Config), 0, len(c.subscribers))
+	for _, id := range sortedSubscriberIDs(c.subscribers) {
+		subscribers = append(subscribers, c.subscribers[id])
+	}
+	c.mu.Unlock()
+
+	if previous.transport != nil && previous.transport != state.transport {
+		previous.transport.CloseIdleConnections()
+	}
+	for _, fn := range subscribers {
+		fn(previous.config, config)
+	}
+	return nil
 }
 
 // GetConfig 获取当前配置
 func (c *Client) GetConfig() *Config {
-	return c.config
+	return c.load().config
+}
+
+// OnConfigChange 订阅配置替换事件，返回取消订阅的函数
+//
+// 回调在 SetConfig 的调用方 goroutine 中按订阅顺序执行。
+func (c *Client) OnConfigChange(fn func(old, new *Config)) (unsubscribe func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.subscribers == nil {
+		c.subscribers = make(map[int]func(old, new *Config))
+	}
+	id := c.nextSubID
+	c.nextSubID++
+	c.subscribers[id] = fn
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.subscribers, id)
+	}
+}
+
+// sortedSubscriberIDs 返回按订阅顺序排列的 ID
+func sortedSubscriberIDs(subscribers map[int]func(old, new *Config)) []int {
+	ids := make([]int, 0, len(subscribers))
+	for id := range subscribers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
 }
@@ -0,0 +1,60 @@
+package ai
+
+import (
+	"sync"
+)
+
+// ClientSet 按档案名管理客户端，客户端在首次使用时创建并被复用
+type ClientSet struct {
+	mu      sync.Mutex
+	file    *ConfigFile
+	clients map[string]*Client
+}
+
+// NewClientSet 基于配置文件创建客户端集合
+func NewClientSet(file *ConfigFile) *ClientSet {
+	return &ClientSet{
+		file:    file,
+		clients: make(map[string]*Client),
+	}
+}
+
+// LoadClientSet 从配置文件创建客户端集合
+func LoadClientSet(filename string) (*ClientSet, error) {
+	file, err := ReadConfigFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientSet(file), nil
+}
+
+// Client 返回指定档案的客户端，name 为空时使用 SelectProfile 选择的档案
+func (s *ClientSet) Client(name string) (*Client, error) {
+	if name == "" {
+		name = s.file.SelectProfile()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if client, ok := s.clients[name]; ok {
+		return client, nil
+	}
+
+	config, err := s.file.Profile(name)
+	if err != nil {
+		return nil, err
+	}
+	client := NewClient(config)
+	s.clients[name] = client
+	return client, nil
+}
+
+// Default 返回默认档案的客户端
+func (s *ClientSet) Default() (*Client, error) {
+	return s.Client("")
+}
+
+// Names 返回所有可用的档案名
+func (s *ClientSet) Names() []string {
+	return s.file.ProfileNames()
+}
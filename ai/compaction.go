@@ -0,0 +1,201 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultCompactionPrompt 默认的摘要指令
+const DefaultCompactionPrompt = "你是对话压缩助手。请把下面的对话记录压缩成一段简洁的摘要，" +
+	"保留所有重要事实、用户的偏好和约束、已经做出的决定、尚未完成的任务以及工具调用得到的关键结果。" +
+	"不要编造内容，不要遗漏数字、名称和标识符，直接输出摘要正文。"
+
+// CompactionNotePrefix 压缩生成的摘要消息的前缀
+const CompactionNotePrefix = "[对话摘要] "
+
+// Compactor 基于摘要的对话压缩器，使用 Client 把最早的一段历史总结为一条摘要消息
+type Compactor struct {
+	Client           *Client
+	Model            string // 摘要使用的模型
+	Prompt           string // 摘要指令，为空时使用 DefaultCompactionPrompt
+	KeepRecent       int    // 原样保留的最近消息数，默认 6，会按轮次边界向前调整
+	MaxSummaryTokens int    // 摘要的最大令牌数，0 表示不限制
+	NoteRole         string // 摘要消息的角色：system 或 assistant，默认 system
+}
+
+// CompactionRecord 一次压缩的审计记录
+type CompactionRecord struct {
+	At       time.Time `json:"at"`
+	Model    string    `json:"model"`
+	Start    int       `json:"start"` // 被压缩的消息在完整历史中的起止位置 [Start, End)，计入之前被压缩、裁剪或清空的消息，不计摘要消息
+	End      int       `json:"end"`
+	Messages []Message `json:"messages"` // 被压缩的消息，包括上一次压缩生成的摘要消息
+	Summary  string    `json:"summary"`
+	Usage    *Usage    `json:"usage,omitempty"`
+}
+
+// NewCompactor 创建压缩器
+func NewCompactor(client *Client, model string) *Compactor {
+	return &Compactor{
+		Client:     client,
+		Model:      model,
+		Prompt:     DefaultCompactionPrompt,
+		KeepRecent: 6,
+		NoteRole:   "system",
+	}
+}
+
+// CompactIfNeeded 仅在对话超出令牌预算时压缩，未压缩时返回 nil
+func (p *Compactor) CompactIfNeeded(ctx context.Context, conv *Conversation) (*CompactionRecord, error) {
+	if !conv.OverBudget() {
+		return nil, nil
+	}
+	return p.Compact(ctx, conv)
+}
+
+// Compact 把除最近 KeepRecent 条消息以外的历史总结为一条摘要消息，没有可压缩的内容时返回 nil
+func (p *Compactor) Compact(ctx context.Context, conv *Conversation) (*CompactionRecord, error) {
+	if p.Client == nil || p.Model == "" {
+		return nil, fmt.Errorf("compactor requires a client and a summarizer model")
+	}
+
+	conv.mu.RLock()
+	version := conv.version
+	end := compactionEnd(conv.messages, p.keepRecent())
+	span := append([]Message(nil), conv.messages[:end]...)
+	start, notes := conv.dropped, conv.leadingNotes()
+	conv.mu.RUnlock()
+
+	if end < 2 {
+		return nil, nil
+	}
+
+	prompt := p.Prompt
+	if prompt == "" {
+		prompt = DefaultCompactionPrompt
+	}
+	builder := NewRequest(p.Model).
+		Messages(NewMessageBuilder().
+			System(prompt).
+			User(renderTranscript(span)).
+			Build())
+	if p.MaxSummaryTokens > 0 {
+		builder.MaxTokens(p.MaxSummaryTokens)
+	}
+
+	resp, err := p.Client.ChatCompletion(ctx, builder.Build())
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message == nil {
+		return nil, fmt.Errorf("failed to summarize conversation: response has no choices")
+	}
+	summary := strings.TrimSpace(ExtractContent(resp.Choices[0].Message))
+	if summary == "" {
+		return nil, fmt.Errorf("failed to summarize conversation: empty summary")
+	}
+
+	role := p.NoteRole
+	if role == "" {
+		role = "system"
+	}
+	note := Message{Role: role, Content: TextContent(CompactionNotePrefix + summary)}
+
+	record := CompactionRecord{
+		At:       time.Now(),
+		Model:    p.Model,
+		Start:    start,
+		End:      start + end - notes,
+		Messages: span,
+		Summary:  summary,
+		Usage:    resp.Usage,
+	}
+
+	conv.mu.Lock()
+	defer conv.mu.Unlock()
+	if conv.version != version || len(conv.messages) < end {
+		return nil, fmt.Errorf("conversation was modified during compaction")
+	}
+	messages := make([]Message, 0, len(conv.messages)-end+1)
+	messages = append(messages, note)
+	conv.messages = append(messages, conv.messages[end:]...)
+	conv.version++
+	conv.dropped += end - notes
+	conv.compactions = append(conv.compactions, record)
+
+	return &record, nil
+}
+
+// leadingNotes 返回历史开头由上一次压缩生成的摘要消息数（0 或 1），调用方需持有锁
+func (c *Conversation) leadingNotes() int {
+	if len(c.compactions) == 0 || len(c.messages) == 0 {
+		return 0
+	}
+	last := c.compactions[len(c.compactions)-1]
+	if c.messages[0].Content.Text == CompactionNotePrefix+last.Summary {
+		return 1
+	}
+	return 0
+}
+
+// keepRecent 返回需要保留的最近消息数
+func (p *Compactor) keepRecent() int {
+	if p.KeepRecent <= 0 {
+		return 6
+	}
+	return p.KeepRecent
+}
+
+// compactionEnd 计算压缩范围的结束位置，保证不会把工具结果和工具调用分开
+func compactionEnd(messages []Message, keep int) int {
+	end := len(messages) - keep
+	for end > 0 && messages[end].Role == "tool" {
+		end--
+	}
+	if end < 0 {
+		return 0
+	}
+	return end
+}
+
+// renderTranscript 把消息渲染为供摘要使用的文本记录
+func renderTranscript(messages []Message) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		role := msg.Role
+		if msg.Role == "tool" {
+			role = "tool(" + msg.ToolCallID + ")"
+		}
+		b.WriteString(role)
+		b.WriteString(": ")
+
+		if msg.Content.IsMultiPart() {
+			for _, part := range msg.Content.Parts {
+				switch part.Type {
+				case ContentTypeText:
+					b.WriteString(part.Text)
+				default:
+					b.WriteString("[" + part.Type + "]")
+				}
+				b.WriteByte(' ')
+			}
+		} else {
+			b.WriteString(msg.Content.Text)
+		}
+
+		for _, call := range msg.ToolCalls {
+			fmt.Fprintf(&b, "\n  -> call %s %s(%s)", call.ID, call.Function.Name, call.Function.Arguments)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Compactions 返回所有压缩记录
+func (c *Conversation) Compactions() []CompactionRecord {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]CompactionRecord(nil), c.compactions...)
+}
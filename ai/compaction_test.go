@@ -0,0 +1,125 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestCompaction 测试摘要压缩保留最近轮次并记录被压缩的消息
+func TestCompaction(t *testing.T) {
+	client, requests := newTestServer(t, "用户叫张三，住在北京，偏好摄氏度。")
+
+	conv := NewConversation("你是一个测试助手")
+	for i := 0; i < 4; i++ {
+		conv.AddUser(fmt.Sprintf("问题%d", i)).AddAssistant(fmt.Sprintf("回答%d", i))
+	}
+	call := ToolCall{ID: "call_1", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"location":"北京"}`}}
+	conv.AddUser("北京天气？").
+		AddMessage(Message{Role: "assistant", ToolCalls: []ToolCall{call}}).
+		AddToolResult("call_1", "晴").
+		AddAssistant("北京今天晴。")
+
+	compactor := NewCompactor(client, "gpt-4.1-mini")
+	compactor.KeepRecent = 2 // 落在工具结果上，需要向前调整到工具调用
+
+	record, err := compactor.Compact(context.Background(), conv)
+	if err != nil {
+		t.Fatalf("压缩失败: %v", err)
+	}
+
+	history := conv.History()
+	if len(history) != 4 || history[0].Role != "system" || !strings.HasPrefix(history[0].Content.Text, CompactionNotePrefix) {
+		t.Fatalf("压缩后的历史错误: %+v", history)
+	}
+	if len(history[1].ToolCalls) != 1 || history[2].Role != "tool" {
+		t.Errorf("工具调用和结果应该一起保留: %+v", history[1:])
+	}
+
+	if record.End != 9 || len(record.Messages) != 9 || record.Summary == "" || record.Model != "gpt-4.1-mini" {
+		t.Errorf("压缩记录错误: %+v", record)
+	}
+	if len(conv.Compactions()) != 1 {
+		t.Errorf("应该保留压缩记录")
+	}
+
+	sent := (*requests)[0]
+	if sent["model"] != "gpt-4.1-mini" || !strings.Contains(fmt.Sprint(sent["messages"]), "问题0") {
+		t.Errorf("摘要请求错误: %v", sent)
+	}
+
+	// 再次压缩时位置计入之前压缩掉的消息，不计上一次的摘要消息
+	conv.AddUser("再问").AddAssistant("再答")
+	record, err = compactor.Compact(context.Background(), conv)
+	if err != nil {
+		t.Fatalf("再次压缩失败: %v", err)
+	}
+	if record.Start != 9 || record.End != 12 || len(record.Messages) != 4 || conv.Len() != 3 {
+		t.Errorf("再次压缩的位置错误: [%d, %d) %d条", record.Start, record.End, len(record.Messages))
+	}
+
+	// 没有可压缩的内容
+	if record, err := compactor.Compact(context.Background(), NewConversation("").AddUser("hi")); record != nil || err != nil {
+		t.Errorf("短对话不应该压缩: %v %v", record, err)
+	}
+
+	// 未超出预算时不压缩
+	conv.SetTokenBudget(1<<20, nil)
+	if record, _ := compactor.CompactIfNeeded(context.Background(), conv); record != nil {
+		t.Error("未超出预算时不应该压缩")
+	}
+
+	t.Logf("摘要压缩测试通过")
+}
+
+// TestCompactionPositions 测试裁剪和清空之后压缩记录的位置仍然对应完整历史
+func TestCompactionPositions(t *testing.T) {
+	client, _ := newTestServer(t, "摘要")
+	compactor := NewCompactor(client, "gpt-4.1-mini")
+	compactor.KeepRecent = 2
+	addTurns := func(conv *Conversation, from, n int) {
+		for i := from; i < from+n; i++ {
+			conv.AddUser(fmt.Sprintf("问题%d", i)).AddAssistant(fmt.Sprintf("回答%d", i))
+		}
+	}
+
+	// Trim 删除的消息计入之后的位置
+	conv := NewConversation("")
+	addTurns(conv, 0, 4)
+	conv.SetTokenBudget(4, func(messages []Message) int { return len(messages) })
+	if dropped := conv.Trim(); dropped != 4 {
+		t.Fatalf("应该裁剪4条消息，实际%d条", dropped)
+	}
+	conv.SetTokenBudget(0, nil)
+	addTurns(conv, 4, 2)
+	record, err := compactor.Compact(context.Background(), conv)
+	if err != nil {
+		t.Fatalf("压缩失败: %v", err)
+	}
+	if record.Start != 4 || record.End != 10 || ExtractContent(&record.Messages[0]) != "问题2" {
+		t.Errorf("裁剪后压缩的位置错误: [%d, %d)", record.Start, record.End)
+	}
+
+	// Clear 删除的消息同样计入，摘要消息不计
+	conv.Clear()
+	addTurns(conv, 6, 2)
+	if record, err = compactor.Compact(context.Background(), conv); err != nil {
+		t.Fatalf("压缩失败: %v", err)
+	}
+	if record.Start != 12 || record.End != 14 || ExtractContent(&record.Messages[0]) != "问题6" {
+		t.Errorf("清空后压缩的位置错误: [%d, %d)", record.Start, record.End)
+	}
+
+	// 偏移量随快照保存和恢复
+	restored := RestoreConversation(conv.Snapshot())
+	addTurns(restored, 8, 2)
+	if record, err = compactor.Compact(context.Background(), restored); err != nil {
+		t.Fatalf("压缩失败: %v", err)
+	}
+	if record.Start != 14 || record.End != 18 {
+		t.Errorf("恢复后压缩的位置错误: [%d, %d)", record.Start, record.End)
+	}
+
+	t.Logf("压缩位置测试通过")
+}
@@ -1,7 +1,12 @@
 package ai
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"net/http"
+	"net/url"
+	"os"
 	"time"
 )
 
@@ -13,6 +18,167 @@ type Config struct {
 	Headers    map[string]string `json:"headers"`
 	Proxy      string            `json:"proxy,omitempty"`
 	RetryCount int               `json:"retry_count"`
+
+	// Provider 服务类型：openai（默认，也适用于兼容网关）或 azure
+	Provider string `json:"provider,omitempty"`
+	// APIVersion Azure OpenAI 的 api-version 参数
+	APIVersion string `json:"api_version,omitempty"`
+	// TLS 自定义 TLS 设置，为空时使用系统默认值
+	TLS *TLSConfig `json:"tls,omitempty"`
+
+	// APIKeys 密钥池，设置后代替 APIKey；认证失败或额度耗尽的密钥会暂停 KeyCooldown
+	APIKeys []APIKeyConfig `json:"api_keys,omitempty"`
+	// KeyStrategy 密钥选择策略：round_robin（默认）、weighted 或 least_used
+	KeyStrategy string `json:"key_strategy,omitempty"`
+	// KeyCooldown 密钥暂停时长，为 0 时使用 DefaultKeyCooldown
+	KeyCooldown time.Duration `json:"key_cooldown,omitempty"`
+
+	// Endpoints 多个服务端点，设置后代替 BaseURL；连接错误和 5xx 响应会转移到其他端点
+	Endpoints []EndpointConfig `json:"endpoints,omitempty"`
+	// EndpointStrategy 端点选择策略：priority（默认）或 weighted
+	EndpointStrategy string `json:"endpoint_strategy,omitempty"`
+	// BreakerThreshold 端点连续失败多少次后打开熔断器，为 0 时使用 DefaultBreakerThreshold
+	BreakerThreshold int `json:"breaker_threshold,omitempty"`
+	// BreakerCooldown 熔断器打开后多久允许探测，为 0 时使用 DefaultBreakerCooldown
+	BreakerCooldown time.Duration `json:"breaker_cooldown,omitempty"`
+
+	// Models 逻辑模型角色到具体模型名的映射，如 "vision": "gpt-4o"；请求模型为空时使用 "chat"
+	Models map[string]string `json:"models,omitempty"`
+	// Defaults 请求未设置对应字段时使用的默认参数
+	Defaults RequestDefaults `json:"defaults"`
+	// ModelDefaults 按模型覆盖默认参数，键为具体模型名或角色名
+	ModelDefaults map[string]RequestDefaults `json:"model_defaults,omitempty"`
+
+	// RateLimits 按模型的每分钟请求数和令牌数限制，键为具体模型名，"*" 适用于其他模型；
+	// 设置后请求会在客户端排队等待余量，并根据响应的 x-ratelimit-* 头自动校正；
+	// 响应头和 429 反映的是单个密钥的额度，APIKeys 多于一个时不做校正
+	RateLimits map[string]RateLimit `json:"rate_limits,omitempty"`
+
+	// Fallbacks 模型回退链，键为角色名或具体模型名，值为依次尝试的模型或角色
+	Fallbacks map[string][]string `json:"fallbacks,omitempty"`
+	// FallbackOn 触发回退的错误类别（见 ErrorKind 常量），为 nil 时使用 DefaultFallbackOn
+	FallbackOn []string `json:"fallback_on,omitempty"`
+	// FallbackIf 自定义回退判断，返回 true 时回退，在 FallbackOn 之外额外生效
+	FallbackIf func(err error) bool `json:"-"`
+
+	// Cache 响应缓存，为 nil 时不缓存；相同的请求直接返回缓存的响应，流式请求重放为数据块
+	Cache ResponseCache `json:"-"`
+	// CacheTTL 缓存的有效期，为 0 时不过期
+	CacheTTL time.Duration `json:"cache_ttl,omitempty"`
+	// Dedupe 为 true 时并发的相同 ChatCompletion 请求只发出一次，所有调用方得到同一个结果
+	Dedupe bool `json:"dedupe,omitempty"`
+
+	// Middlewares 包装每次非流式请求的中间件，第一个在最外层
+	Middlewares []ChatMiddleware `json:"-"`
+	// StreamMiddlewares 包装每次流式请求的中间件，第一个在最外层
+	StreamMiddlewares []StreamMiddleware `json:"-"`
+	// TransportMiddlewares 包装 HTTP 传输层的中间件，第一个在最外层
+	TransportMiddlewares []TransportMiddleware `json:"-"`
+	// HTTPClient 自定义 HTTP 客户端，设置后 Timeout、Proxy 和 TLS 不再生效
+	HTTPClient *http.Client `json:"-"`
+	// Transport 自定义传输层，设置后 Proxy 和 TLS 不再生效
+	Transport http.RoundTripper `json:"-"`
+}
+
+// TLSConfig TLS 设置，文件路径在创建传输层时读取
+type TLSConfig struct {
+	CAFile             string `json:"ca_file,omitempty"`   // 额外信任的 CA 证书（PEM）
+	CertFile           string `json:"cert_file,omitempty"` // 双向 TLS 的客户端证书
+	KeyFile            string `json:"key_file,omitempty"`
+	ServerName         string `json:"server_name,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// 服务类型
+const (
+	ProviderOpenAI = "openai"
+	ProviderAzure  = "azure"
+)
+
+// 常用的模型角色
+const (
+	ModelRoleChat     = "chat"
+	ModelRoleVision   = "vision"
+	ModelRoleFunction = "function"
+)
+
+// RequestDefaults 请求参数默认值，只填充请求中未设置的字段
+type RequestDefaults struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"top_p,omitempty"`
+	MaxTokens        *int     `json:"max_tokens,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	ReasoningEffort  string   `json:"reasoning_effort,omitempty"`
+}
+
+// merge 返回以 override 中已设置的字段覆盖 d 的结果
+func (d RequestDefaults) merge(override RequestDefaults) RequestDefaults {
+	if override.Temperature != nil {
+		d.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		d.TopP = override.TopP
+	}
+	if override.MaxTokens != nil {
+		d.MaxTokens = override.MaxTokens
+	}
+	if override.Stop != nil {
+		d.Stop = override.Stop
+	}
+	if override.PresencePenalty != nil {
+		d.PresencePenalty = override.PresencePenalty
+	}
+	if override.FrequencyPenalty != nil {
+		d.FrequencyPenalty = override.FrequencyPenalty
+	}
+	if override.Seed != nil {
+		d.Seed = override.Seed
+	}
+	if override.ReasoningEffort != "" {
+		d.ReasoningEffort = override.ReasoningEffort
+	}
+	return d
+}
+
+// fill 填充请求中未设置的字段，返回是否修改了请求
+func (d RequestDefaults) fill(req *ChatRequest) bool {
+	changed := false
+	if req.Temperature == nil && d.Temperature != nil {
+		req.Temperature = &[]float64{*d.Temperature}[0]
+		changed = true
+	}
+	if req.TopP == nil && d.TopP != nil {
+		req.TopP = &[]float64{*d.TopP}[0]
+		changed = true
+	}
+	if req.MaxTokens == nil && d.MaxTokens != nil {
+		req.MaxTokens = &[]int{*d.MaxTokens}[0]
+		changed = true
+	}
+	if req.Stop == nil && len(d.Stop) > 0 {
+		req.Stop = append([]string(nil), d.Stop...)
+		changed = true
+	}
+	if req.PresencePenalty == nil && d.PresencePenalty != nil {
+		req.PresencePenalty = &[]float64{*d.PresencePenalty}[0]
+		changed = true
+	}
+	if req.FrequencyPenalty == nil && d.FrequencyPenalty != nil {
+		req.FrequencyPenalty = &[]float64{*d.FrequencyPenalty}[0]
+		changed = true
+	}
+	if req.Seed == nil && d.Seed != nil {
+		req.Seed = &[]int{*d.Seed}[0]
+		changed = true
+	}
+	if req.ReasoningEffort == "" && d.ReasoningEffort != "" {
+		req.ReasoningEffort = d.ReasoningEffort
+		changed = true
+	}
+	return changed
 }
 
 // DefaultConfig 默认配置
@@ -53,20 +219,240 @@ func (c *Config) WithProxy(proxy string) *Config {
 	return c
 }
 
+// WithAPIKeys 设置密钥池，权重均为 1
+func (c *Config) WithAPIKeys(keys ...string) *Config {
+	c.APIKeys = make([]APIKeyConfig, 0, len(keys))
+	for _, key := range keys {
+		c.APIKeys = append(c.APIKeys, APIKeyConfig{Key: key})
+	}
+	return c
+}
+
+// WithKeyStrategy 设置密钥选择策略
+func (c *Config) WithKeyStrategy(strategy string) *Config {
+	c.KeyStrategy = strategy
+	return c
+}
+
+// WithKeyCooldown 设置密钥暂停时长
+func (c *Config) WithKeyCooldown(cooldown time.Duration) *Config {
+	c.KeyCooldown = cooldown
+	return c
+}
+
+// WithEndpoints 设置多个服务端点，按顺序优先使用
+func (c *Config) WithEndpoints(urls ...string) *Config {
+	c.Endpoints = make([]EndpointConfig, 0, len(urls))
+	for _, u := range urls {
+		c.Endpoints = append(c.Endpoints, EndpointConfig{URL: u})
+	}
+	return c
+}
+
+// WithCircuitBreaker 设置端点熔断器的连续失败阈值和冷却时间
+func (c *Config) WithCircuitBreaker(threshold int, cooldown time.Duration) *Config {
+	c.BreakerThreshold = threshold
+	c.BreakerCooldown = cooldown
+	return c
+}
+
+// WithFallbacks 设置角色或模型的回退链
+func (c *Config) WithFallbacks(model string, fallbacks ...string) *Config {
+	if c.Fallbacks == nil {
+		c.Fallbacks = make(map[string][]string)
+	}
+	c.Fallbacks[model] = fallbacks
+	return c
+}
+
+// WithFallbackOn 设置触发回退的错误类别，不传参数时只按 FallbackIf 回退
+func (c *Config) WithFallbackOn(kinds ...string) *Config {
+	c.FallbackOn = append([]string{}, kinds...)
+	return c
+}
+
+// WithRateLimit 设置模型的每分钟请求数和令牌数限制，model 为 "*" 时适用于所有未单独设置的模型
+func (c *Config) WithRateLimit(model string, rpm, tpm int) *Config {
+	if c.RateLimits == nil {
+		c.RateLimits = make(map[string]RateLimit)
+	}
+	c.RateLimits[model] = RateLimit{RequestsPerMinute: rpm, TokensPerMinute: tpm}
+	return c
+}
+
+// WithCache 设置响应缓存和有效期
+func (c *Config) WithCache(cache ResponseCache, ttl time.Duration) *Config {
+	c.Cache = cache
+	c.CacheTTL = ttl
+	return c
+}
+
+// WithDedupe 设置是否合并并发的相同请求
+func (c *Config) WithDedupe(enabled bool) *Config {
+	c.Dedupe = enabled
+	return c
+}
+
+// Use 追加非流式请求的中间件
+func (c *Config) Use(middlewares ...ChatMiddleware) *Config {
+	c.Middlewares = append(c.Middlewares, middlewares...)
+	return c
+}
+
+// UseStream 追加流式请求的中间件
+func (c *Config) UseStream(middlewares ...StreamMiddleware) *Config {
+	c.StreamMiddlewares = append(c.StreamMiddlewares, middlewares...)
+	return c
+}
+
+// UseTransport 追加传输层中间件
+func (c *Config) UseTransport(middlewares ...TransportMiddleware) *Config {
+	c.TransportMiddlewares = append(c.TransportMiddlewares, middlewares...)
+	return c
+}
+
+// WithHTTPClient 使用自定义的 HTTP 客户端发送请求
+func (c *Config) WithHTTPClient(client *http.Client) *Config {
+	c.HTTPClient = client
+	return c
+}
+
+// WithTransport 使用自定义的传输层发送请求
+func (c *Config) WithTransport(transport http.RoundTripper) *Config {
+	c.Transport = transport
+	return c
+}
+
 // WithRetry 设置重试次数
 func (c *Config) WithRetry(count int) *Config {
 	c.RetryCount = count
 	return c
 }
 
-// ToHTTPClient 转换为 HTTP 客户端配置
+// WithAzure 使用 Azure OpenAI 端点，请求中的模型名作为部署名
+func (c *Config) WithAzure(apiVersion string) *Config {
+	c.Provider = ProviderAzure
+	c.APIVersion = apiVersion
+	return c
+}
+
+// WithModel 设置模型角色对应的具体模型
+func (c *Config) WithModel(role, model string) *Config {
+	if c.Models == nil {
+		c.Models = make(map[string]string)
+	}
+	c.Models[role] = model
+	return c
+}
+
+// WithDefaults 设置默认请求参数
+func (c *Config) WithDefaults(defaults RequestDefaults) *Config {
+	c.Defaults = defaults
+	return c
+}
+
+// WithModelDefaults 设置指定模型或角色的默认请求参数
+func (c *Config) WithModelDefaults(model string, defaults RequestDefaults) *Config {
+	if c.ModelDefaults == nil {
+		c.ModelDefaults = make(map[string]RequestDefaults)
+	}
+	c.ModelDefaults[model] = defaults
+	return c
+}
+
+// ResolveModel 把模型角色解析为具体模型名，不是已知角色时原样返回
+//
+// 为空时使用 chat 角色；没有配置 chat 角色时返回空字符串，不会把角色名当作模型名发送。
+func (c *Config) ResolveModel(model string) string {
+	if model == "" {
+		return c.Models[ModelRoleChat]
+	}
+	if resolved, ok := c.Models[model]; ok && resolved != "" {
+		return resolved
+	}
+	return model
+}
+
+// DefaultsFor 返回模型的默认请求参数：全局默认值依次被角色和具体模型的设置覆盖
+func (c *Config) DefaultsFor(role, model string) RequestDefaults {
+	defaults := c.Defaults
+	if role != "" && role != model {
+		if override, ok := c.ModelDefaults[role]; ok {
+			defaults = defaults.merge(override)
+		}
+	}
+	if override, ok := c.ModelDefaults[model]; ok {
+		defaults = defaults.merge(override)
+	}
+	return defaults
+}
+
+// WithTLS 设置 TLS
+func (c *Config) WithTLS(tlsConfig *TLSConfig) *Config {
+	c.TLS = tlsConfig
+	return c
+}
+
+// ToHTTPClient 转换为 HTTP 客户端配置，包含自定义传输层和传输层中间件；代理或 TLS 设置无效时使用默认传输层
 func (c *Config) ToHTTPClient() *http.Client {
-	client := &http.Client{
-		Timeout: c.Timeout,
+	if custom := c.customTransport(); custom != nil {
+		return c.newHTTPClient(custom)
+	}
+	if transport, err := c.buildTransport(); err == nil {
+		return c.newHTTPClient(transport)
+	}
+	return c.newHTTPClient(http.DefaultTransport)
+}
+
+// transportKey 返回影响传输层的设置，相同时可以复用连接池
+func (c *Config) transportKey() string {
+	key := c.Proxy
+	if c.TLS != nil {
+		key += fmt.Sprintf("|%+v", *c.TLS)
 	}
+	return key
+}
+
+// buildTransport 按代理和 TLS 设置创建传输层
+func (c *Config) buildTransport() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
 
-	// 如果有代理设置，可以在这里配置
-	// if c.Proxy != "" { ... }
+	if c.Proxy != "" {
+		proxyURL, err := url.Parse(c.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q", c.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if c.TLS != nil {
+		tlsConfig := &tls.Config{
+			ServerName:         c.TLS.ServerName,
+			InsecureSkipVerify: c.TLS.InsecureSkipVerify,
+		}
+		if c.TLS.CAFile != "" {
+			pem, err := os.ReadFile(c.TLS.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA file: %w", err)
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in CA file %s", c.TLS.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		if c.TLS.CertFile != "" || c.TLS.KeyFile != "" {
+			cert, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
 
-	return client
+	return transport, nil
 }
@@ -0,0 +1,419 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecretFilePrefix 以此前缀开头的配置值会被替换为对应文件的内容
+const SecretFilePrefix = "file:"
+
+// 配置文件格式
+const (
+	ConfigFormatJSON = "json"
+	ConfigFormatYAML = "yaml"
+	ConfigFormatTOML = "toml"
+)
+
+// ConfigFormatFromPath 根据扩展名判断配置文件格式，未知扩展名按 JSON 处理
+func ConfigFormatFromPath(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return ConfigFormatYAML
+	case ".toml":
+		return ConfigFormatTOML
+	default:
+		return ConfigFormatJSON
+	}
+}
+
+// ParseConfigFile 解析配置文件内容
+//
+// 字符串值中的 ${VAR} 和 ${VAR:-default} 会被替换为环境变量，$${ 表示字面量 ${；
+// 未设置且没有默认值的变量会返回错误，允许为空时写 ${VAR:-}。
+// 整个值为 file:路径 时替换为文件内容（去掉末尾换行），相对路径相对于 baseDir。
+// 数字和布尔字段也接受字符串，便于写 "retry_count": "${RETRY:-3}"。
+func ParseConfigFile(data []byte, format, baseDir string) (*ConfigFile, error) {
+	var raw interface{}
+	var err error
+	switch format {
+	case ConfigFormatYAML:
+		raw, err = parseYAML(data)
+	case ConfigFormatTOML:
+		raw, err = parseTOML(data)
+	case ConfigFormatJSON, "":
+		err = json.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	expander := &configExpander{baseDir: baseDir}
+	expanded := expander.expandValue(raw, "")
+	if len(expander.problems) > 0 {
+		return nil, fmt.Errorf("config interpolation failed: %s", strings.Join(expander.problems, "; "))
+	}
+
+	var configFile ConfigFile
+	if expanded == nil {
+		return &configFile, nil
+	}
+	configFile.Warnings = unknownConfigKeys(expanded, reflect.TypeOf(configFile), "")
+	encoded, err := json.Marshal(coerceConfigValue(expanded, reflect.TypeOf(configFile)))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(encoded, &configFile); err != nil {
+		return nil, err
+	}
+	return &configFile, nil
+}
+
+// configExpander 展开配置中的环境变量和文件引用
+type configExpander struct {
+	baseDir  string
+	problems []string
+}
+
+// expandValue 递归展开值，path 用于错误信息
+func (e *configExpander) expandValue(value interface{}, path string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = e.expandValue(child, joinConfigPath(path, key))
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = e.expandValue(child, fmt.Sprintf("%s[%d]", path, i))
+		}
+		return v
+	case string:
+		return e.expandString(v, path)
+	default:
+		return value
+	}
+}
+
+// joinConfigPath 拼接配置路径
+func joinConfigPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// expandString 展开单个字符串值
+func (e *configExpander) expandString(s, path string) interface{} {
+	expanded, err := interpolateEnv(s)
+	if err != nil {
+		e.problems = append(e.problems, fmt.Sprintf("%s: %v", path, err))
+		return s
+	}
+
+	if ref, ok := strings.CutPrefix(expanded, SecretFilePrefix); ok {
+		content, err := readSecretFile(ref, e.baseDir)
+		if err != nil {
+			e.problems = append(e.problems, fmt.Sprintf("%s: %v", path, err))
+			return s
+		}
+		return content
+	}
+	return expanded
+}
+
+// coerceConfigValue 按目标类型把字符串转为数字或布尔值，其他值原样返回
+func coerceConfigValue(value interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Map:
+			for key, child := range v {
+				v[key] = coerceConfigValue(child, t.Elem())
+			}
+		case reflect.Struct:
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+				if name == "" || name == "-" {
+					continue
+				}
+				// JSON 解码不区分键的大小写，这里也一样
+				for key, child := range v {
+					if strings.EqualFold(key, name) {
+						v[key] = coerceConfigValue(child, field.Type)
+					}
+				}
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, child := range v {
+				v[i] = coerceConfigValue(child, t.Elem())
+			}
+		}
+	case string:
+		text := strings.TrimSpace(v)
+		switch {
+		case t.Kind() == reflect.Bool:
+			if b, err := strconv.ParseBool(text); err == nil {
+				return b
+			}
+		case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+			if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+				return n
+			}
+		case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+			if f, err := strconv.ParseFloat(text, 64); err == nil {
+				return f
+			}
+		}
+	}
+	return value
+}
+
+// interpolateEnv 替换 ${VAR} 和 ${VAR:-default}
+func interpolateEnv(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	var missing []string
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], "$${") {
+			b.WriteString("${")
+			i += 3
+			continue
+		}
+		if !strings.HasPrefix(s[i:], "${") {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", s)
+		}
+		expr := s[i+2 : i+end]
+		i += end + 1
+
+		name, fallback, hasDefault := strings.Cut(expr, ":-")
+		if !isEnvName(name) {
+			return "", fmt.Errorf("invalid variable name %q", name)
+		}
+		value, ok := os.LookupEnv(name)
+		switch {
+		case ok && value != "":
+		case hasDefault:
+			value = fallback
+		case ok:
+			// 已设置为空字符串
+		default:
+			missing = append(missing, name)
+		}
+		b.WriteString(value)
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return b.String(), nil
+}
+
+// isEnvName 判断是否为合法的环境变量名
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if !(c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// readSecretFile 读取密钥文件，去掉末尾的换行
+func readSecretFile(path, baseDir string) (string, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return "", fmt.Errorf("empty file reference")
+	}
+	if !filepath.IsAbs(path) && baseDir != "" {
+		path = filepath.Join(baseDir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// EnvPrefix LoadConfigFromEnv 使用的环境变量前缀
+const EnvPrefix = "OPENAI"
+
+// ConfigFromEnv 从带前缀的环境变量创建配置，无效的值会返回错误
+//
+// 支持的变量（以前缀 OPENAI 为例）：
+//
+//	OPENAI_BASE_URL、OPENAI_BASE_URLS（逗号分隔的多个端点）、OPENAI_API_KEY、OPENAI_TIMEOUT（如 60s）、OPENAI_RETRY_COUNT、OPENAI_PROXY、
+//	OPENAI_PROVIDER、OPENAI_API_VERSION、OPENAI_API_KEYS（逗号分隔的密钥池）、OPENAI_KEY_STRATEGY、
+//	OPENAI_HEADERS（如 "X-Team=ai,X-Env=prod"）、OPENAI_MODELS（如 "chat=gpt-4.1,vision=gpt-4o"）、
+//	OPENAI_TEMPERATURE、OPENAI_TOP_P、OPENAI_MAX_TOKENS
+//
+// 每个变量都可以改用 _FILE 后缀指向包含其值的文件，例如 OPENAI_API_KEY_FILE=/run/secrets/openai。
+func ConfigFromEnv(prefix string) (*Config, error) {
+	config := DefaultConfig()
+	if err := config.ApplyEnv(prefix); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ApplyEnv 用带前缀的环境变量覆盖配置中的对应字段，未设置的变量不影响配置
+func (c *Config) ApplyEnv(prefix string) error {
+	var problems []string
+	lookup := func(name string) (string, bool) {
+		key := prefix + "_" + name
+		if value, ok := os.LookupEnv(key); ok {
+			return value, true
+		}
+		if file, ok := os.LookupEnv(key + "_FILE"); ok {
+			value, err := readSecretFile(file, "")
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s_FILE: %v", key, err))
+				return "", false
+			}
+			return value, true
+		}
+		return "", false
+	}
+	invalid := func(name, value string, err error) {
+		problems = append(problems, fmt.Sprintf("%s_%s=%q: %v", prefix, name, value, err))
+	}
+
+	if value, ok := lookup("BASE_URL"); ok {
+		c.BaseURL = NormalizeBaseURL(value)
+	}
+	if value, ok := lookup("API_KEY"); ok {
+		c.APIKey = value
+	}
+	if value, ok := lookup("BASE_URLS"); ok {
+		var urls []string
+		for _, u := range strings.Split(value, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				urls = append(urls, u)
+			}
+		}
+		c.WithEndpoints(urls...)
+	}
+	if value, ok := lookup("API_KEYS"); ok {
+		// 逗号或换行分隔，便于用 OPENAI_API_KEYS_FILE 指向每行一个密钥的文件
+		var keys []string
+		for _, key := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+		c.WithAPIKeys(keys...)
+	}
+	if value, ok := lookup("KEY_STRATEGY"); ok {
+		c.KeyStrategy = value
+	}
+	if value, ok := lookup("TIMEOUT"); ok {
+		if timeout, err := time.ParseDuration(value); err != nil {
+			invalid("TIMEOUT", value, err)
+		} else {
+			c.Timeout = timeout
+		}
+	}
+	if value, ok := lookup("RETRY_COUNT"); ok {
+		if count, err := strconv.Atoi(value); err != nil {
+			invalid("RETRY_COUNT", value, err)
+		} else {
+			c.RetryCount = count
+		}
+	}
+	if value, ok := lookup("PROXY"); ok {
+		c.Proxy = value
+	}
+	if value, ok := lookup("PROVIDER"); ok {
+		c.Provider = value
+	}
+	if value, ok := lookup("API_VERSION"); ok {
+		c.APIVersion = value
+	}
+	if value, ok := lookup("HEADERS"); ok {
+		headers, err := parseEnvPairs(value)
+		if err != nil {
+			invalid("HEADERS", value, err)
+		} else {
+			if c.Headers == nil {
+				c.Headers = make(map[string]string)
+			}
+			c.WithHeaders(headers)
+		}
+	}
+	if value, ok := lookup("MODELS"); ok {
+		models, err := parseEnvPairs(value)
+		if err != nil {
+			invalid("MODELS", value, err)
+		}
+		for role, model := range models {
+			c.WithModel(role, model)
+		}
+	}
+	for name, target := range map[string]**float64{
+		"TEMPERATURE": &c.Defaults.Temperature,
+		"TOP_P":       &c.Defaults.TopP,
+	} {
+		if value, ok := lookup(name); ok {
+			if f, err := strconv.ParseFloat(value, 64); err != nil {
+				invalid(name, value, err)
+			} else {
+				*target = &f
+			}
+		}
+	}
+	if value, ok := lookup("MAX_TOKENS"); ok {
+		if n, err := strconv.Atoi(value); err != nil {
+			invalid("MAX_TOKENS", value, err)
+		} else {
+			c.Defaults.MaxTokens = &n
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid environment configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// parseEnvPairs 解析 "k1=v1,k2=v2"，也接受 "Key: Value" 形式
+func parseEnvPairs(s string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		sep := strings.IndexAny(item, "=:")
+		if sep <= 0 {
+			return nil, fmt.Errorf("expected key=value, got %q", item)
+		}
+		pairs[strings.TrimSpace(item[:sep])] = strings.TrimSpace(item[sep+1:])
+	}
+	return pairs, nil
+}
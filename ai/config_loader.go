@@ -1,19 +1,42 @@
 package ai
 
 import (
-	"encoding/json"
+	"fmt"
+	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 )
 
+// ProfileEnv 选择配置档案的环境变量
+const ProfileEnv = "OPENAI_PROFILE"
+
+// DefaultProfileName 由顶层 openai、models、defaults 组成的隐式档案名
+const DefaultProfileName = "default"
+
 // ConfigFile 配置文件结构
+//
+// 顶层的 openai、models、defaults 是单一端点的旧格式，会作为名为 default 的档案；
+// profiles 中可以定义多个命名档案，档案可以通过 inherits 继承另一个档案。
 type ConfigFile struct {
 	OpenAI struct {
-		BaseURL    string            `json:"base_url"`
-		APIKey     string            `json:"api_key"`
-		Timeout    string            `json:"timeout"`
-		RetryCount int               `json:"retry_count"`
-		Headers    map[string]string `json:"headers"`
+		BaseURL          string            `json:"base_url"`
+		APIKey           string            `json:"api_key"`
+		APIKeys          []APIKeyConfig    `json:"api_keys"`
+		KeyStrategy      string            `json:"key_strategy"`
+		KeyCooldown      string            `json:"key_cooldown"`
+		Endpoints        []EndpointConfig  `json:"endpoints"`
+		EndpointStrategy string            `json:"endpoint_strategy"`
+		BreakerThreshold int               `json:"breaker_threshold"`
+		BreakerCooldown  string            `json:"breaker_cooldown"`
+		Timeout          string            `json:"timeout"`
+		RetryCount       int               `json:"retry_count"`
+		Proxy            string            `json:"proxy"`
+		Headers          map[string]string `json:"headers"`
+		TLS              *TLSConfig        `json:"tls"`
+		Dedupe           bool              `json:"dedupe"`
 	} `json:"openai"`
 
 	Models struct {
@@ -27,57 +50,405 @@ type ConfigFile struct {
 		MaxTokens   int     `json:"max_tokens"`
 		TopP        float64 `json:"top_p"`
 	} `json:"defaults"`
+
+	// ModelDefaults 按模型或角色覆盖默认参数
+	ModelDefaults map[string]RequestDefaults `json:"model_defaults"`
+	// RateLimits 按模型的每分钟请求数和令牌数限制
+	RateLimits map[string]RateLimit `json:"rate_limits"`
+	// Fallbacks 按模型或角色配置的回退链
+	Fallbacks map[string][]string `json:"fallbacks"`
+	// FallbackOn 触发回退的错误类别
+	FallbackOn []string `json:"fallback_on"`
+
+	// Profiles 命名档案
+	Profiles map[string]*ProfileConfig `json:"profiles"`
+	// DefaultProfile 未指定档案且未设置 OPENAI_PROFILE 时使用的档案
+	DefaultProfile string `json:"default_profile"`
+
+	// Warnings 解析时发现的未知键，通常是拼写错误，不影响加载
+	Warnings []string `json:"-"`
+}
+
+// ProfileConfig 一个命名档案，未设置的字段从 Inherits 指定的档案继承
+type ProfileConfig struct {
+	Inherits         string                     `json:"inherits,omitempty"`
+	Provider         string                     `json:"provider,omitempty"`
+	BaseURL          string                     `json:"base_url,omitempty"`
+	APIKey           string                     `json:"api_key,omitempty"`
+	APIKeys          []APIKeyConfig             `json:"api_keys,omitempty"`
+	KeyStrategy      string                     `json:"key_strategy,omitempty"`
+	KeyCooldown      string                     `json:"key_cooldown,omitempty"`
+	Endpoints        []EndpointConfig           `json:"endpoints,omitempty"`
+	EndpointStrategy string                     `json:"endpoint_strategy,omitempty"`
+	BreakerThreshold int                        `json:"breaker_threshold,omitempty"`
+	BreakerCooldown  string                     `json:"breaker_cooldown,omitempty"`
+	APIVersion       string                     `json:"api_version,omitempty"`
+	Timeout          string                     `json:"timeout,omitempty"`
+	RetryCount       *int                       `json:"retry_count,omitempty"`
+	Proxy            string                     `json:"proxy,omitempty"`
+	Headers          map[string]string          `json:"headers,omitempty"`
+	TLS              *TLSConfig                 `json:"tls,omitempty"`
+	Dedupe           *bool                      `json:"dedupe,omitempty"`
+	Models           map[string]string          `json:"models,omitempty"`
+	Defaults         RequestDefaults            `json:"defaults"`
+	ModelDefaults    map[string]RequestDefaults `json:"model_defaults,omitempty"`
+	RateLimits       map[string]RateLimit       `json:"rate_limits,omitempty"`
+	Fallbacks        map[string][]string        `json:"fallbacks,omitempty"`
+	FallbackOn       []string                   `json:"fallback_on,omitempty"`
 }
 
-// LoadConfigFromFile 从JSON文件加载配置
+// LoadConfigFromFile 从配置文件加载配置，使用 SelectProfile 选择的档案
 func LoadConfigFromFile(filename string) (*Config, *ConfigFile, error) {
-	data, err := os.ReadFile(filename)
+	return LoadConfigProfile(filename, "")
+}
+
+// LoadConfigProfile 从配置文件加载指定档案的配置，name 为空时按 SelectProfile 选择
+func LoadConfigProfile(filename, name string) (*Config, *ConfigFile, error) {
+	configFile, err := ReadConfigFile(filename)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	var configFile ConfigFile
-	if err := json.Unmarshal(data, &configFile); err != nil {
+	config, err := configFile.Profile(name)
+	if err != nil {
 		return nil, nil, err
 	}
+	return config, configFile, nil
+}
 
-	// 解析超时时间
-	timeout, err := time.ParseDuration(configFile.OpenAI.Timeout)
+// ReadConfigFile 读取并解析配置文件，按扩展名支持 JSON、YAML 和 TOML，并展开环境变量和文件引用
+func ReadConfigFile(filename string) (*ConfigFile, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	configFile, err := ParseConfigFile(data, ConfigFormatFromPath(filename), filepath.Dir(filename))
 	if err != nil {
-		timeout = 30 * time.Second // 默认超时时间
+		return nil, fmt.Errorf("%s: %w", filename, err)
 	}
+	return configFile, nil
+}
 
-	config := &Config{
-		BaseURL:    configFile.OpenAI.BaseURL,
-		APIKey:     configFile.OpenAI.APIKey,
-		Timeout:    timeout,
-		RetryCount: configFile.OpenAI.RetryCount,
-		Headers:    configFile.OpenAI.Headers,
+// LoadConfigFromEnv 从环境变量加载配置，支持的变量见 ConfigFromEnv
+//
+// 无效的值会被忽略并通过标准库 log 输出，其余变量照常生效。
+//
+// Deprecated: 使用 ConfigFromEnv(EnvPrefix)，它会返回无效值的错误。
+func LoadConfigFromEnv() *Config {
+	config := DefaultConfig()
+	if err := config.ApplyEnv(EnvPrefix); err != nil {
+		log.Printf("ai: ignoring invalid environment configuration: %v", err)
 	}
+	return config
+}
 
-	if config.Headers == nil {
-		config.Headers = make(map[string]string)
+// hasLegacy 判断是否使用了顶层的旧格式
+func (f *ConfigFile) hasLegacy() bool {
+	return f.OpenAI.BaseURL != "" || f.OpenAI.APIKey != "" || len(f.OpenAI.APIKeys) > 0 || len(f.OpenAI.Endpoints) > 0 || f.OpenAI.Timeout != "" ||
+		f.OpenAI.RetryCount != 0 || f.OpenAI.Proxy != "" || len(f.OpenAI.Headers) > 0 || f.OpenAI.TLS != nil || f.OpenAI.Dedupe ||
+		f.Models.Chat != "" || f.Models.Vision != "" || f.Models.Function != "" ||
+		f.Defaults.Temperature != 0 || f.Defaults.MaxTokens != 0 || f.Defaults.TopP != 0 ||
+		len(f.ModelDefaults) > 0 || len(f.RateLimits) > 0 || len(f.Fallbacks) > 0 || f.FallbackOn != nil
+}
+
+// legacyProfile 把顶层的旧格式转为档案，零值表示未设置
+func (f *ConfigFile) legacyProfile() *ProfileConfig {
+	profile := &ProfileConfig{
+		BaseURL:          f.OpenAI.BaseURL,
+		APIKey:           f.OpenAI.APIKey,
+		APIKeys:          f.OpenAI.APIKeys,
+		KeyStrategy:      f.OpenAI.KeyStrategy,
+		KeyCooldown:      f.OpenAI.KeyCooldown,
+		Endpoints:        f.OpenAI.Endpoints,
+		EndpointStrategy: f.OpenAI.EndpointStrategy,
+		BreakerThreshold: f.OpenAI.BreakerThreshold,
+		BreakerCooldown:  f.OpenAI.BreakerCooldown,
+		RetryCount:       &[]int{f.OpenAI.RetryCount}[0],
+		Proxy:            f.OpenAI.Proxy,
+		Headers:          f.OpenAI.Headers,
+		TLS:              f.OpenAI.TLS,
+		Timeout:          f.OpenAI.Timeout,
+		Dedupe:           &[]bool{f.OpenAI.Dedupe}[0],
+		ModelDefaults:    f.ModelDefaults,
+		RateLimits:       f.RateLimits,
+		Fallbacks:        f.Fallbacks,
+		FallbackOn:       f.FallbackOn,
+		Models:           make(map[string]string),
 	}
 
-	return config, &configFile, nil
+	roles := map[string]string{
+		ModelRoleChat:     f.Models.Chat,
+		ModelRoleVision:   f.Models.Vision,
+		ModelRoleFunction: f.Models.Function,
+	}
+	for role, model := range roles {
+		if model != "" {
+			profile.Models[role] = model
+		}
+	}
+
+	if f.Defaults.Temperature != 0 {
+		profile.Defaults.Temperature = &[]float64{f.Defaults.Temperature}[0]
+	}
+	if f.Defaults.MaxTokens != 0 {
+		profile.Defaults.MaxTokens = &[]int{f.Defaults.MaxTokens}[0]
+	}
+	if f.Defaults.TopP != 0 {
+		profile.Defaults.TopP = &[]float64{f.Defaults.TopP}[0]
+	}
+	return profile
 }
 
-// LoadConfigFromEnv 从环境变量加载配置
-func LoadConfigFromEnv() *Config {
-	baseURL := os.Getenv("OPENAI_BASE_URL")
-	if baseURL == "" {
-		baseURL = "https://api.openai.com"
+// profile 返回档案定义，default 档案未在 profiles 中定义时由旧格式生成
+func (f *ConfigFile) profile(name string) (*ProfileConfig, bool) {
+	if profile, ok := f.Profiles[name]; ok && profile != nil {
+		return profile, true
+	}
+	if name == DefaultProfileName && (f.hasLegacy() || len(f.Profiles) == 0) {
+		return f.legacyProfile(), true
+	}
+	return nil, false
+}
+
+// ProfileNames 返回所有档案名，包括旧格式对应的 default 档案
+func (f *ConfigFile) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles)+1)
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	if _, ok := f.Profiles[DefaultProfileName]; !ok {
+		if _, ok := f.profile(DefaultProfileName); ok {
+			names = append(names, DefaultProfileName)
+		}
 	}
+	sort.Strings(names)
+	return names
+}
 
-	apiKey := os.Getenv("OPENAI_API_KEY")
+// SelectProfile 返回要使用的档案名
+//
+// 顺序为：OPENAI_PROFILE 环境变量、default_profile、default 档案（存在时），
+// 只定义了一个档案时使用该档案。
+func (f *ConfigFile) SelectProfile() string {
+	if name := os.Getenv(ProfileEnv); name != "" {
+		return name
+	}
+	if f.DefaultProfile != "" {
+		return f.DefaultProfile
+	}
+	if _, ok := f.profile(DefaultProfileName); ok {
+		return DefaultProfileName
+	}
+	if len(f.Profiles) == 1 {
+		for name := range f.Profiles {
+			return name
+		}
+	}
+	return DefaultProfileName
+}
 
-	config := &Config{
-		BaseURL:    baseURL,
-		APIKey:     apiKey,
-		Timeout:    30 * time.Second,
-		RetryCount: 3,
-		Headers:    make(map[string]string),
+// ResolveProfile 按继承链合并档案，检测循环继承
+func (f *ConfigFile) ResolveProfile(name string) (*ProfileConfig, error) {
+	if name == "" {
+		name = f.SelectProfile()
 	}
 
-	return config
+	var chain []*ProfileConfig
+	var path []string
+	visited := make(map[string]bool)
+	for current := name; current != ""; {
+		if visited[current] {
+			return nil, fmt.Errorf("profile inheritance cycle: %s -> %s", strings.Join(path, " -> "), current)
+		}
+		visited[current] = true
+		path = append(path, current)
+
+		profile, ok := f.profile(current)
+		if !ok {
+			if current == name {
+				return nil, fmt.Errorf("profile %q not found (available: %s)", name, strings.Join(f.ProfileNames(), ", "))
+			}
+			return nil, fmt.Errorf("profile %q inherits unknown profile %q", path[len(path)-2], current)
+		}
+		chain = append(chain, profile)
+		current = profile.Inherits
+	}
+
+	// 从最上层的父档案开始依次覆盖
+	resolved := &ProfileConfig{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		resolved.merge(chain[i])
+	}
+	resolved.Inherits = ""
+	return resolved, nil
+}
+
+// merge 用 other 中已设置的字段覆盖 p，映射按键合并
+func (p *ProfileConfig) merge(other *ProfileConfig) {
+	if other.Provider != "" {
+		p.Provider = other.Provider
+	}
+	if other.BaseURL != "" {
+		p.BaseURL = other.BaseURL
+	}
+	if other.APIKey != "" {
+		p.APIKey = other.APIKey
+	}
+	if other.APIKeys != nil {
+		p.APIKeys = other.APIKeys
+	}
+	if other.KeyStrategy != "" {
+		p.KeyStrategy = other.KeyStrategy
+	}
+	if other.KeyCooldown != "" {
+		p.KeyCooldown = other.KeyCooldown
+	}
+	if other.Endpoints != nil {
+		p.Endpoints = other.Endpoints
+	}
+	if other.EndpointStrategy != "" {
+		p.EndpointStrategy = other.EndpointStrategy
+	}
+	if other.BreakerThreshold != 0 {
+		p.BreakerThreshold = other.BreakerThreshold
+	}
+	if other.BreakerCooldown != "" {
+		p.BreakerCooldown = other.BreakerCooldown
+	}
+	if other.APIVersion != "" {
+		p.APIVersion = other.APIVersion
+	}
+	if other.Timeout != "" {
+		p.Timeout = other.Timeout
+	}
+	if other.RetryCount != nil {
+		p.RetryCount = other.RetryCount
+	}
+	if other.Proxy != "" {
+		p.Proxy = other.Proxy
+	}
+	if other.TLS != nil {
+		p.TLS = other.TLS
+	}
+	if other.Dedupe != nil {
+		p.Dedupe = other.Dedupe
+	}
+	p.Headers = mergeStringMap(p.Headers, other.Headers)
+	p.Models = mergeStringMap(p.Models, other.Models)
+	p.Defaults = p.Defaults.merge(other.Defaults)
+	for model, defaults := range other.ModelDefaults {
+		if p.ModelDefaults == nil {
+			p.ModelDefaults = make(map[string]RequestDefaults)
+		}
+		p.ModelDefaults[model] = p.ModelDefaults[model].merge(defaults)
+	}
+	for model, limit := range other.RateLimits {
+		if p.RateLimits == nil {
+			p.RateLimits = make(map[string]RateLimit)
+		}
+		p.RateLimits[model] = limit
+	}
+	for model, chain := range other.Fallbacks {
+		if p.Fallbacks == nil {
+			p.Fallbacks = make(map[string][]string)
+		}
+		p.Fallbacks[model] = chain
+	}
+	if other.FallbackOn != nil {
+		p.FallbackOn = other.FallbackOn
+	}
+}
+
+// mergeStringMap 返回 base 被 override 覆盖后的新映射
+func mergeStringMap(base, override map[string]string) map[string]string {
+	if len(base) == 0 && len(override) == 0 {
+		return base
+	}
+	merged := copyStringMap(base)
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Profile 返回指定档案的客户端配置，name 为空时按 SelectProfile 选择
+func (f *ConfigFile) Profile(name string) (*Config, error) {
+	profile, err := f.ResolveProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	return profile.Config()
+}
+
+// Config 把档案转为客户端配置，未设置的字段使用 DefaultConfig 中的值
+//
+// 转换和 Config.Validate 发现的问题一起通过 *ConfigError 返回。
+func (p *ProfileConfig) Config() (*Config, error) {
+	var problems []string
+	config := DefaultConfig()
+	if p.BaseURL != "" {
+		config.BaseURL = NormalizeBaseURL(p.BaseURL)
+	}
+	config.APIKey = p.APIKey
+	config.Proxy = p.Proxy
+	config.TLS = p.TLS
+	config.Provider = p.Provider
+	config.APIVersion = p.APIVersion
+	if p.Timeout != "" {
+		timeout, err := time.ParseDuration(p.Timeout)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid timeout %q: %v", p.Timeout, err))
+		} else {
+			config.Timeout = timeout
+		}
+	}
+	config.APIKeys = p.APIKeys
+	config.KeyStrategy = p.KeyStrategy
+	if p.KeyCooldown != "" {
+		cooldown, err := time.ParseDuration(p.KeyCooldown)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid key_cooldown %q: %v", p.KeyCooldown, err))
+		} else {
+			config.KeyCooldown = cooldown
+		}
+	}
+	config.Endpoints = p.Endpoints
+	config.EndpointStrategy = p.EndpointStrategy
+	config.BreakerThreshold = p.BreakerThreshold
+	if p.BreakerCooldown != "" {
+		cooldown, err := time.ParseDuration(p.BreakerCooldown)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid breaker_cooldown %q: %v", p.BreakerCooldown, err))
+		} else {
+			config.BreakerCooldown = cooldown
+		}
+	}
+	if p.RetryCount != nil {
+		config.RetryCount = *p.RetryCount
+	}
+	if p.Dedupe != nil {
+		config.Dedupe = *p.Dedupe
+	}
+	config.WithHeaders(p.Headers)
+	for role, model := range p.Models {
+		config.WithModel(role, model)
+	}
+	config.Defaults = p.Defaults
+	for model, defaults := range p.ModelDefaults {
+		config.WithModelDefaults(model, defaults)
+	}
+	for model, limit := range p.RateLimits {
+		config.WithRateLimit(model, limit.RequestsPerMinute, limit.TokensPerMinute)
+	}
+	for model, chain := range p.Fallbacks {
+		config.WithFallbacks(model, chain...)
+	}
+	config.FallbackOn = p.FallbackOn
+
+	if err := config.Validate(); err != nil {
+		problems = append(problems, err.(*ConfigError).Problems...)
+	}
+	if len(problems) > 0 {
+		return nil, &ConfigError{Problems: problems}
+	}
+	return config, nil
 }
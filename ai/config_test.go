@@ -0,0 +1,469 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConfigModelDefaults 测试模型角色解析和默认参数填充
+func TestConfigModelDefaults(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	data := `{
+		"openai": {"base_url": "http://localhost", "api_key": "k", "timeout": "10s"},
+		"models": {"chat": "gpt-4.1-mini", "vision": "gpt-4o"},
+		"defaults": {"temperature": 0.7, "max_tokens": 1000},
+		"model_defaults": {
+			"vision": {"max_tokens": 4000},
+			"gpt-4o": {"temperature": 0}
+		}
+	}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, _, err := LoadConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if config.ResolveModel("vision") != "gpt-4o" || config.ResolveModel("") != "gpt-4.1-mini" || config.ResolveModel("o3") != "o3" {
+		t.Errorf("模型角色解析错误: %v", config.Models)
+	}
+	if model := NewConfig("u", "k").ResolveModel(""); model != "" {
+		t.Errorf("没有配置chat角色时空模型不应被解析为%q", model)
+	}
+	defaults := config.DefaultsFor("vision", "gpt-4o")
+	if *defaults.Temperature != 0 || *defaults.MaxTokens != 4000 || defaults.TopP != nil {
+		t.Errorf("按模型覆盖的默认参数错误: %+v", defaults)
+	}
+
+	client, requests := newTestServer(t, "ok")
+	client.GetConfig().Models = config.Models
+	client.GetConfig().Defaults = config.Defaults
+	client.GetConfig().ModelDefaults = config.ModelDefaults
+
+	req := NewRequest("vision").Messages(NewMessageBuilder().User("看图").Build()).Build()
+	if _, err := client.ChatCompletion(context.Background(), req); err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	explicit := NewRequest("").Messages(NewMessageBuilder().User("你好").Build()).Temperature(1.2).Build()
+	if _, err := client.ChatCompletion(context.Background(), explicit); err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+
+	first, second := (*requests)[0], (*requests)[1]
+	if first["model"] != "gpt-4o" || first["temperature"] != 0.0 || first["max_tokens"] != 4000.0 {
+		t.Errorf("vision请求应该使用解析后的模型和覆盖的默认值: %v", first)
+	}
+	if second["model"] != "gpt-4.1-mini" || second["temperature"] != 1.2 || second["max_tokens"] != 1000.0 {
+		t.Errorf("请求中显式设置的参数不应该被默认值覆盖: %v", second)
+	}
+	if req.Model != "vision" || req.Temperature != nil || explicit.MaxTokens != nil {
+		t.Error("调用方的请求不应该被修改")
+	}
+
+	t.Logf("模型默认参数测试通过")
+}
+
+// TestConfigProfiles 测试命名档案、继承、选择和客户端集合
+func TestConfigProfiles(t *testing.T) {
+	var azureReq *http.Request
+	azure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		azureReq = r
+		json.NewEncoder(w).Encode(ChatResponse{Choices: []Choice{{Message: &Message{Role: "assistant", Content: TextContent("ok")}}}})
+	}))
+	defer azure.Close()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+		"openai": {"base_url": "https://prod.example.com", "api_key": "prod-key", "timeout": "60s", "headers": {"X-Team": "ai"}},
+		"models": {"chat": "gpt-4.1"},
+		"profiles": {
+			"staging": {"inherits": "default", "base_url": "https://staging.example.com", "api_key": "staging-key", "headers": {"X-Env": "staging"}},
+			"azure": {"provider": "azure", "base_url": "` + azure.URL + `", "api_key": "azure-key", "api_version": "2024-10-21", "models": {"chat": "my-deployment"}},
+			"loop-a": {"inherits": "loop-b"},
+			"loop-b": {"inherits": "loop-a"},
+			"orphan": {"inherits": "missing"}
+		}
+	}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := ReadConfigFile(path)
+	if err != nil {
+		t.Fatalf("读取配置失败: %v", err)
+	}
+	if want := []string{"azure", "default", "loop-a", "loop-b", "orphan", "staging"}; !reflect.DeepEqual(file.ProfileNames(), want) {
+		t.Errorf("档案列表错误: %v", file.ProfileNames())
+	}
+
+	staging, err := file.Profile("staging")
+	if err != nil {
+		t.Fatalf("加载staging失败: %v", err)
+	}
+	if staging.BaseURL != "https://staging.example.com" || staging.APIKey != "staging-key" || staging.Timeout.Seconds() != 60 ||
+		staging.Headers["X-Team"] != "ai" || staging.Headers["X-Env"] != "staging" || staging.ResolveModel("chat") != "gpt-4.1" {
+		t.Errorf("继承的配置错误: %+v", staging)
+	}
+
+	if _, err := file.Profile("loop-a"); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("循环继承应该报错，实际%v", err)
+	}
+	if _, err := file.Profile("orphan"); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("继承不存在的档案应该报错，实际%v", err)
+	}
+	if _, err := file.Profile("nope"); err == nil {
+		t.Error("不存在的档案应该报错")
+	}
+
+	if file.SelectProfile() != DefaultProfileName {
+		t.Errorf("默认应该选择default档案，实际%s", file.SelectProfile())
+	}
+	t.Setenv(ProfileEnv, "staging")
+	config, _, err := LoadConfigFromFile(path)
+	if err != nil || config.BaseURL != "https://staging.example.com" {
+		t.Errorf("环境变量应该选择staging档案: %v %v", config, err)
+	}
+
+	set := NewClientSet(file)
+	client, err := set.Client("azure")
+	if err != nil {
+		t.Fatalf("创建azure客户端失败: %v", err)
+	}
+	if again, _ := set.Client("azure"); again != client {
+		t.Error("同一档案应该复用客户端")
+	}
+	if def, _ := set.Default(); def == nil || def.GetConfig().BaseURL != "https://staging.example.com" {
+		t.Error("默认客户端应该遵循环境变量选择")
+	}
+
+	req := NewRequest("").Messages(NewMessageBuilder().User("hi").Build()).Build()
+	if _, err := client.ChatCompletion(context.Background(), req); err != nil {
+		t.Fatalf("azure请求失败: %v", err)
+	}
+	if azureReq.URL.Path != "/openai/deployments/my-deployment/chat/completions" || azureReq.URL.Query().Get("api-version") != "2024-10-21" ||
+		azureReq.Header.Get("api-key") != "azure-key" || azureReq.Header.Get("Authorization") != "" {
+		t.Errorf("azure请求地址或认证头错误: %s %v", azureReq.URL, azureReq.Header)
+	}
+
+	t.Logf("配置档案测试通过")
+}
+
+// TestConfigInterpolation 测试环境变量、密钥文件和 YAML/TOML 配置文件
+func TestConfigInterpolation(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "openai.key"), []byte("sk-from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GATEWAY_HOST", "gw.example.com")
+	t.Setenv("GATEWAY_RETRIES", "5")
+	t.Setenv("EMPTY_VAR", "")
+
+	files := map[string]string{
+		"config.json": `{
+			"openai": {
+				"base_url": "https://${GATEWAY_HOST}",
+				"api_key": "file:openai.key",
+				"timeout": "${GATEWAY_TIMEOUT:-45s}",
+				"retry_count": "${GATEWAY_RETRIES}",
+				"headers": {"X-Literal": "$${NOT_A_VAR}", "X-Empty": "${EMPTY_VAR}"}
+			},
+			"defaults": {"temperature": "${TEMPERATURE:-0.5}"}
+		}`,
+		"config.yaml": `
+openai:
+  base_url: https://${GATEWAY_HOST}
+  api_key: file:openai.key
+  timeout: ${GATEWAY_TIMEOUT:-45s}
+  retry_count: ${GATEWAY_RETRIES}
+  headers:
+    X-Literal: $${NOT_A_VAR}
+    X-Empty: ${EMPTY_VAR}
+defaults:
+  temperature: ${TEMPERATURE:-0.5}
+`,
+		"config.toml": `
+[openai]
+base_url = "https://${GATEWAY_HOST}"
+api_key = "file:openai.key"
+timeout = "${GATEWAY_TIMEOUT:-45s}"
+retry_count = "${GATEWAY_RETRIES}"
+headers = { "X-Literal" = "$${NOT_A_VAR}", X-Empty = "${EMPTY_VAR}" }
+
+[defaults]
+temperature = "${TEMPERATURE:-0.5}" # 字符串形式的数字
+`,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		config, _, err := LoadConfigFromFile(path)
+		if err != nil {
+			t.Fatalf("%s: 加载失败: %v", name, err)
+		}
+		if config.BaseURL != "https://gw.example.com" || config.APIKey != "sk-from-file" || config.Timeout.Seconds() != 45 ||
+			config.RetryCount != 5 || config.Headers["X-Literal"] != "${NOT_A_VAR}" || config.Headers["X-Empty"] != "" ||
+			config.Defaults.Temperature == nil || *config.Defaults.Temperature != 0.5 {
+			t.Errorf("%s: 配置展开错误: %+v", name, config)
+		}
+	}
+
+	missing := filepath.Join(dir, "missing.json")
+	os.WriteFile(missing, []byte(`{"openai": {"api_key": "${MISSING_KEY}", "base_url": "file:nope"}}`), 0o644)
+	_, _, err := LoadConfigFromFile(missing)
+	if err == nil || !strings.Contains(err.Error(), "MISSING_KEY") || !strings.Contains(err.Error(), "secret file") {
+		t.Errorf("应该同时报告未设置的变量和不存在的文件，实际%v", err)
+	}
+
+	tables, err := parseTOML([]byte(`
+title = 'literal \n'
+[profiles.staging]
+inherits = "default"
+models.chat = "gpt-4.1"
+stop = [
+  "a", # 注释
+  "b",
+]
+[[items]]
+n = 1_000
+[[items]]
+n = 2
+text = """
+多行\
+  拼接"""
+`))
+	if err != nil {
+		t.Fatalf("TOML解析失败: %v", err)
+	}
+	want := map[string]interface{}{
+		"title": `literal \n`,
+		"profiles": map[string]interface{}{"staging": map[string]interface{}{
+			"inherits": "default",
+			"models":   map[string]interface{}{"chat": "gpt-4.1"},
+			"stop":     []interface{}{"a", "b"},
+		}},
+		"items": []interface{}{
+			map[string]interface{}{"n": 1000},
+			map[string]interface{}{"n": 2, "text": "多行拼接"},
+		},
+	}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("TOML解析结果错误\n期望: %#v\n实际: %#v", want, tables)
+	}
+
+	t.Logf("配置插值测试通过")
+}
+
+// TestConfigFromEnv 测试从环境变量加载全部配置字段
+func TestConfigFromEnv(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	os.WriteFile(keyFile, []byte("sk-secret\n"), 0o600)
+
+	t.Setenv("AI_BASE_URL", "https://gw.example.com")
+	t.Setenv("AI_API_KEY_FILE", keyFile)
+	t.Setenv("AI_TIMEOUT", "90s")
+	t.Setenv("AI_RETRY_COUNT", "1")
+	t.Setenv("AI_PROXY", "http://proxy:8080")
+	t.Setenv("AI_HEADERS", "X-Team=ai, X-Env: prod")
+	t.Setenv("AI_MODELS", "chat=gpt-4.1,vision=gpt-4o")
+	t.Setenv("AI_TEMPERATURE", "0.3")
+	t.Setenv("AI_MAX_TOKENS", "512")
+
+	config, err := ConfigFromEnv("AI")
+	if err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	if config.BaseURL != "https://gw.example.com" || config.APIKey != "sk-secret" || config.Timeout.Seconds() != 90 ||
+		config.RetryCount != 1 || config.Proxy != "http://proxy:8080" ||
+		config.Headers["X-Team"] != "ai" || config.Headers["X-Env"] != "prod" ||
+		config.ResolveModel("vision") != "gpt-4o" || *config.Defaults.Temperature != 0.3 || *config.Defaults.MaxTokens != 512 {
+		t.Errorf("环境变量配置错误: %+v", config)
+	}
+
+	t.Setenv("AI_TIMEOUT", "soon")
+	t.Setenv("AI_RETRY_COUNT", "many")
+	if _, err := ConfigFromEnv("AI"); err == nil || !strings.Contains(err.Error(), "AI_TIMEOUT") || !strings.Contains(err.Error(), "AI_RETRY_COUNT") {
+		t.Errorf("无效的值应该全部报告，实际%v", err)
+	}
+
+	// 旧接口保留有效的值，并记录无效的值
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	t.Setenv(EnvPrefix+"_BASE_URL", "https://env.example.com")
+	t.Setenv(EnvPrefix+"_TIMEOUT", "soon")
+	if config := LoadConfigFromEnv(); config.BaseURL != "https://env.example.com" || !strings.Contains(logged.String(), EnvPrefix+"_TIMEOUT") {
+		t.Errorf("LoadConfigFromEnv应该记录无效的值: %q %s", logged.String(), config.BaseURL)
+	}
+
+	t.Logf("环境变量配置测试通过")
+}
+
+// TestConfigHotReload 测试配置替换、订阅通知和配置文件重新加载
+func TestConfigHotReload(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	write := func(key string) {
+		data := `{"openai": {"base_url": "` + server.URL + `", "api_key": "` + key + `"}}`
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("key-1")
+
+	client := NewClient(NewConfig(server.URL, "initial"))
+	var changes []string
+	unsubscribe := client.OnConfigChange(func(old, new *Config) {
+		changes = append(changes, old.APIKey+"->"+new.APIKey)
+	})
+
+	watcher, err := client.WatchConfig(path, ConfigWatchOptions{Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("监视配置文件失败: %v", err)
+	}
+	defer watcher.Stop()
+	if client.GetConfig().APIKey != "key-1" {
+		t.Errorf("首次加载后API密钥应为key-1，实际为%s", client.GetConfig().APIKey)
+	}
+
+	// 内容未变化时不重新加载
+	if reloaded, err := watcher.Check(); err != nil || reloaded {
+		t.Errorf("内容未变化不应重新加载: %v %v", reloaded, err)
+	}
+
+	// 并发请求期间替换配置
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := &ChatRequest{Model: "m", Messages: []Message{{Role: "user", Content: TextContent("hi")}}}
+			if _, err := client.ChatCompletion(context.Background(), req); err != nil {
+				t.Errorf("请求失败: %v", err)
+			}
+		}()
+	}
+	write("key-2-longer")
+	if reloaded, err := watcher.Check(); err != nil || !reloaded {
+		t.Errorf("内容变化后应重新加载: %v %v", reloaded, err)
+	}
+	wg.Wait()
+	if client.GetConfig().APIKey != "key-2-longer" {
+		t.Errorf("重新加载后API密钥应为key-2-longer，实际为%s", client.GetConfig().APIKey)
+	}
+
+	// 无效的配置不会替换当前配置
+	if err := os.WriteFile(path, []byte(`{"openai": {"proxy": "://bad"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := watcher.Check(); err == nil {
+		t.Errorf("无效的代理应该返回错误")
+	}
+	if client.GetConfig().APIKey != "key-2-longer" {
+		t.Errorf("无效配置不应替换当前配置")
+	}
+
+	want := []string{"initial->key-1", "key-1->key-2-longer"}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("订阅通知应为%v，实际为%v", want, changes)
+	}
+
+	unsubscribe()
+	if err := client.SetConfig(NewConfig(server.URL, "key-3")); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Errorf("取消订阅后不应再收到通知")
+	}
+
+	t.Logf("配置热加载测试通过")
+}
+
+// TestConfigValidate 测试配置校验、地址规范化和未知键提示
+func TestConfigValidate(t *testing.T) {
+	for input, want := range map[string]string{
+		"https://api.openai.com":        "https://api.openai.com",
+		"https://api.openai.com/":       "https://api.openai.com",
+		" https://api.openai.com/v1/ ":  "https://api.openai.com",
+		"https://gw.example.com/ai/v1":  "https://gw.example.com/ai",
+		"https://gw.example.com/v1beta": "https://gw.example.com/v1beta",
+	} {
+		if got := NormalizeBaseURL(input); got != want {
+			t.Errorf("NormalizeBaseURL(%q) = %q，期望 %q", input, got, want)
+		}
+	}
+	config := NewConfig("https://api.example.com/v1/", "k")
+	if got := config.chatURL(config.BaseURL, "m"); got != "https://api.example.com/v1/chat/completions" {
+		t.Errorf("请求地址错误: %s", got)
+	}
+
+	config = NewConfig("", "").WithTimeout(-time.Second).WithProxy("://bad")
+	config.Provider = ProviderAzure
+	config.Defaults.Temperature = &[]float64{3}[0]
+	err := config.Validate()
+	configErr, ok := err.(*ConfigError)
+	if !ok || len(configErr.Problems) != 6 {
+		t.Fatalf("应该一次报告全部问题，实际%v", err)
+	}
+	if err := NewConfig("https://api.example.com", "").WithHeaders(map[string]string{"Authorization": "Bearer x"}).Validate(); err != nil {
+		t.Errorf("自定义认证头可以代替API密钥: %v", err)
+	}
+
+	client := NewClient(NewConfig("https://api.example.com", "k"))
+	if err := client.SetConfig(NewConfig("", "")); err == nil || client.GetConfig().APIKey != "k" {
+		t.Errorf("无效配置不应替换当前配置: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+		"openai": {"base_url": "https://api.example.com/", "api_key": "", "timeout": "30 seconds", "retry_cout": 2},
+		"modles": {"chat": "gpt-4.1"},
+		"profiles": {"dev": {"baseurl": "http://localhost", "api_key": "k", "headers": {"X-Anything": "ok"}}}
+	}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := ReadConfigFile(path)
+	if err != nil {
+		t.Fatalf("读取配置失败: %v", err)
+	}
+	wantWarnings := []string{
+		`unknown key "modles" (did you mean "models"?)`,
+		`unknown key "openai.retry_cout" (did you mean "retry_count"?)`,
+		`unknown key "profiles.dev.baseurl" (did you mean "base_url"?)`,
+	}
+	if !reflect.DeepEqual(file.Warnings, wantWarnings) {
+		t.Errorf("未知键提示错误:\n%q", file.Warnings)
+	}
+
+	_, err = file.Profile(DefaultProfileName)
+	if err == nil || !strings.Contains(err.Error(), "invalid timeout") || !strings.Contains(err.Error(), "api_key is required") {
+		t.Errorf("应该同时报告无效的超时时间和缺少的API密钥，实际%v", err)
+	}
+
+	t.Logf("配置校验测试通过")
+}
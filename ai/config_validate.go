@@ -0,0 +1,301 @@
+package ai
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ConfigError 配置无效，Problems 包含发现的全部问题
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid config: %s", strings.Join(e.Problems, "; "))
+}
+
+// NormalizeBaseURL 规范化基础地址：去掉首尾空白、末尾的斜杠和 /v1
+//
+// 请求路径会自动拼接 /v1，因此 https://api.openai.com/v1/ 与 https://api.openai.com 等价。
+func NormalizeBaseURL(baseURL string) string {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if trimmed, ok := strings.CutSuffix(baseURL, "/v1"); ok {
+		baseURL = strings.TrimRight(trimmed, "/")
+	}
+	return baseURL
+}
+
+// Validate 检查配置，返回包含全部问题的 *ConfigError，配置有效时返回 nil
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if strings.TrimSpace(c.BaseURL) == "" {
+		if len(c.Endpoints) == 0 {
+			add("base_url is required")
+		}
+	} else if u, err := url.Parse(NormalizeBaseURL(c.BaseURL)); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		add("base_url %q must be an absolute http or https URL", c.BaseURL)
+	}
+	for i, e := range c.Endpoints {
+		if u, err := url.Parse(NormalizeBaseURL(e.URL)); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("endpoints[%d] %q must be an absolute http or https URL", i, e.URL)
+		}
+		if e.Weight < 0 {
+			add("endpoints[%d].weight must not be negative", i)
+		}
+	}
+	switch c.EndpointStrategy {
+	case "", EndpointStrategyPriority, EndpointStrategyWeighted:
+	default:
+		add("endpoint_strategy must be priority or weighted")
+	}
+	if c.BreakerThreshold < 0 {
+		add("breaker_threshold must not be negative")
+	}
+	if c.BreakerCooldown < 0 {
+		add("breaker_cooldown must not be negative")
+	}
+	if c.APIKey == "" && len(c.APIKeys) == 0 && !c.hasAuthHeader() {
+		add("api_key is required")
+	}
+	for i, key := range c.APIKeys {
+		if key.Key == "" {
+			add("api_keys[%d] is empty", i)
+		}
+		if key.Weight < 0 {
+			add("api_keys[%d].weight must not be negative", i)
+		}
+	}
+	switch c.KeyStrategy {
+	case "", KeyStrategyRoundRobin, KeyStrategyWeighted, KeyStrategyLeastUsed:
+	default:
+		add("key_strategy must be round_robin, weighted or least_used")
+	}
+	if c.KeyCooldown < 0 {
+		add("key_cooldown must not be negative")
+	}
+	if c.Timeout < 0 {
+		add("timeout must not be negative")
+	}
+	if c.RetryCount < 0 {
+		add("retry_count must not be negative")
+	}
+
+	switch c.Provider {
+	case "", ProviderOpenAI:
+	case ProviderAzure:
+		if c.APIVersion == "" {
+			add("provider azure requires api_version")
+		}
+	default:
+		add("unknown provider %q", c.Provider)
+	}
+
+	if c.Proxy != "" {
+		if u, err := url.Parse(c.Proxy); err != nil || u.Host == "" {
+			add("invalid proxy %q", c.Proxy)
+		}
+	}
+	if c.HTTPClient != nil && c.Transport != nil {
+		add("HTTPClient and Transport cannot both be set")
+	}
+	if c.customTransport() != nil && (c.Proxy != "" || c.TLS != nil) {
+		add("proxy and tls cannot be used with a custom HTTPClient or Transport")
+	}
+	if c.TLS != nil {
+		if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+			add("tls.cert_file and tls.key_file must be set together")
+		} else if _, err := (&Config{TLS: c.TLS}).buildTransport(); err != nil {
+			add("tls: %v", err)
+		}
+	}
+
+	for role, model := range c.Models {
+		if model == "" {
+			add("models.%s is empty", role)
+		}
+	}
+	for _, model := range sortedKeys(c.RateLimits) {
+		if limit := c.RateLimits[model]; limit.RequestsPerMinute < 0 || limit.TokensPerMinute < 0 {
+			add("rate_limits.%s must not be negative", model)
+		}
+	}
+	for _, model := range sortedKeys(c.Fallbacks) {
+		for i, fallback := range c.Fallbacks[model] {
+			if fallback == "" {
+				add("fallbacks.%s[%d] is empty", model, i)
+			}
+		}
+	}
+	if c.CacheTTL < 0 {
+		add("cache_ttl must not be negative")
+	}
+	for _, kind := range c.FallbackOn {
+		switch kind {
+		case ErrorKindRateLimit, ErrorKindServer, ErrorKindTimeout, ErrorKindContextLength,
+			ErrorKindAuth, ErrorKindInvalidRequest, ErrorKindUnknown:
+		default:
+			add("unknown fallback_on error kind %q", kind)
+		}
+	}
+	problems = append(problems, c.Defaults.problems("defaults")...)
+	for _, name := range sortedKeys(c.ModelDefaults) {
+		problems = append(problems, c.ModelDefaults[name].problems("model_defaults."+name)...)
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// hasAuthHeader 判断自定义头部中是否已经包含认证信息
+func (c *Config) hasAuthHeader() bool {
+	for k, v := range c.Headers {
+		if v != "" && (strings.EqualFold(k, "Authorization") || strings.EqualFold(k, "api-key")) {
+			return true
+		}
+	}
+	return false
+}
+
+// problems 检查默认参数的取值范围，path 作为错误信息的前缀
+func (d RequestDefaults) problems(path string) []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, path+"."+fmt.Sprintf(format, args...))
+	}
+
+	if d.Temperature != nil && (*d.Temperature < 0 || *d.Temperature > 2) {
+		add("temperature must be between 0 and 2")
+	}
+	if d.TopP != nil && (*d.TopP < 0 || *d.TopP > 1) {
+		add("top_p must be between 0 and 1")
+	}
+	if d.MaxTokens != nil && *d.MaxTokens < 1 {
+		add("max_tokens must be positive")
+	}
+	if d.PresencePenalty != nil && (*d.PresencePenalty < -2 || *d.PresencePenalty > 2) {
+		add("presence_penalty must be between -2 and 2")
+	}
+	if d.FrequencyPenalty != nil && (*d.FrequencyPenalty < -2 || *d.FrequencyPenalty > 2) {
+		add("frequency_penalty must be between -2 and 2")
+	}
+	switch d.ReasoningEffort {
+	case "", ReasoningEffortMinimal, ReasoningEffortLow, ReasoningEffortMedium, ReasoningEffortHigh:
+	default:
+		add("reasoning_effort must be minimal, low, medium or high")
+	}
+	return problems
+}
+
+// unknownConfigKeys 对照目标类型的 json 标签查找未知的键，返回带修改建议的提示
+//
+// 键名不区分大小写地匹配，与 encoding/json 的行为一致；值为任意键的映射（如 headers）不检查键名。
+func unknownConfigKeys(value interface{}, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var warnings []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Map:
+			for _, key := range sortedKeys(v) {
+				warnings = append(warnings, unknownConfigKeys(v[key], t.Elem(), joinConfigPath(path, key))...)
+			}
+		case reflect.Struct:
+			fields := configFields(t)
+			names := make([]string, 0, len(fields))
+			for name := range fields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, key := range sortedKeys(v) {
+				field, ok := fields[strings.ToLower(key)]
+				if !ok {
+					warning := fmt.Sprintf("unknown key %q", joinConfigPath(path, key))
+					if suggestion := suggestKey(key, names); suggestion != "" {
+						warning += fmt.Sprintf(" (did you mean %q?)", suggestion)
+					}
+					warnings = append(warnings, warning)
+					continue
+				}
+				warnings = append(warnings, unknownConfigKeys(v[key], field.Type, joinConfigPath(path, key))...)
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, child := range v {
+				warnings = append(warnings, unknownConfigKeys(child, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+	return warnings
+}
+
+// configFields 返回结构体按小写 json 名索引的字段，忽略 json:"-" 的字段
+func configFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = field
+	}
+	return fields
+}
+
+// suggestKey 返回与 key 编辑距离最近的候选键，距离过大时返回空字符串
+func suggestKey(key string, candidates []string) string {
+	key = strings.ToLower(key)
+	best, bestDistance := "", len(key)/2+1
+	if bestDistance > 3 {
+		bestDistance = 3
+	}
+	for _, candidate := range candidates {
+		// 忽略分隔符差异，例如 baseurl、base-url 与 base_url
+		if strings.ReplaceAll(strings.ReplaceAll(key, "-", "_"), "_", "") == strings.ReplaceAll(candidate, "_", "") {
+			return candidate
+		}
+		if d := editDistance(key, candidate); d <= bestDistance && (best == "" || d < editDistance(key, best)) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance 计算 Levenshtein 编辑距离
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
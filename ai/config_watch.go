@@ -0,0 +1,125 @@
+package ai
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultConfigWatchInterval 配置文件的默认轮询间隔
+const DefaultConfigWatchInterval = 2 * time.Second
+
+// ConfigWatchOptions 配置文件监视选项
+type ConfigWatchOptions struct {
+	// Profile 要加载的档案，为空时按 SelectProfile 选择
+	Profile string
+	// Interval 轮询间隔，为 0 时使用 DefaultConfigWatchInterval
+	Interval time.Duration
+	// OnError 重新加载失败时调用，当前配置保持不变
+	OnError func(err error)
+}
+
+// ConfigWatcher 轮询配置文件，内容变化时重新加载并替换客户端配置
+type ConfigWatcher struct {
+	client  *Client
+	path    string
+	options ConfigWatchOptions
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	sum     [sha256.Size]byte
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// WatchConfig 从配置文件加载配置并应用到客户端，之后在后台监视文件变化
+//
+// 首次加载失败时返回错误且不启动监视。文件变化后的配置无效时不会替换，
+// 错误交给 OnError。使用 Stop 停止监视。
+func (c *Client) WatchConfig(path string, options ConfigWatchOptions) (*ConfigWatcher, error) {
+	if options.Interval <= 0 {
+		options.Interval = DefaultConfigWatchInterval
+	}
+
+	w := &ConfigWatcher{
+		client:  c,
+		path:    path,
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if _, err := w.Check(); err != nil {
+		return nil, err
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// run 按间隔轮询，直到 Stop
+func (w *ConfigWatcher) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if _, err := w.Check(); err != nil && w.options.OnError != nil {
+				w.options.OnError(err)
+			}
+		}
+	}
+}
+
+// Check 立即检查文件，内容有变化时重新加载，返回是否替换了配置
+//
+// 先比较修改时间和大小，变化时再比较内容摘要，只改动修改时间不会触发重新加载。
+func (w *ConfigWatcher) Check() (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(data)
+	if bytes.Equal(sum[:], w.sum[:]) {
+		w.modTime, w.size = info.ModTime(), info.Size()
+		return false, nil
+	}
+
+	// 无效的内容也记录下来，同一错误只报告一次，文件再次变化时重试
+	w.modTime, w.size, w.sum = info.ModTime(), info.Size(), sum
+
+	config, _, err := LoadConfigProfile(w.path, w.options.Profile)
+	if err != nil {
+		return false, fmt.Errorf("reload %s: %w", w.path, err)
+	}
+	if err := w.client.SetConfig(config); err != nil {
+		return false, fmt.Errorf("reload %s: %w", w.path, err)
+	}
+	return true, nil
+}
+
+// Stop 停止监视并等待后台轮询退出，可重复调用
+func (w *ConfigWatcher) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.done
+}
@@ -0,0 +1,169 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// 内容片段类型
+const (
+	ContentTypeText       = "text"
+	ContentTypeImageURL   = "image_url"
+	ContentTypeInputAudio = "input_audio"
+	ContentTypeFile       = "file"
+	ContentTypeRefusal    = "refusal"
+)
+
+// 图片细节等级
+const (
+	ImageDetailAuto = "auto"
+	ImageDetailLow  = "low"
+	ImageDetailHigh = "high"
+)
+
+// MessageContent 消息内容，可以是纯文本或多模态内容片段
+//
+// 序列化时有片段则输出数组，否则输出字符串；完全为空的零值输出 null，
+// 用于只包含工具调用的助手消息。
+type MessageContent struct {
+	Text  string
+	Parts []ContentPart
+
+	// explicit 标记空字符串是被显式设置的，序列化为 "" 而不是 null
+	explicit bool
+}
+
+// ContentPart 多模态内容片段
+type ContentPart struct {
+	Type       string      `json:"type"`
+	Text       string      `json:"text,omitempty"`
+	ImageURL   *ImageURL   `json:"image_url,omitempty"`
+	InputAudio *InputAudio `json:"input_audio,omitempty"`
+	File       *FileData   `json:"file,omitempty"`
+	Refusal    string      `json:"refusal,omitempty"`
+}
+
+// ImageURL 图片地址，可以是网络地址或 data URL
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// InputAudio 输入音频，Data 为 base64 编码的音频数据
+type InputAudio struct {
+	Data   string `json:"data"`
+	Format string `json:"format"`
+}
+
+// FileData 文件内容，FileData 为 data URL，或通过 FileID 引用已上传的文件
+type FileData struct {
+	FileID   string `json:"file_id,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+// TextContent 创建纯文本内容
+func TextContent(text string) MessageContent {
+	return MessageContent{Text: text, explicit: true}
+}
+
+// PartsContent 创建多模态内容
+func PartsContent(parts ...ContentPart) MessageContent {
+	if parts == nil {
+		parts = []ContentPart{}
+	}
+	return MessageContent{Parts: parts}
+}
+
+// TextPart 创建文本片段
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: ContentTypeText, Text: text}
+}
+
+// ImagePart 创建图片片段，detail 可为空
+func ImagePart(url, detail string) ContentPart {
+	return ContentPart{Type: ContentTypeImageURL, ImageURL: &ImageURL{URL: url, Detail: detail}}
+}
+
+// AudioPart 创建输入音频片段
+func AudioPart(data, format string) ContentPart {
+	return ContentPart{Type: ContentTypeInputAudio, InputAudio: &InputAudio{Data: data, Format: format}}
+}
+
+// FilePart 创建文件片段
+func FilePart(filename, fileData string) ContentPart {
+	return ContentPart{Type: ContentTypeFile, File: &FileData{Filename: filename, FileData: fileData}}
+}
+
+// FileIDPart 创建引用已上传文件的片段
+func FileIDPart(fileID string) ContentPart {
+	return ContentPart{Type: ContentTypeFile, File: &FileData{FileID: fileID}}
+}
+
+// IsEmpty 判断内容是否为空
+func (c MessageContent) IsEmpty() bool {
+	return c.Text == "" && len(c.Parts) == 0
+}
+
+// IsMultiPart 判断是否为多模态内容
+func (c MessageContent) IsMultiPart() bool {
+	return c.Parts != nil
+}
+
+// TextParts 返回所有文本片段，纯文本内容返回其自身
+func (c MessageContent) TextParts() []string {
+	if c.Parts == nil {
+		if c.Text == "" {
+			return nil
+		}
+		return []string{c.Text}
+	}
+
+	var texts []string
+	for _, part := range c.Parts {
+		if part.Type == ContentTypeText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return texts
+}
+
+// MarshalJSON 序列化为字符串、数组或 null
+func (c MessageContent) MarshalJSON() ([]byte, error) {
+	if c.Parts != nil {
+		return json.Marshal(c.Parts)
+	}
+	if c.Text == "" && !c.explicit {
+		return []byte("null"), nil
+	}
+	return json.Marshal(c.Text)
+}
+
+// UnmarshalJSON 同时接受字符串、数组和 null
+func (c *MessageContent) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	*c = MessageContent{}
+
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	switch data[0] {
+	case '"':
+		c.explicit = true
+		return json.Unmarshal(data, &c.Text)
+	case '[':
+		var parts []ContentPart
+		if err := json.Unmarshal(data, &parts); err != nil {
+			return fmt.Errorf("invalid content parts: %w", err)
+		}
+		if parts == nil {
+			parts = []ContentPart{}
+		}
+		c.Parts = parts
+		return nil
+	}
+
+	return fmt.Errorf("content must be a string, an array of parts or null, got %s", truncateForError(string(data)))
+}
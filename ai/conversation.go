@@ -0,0 +1,365 @@
+package ai
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// TokenCounter 计算消息列表占用的令牌数
+type TokenCounter func(messages []Message) int
+
+// Conversation 托管历史记录的多轮对话，可安全地被多个 goroutine 并发读取
+type Conversation struct {
+	mu        sync.RWMutex
+	id        string
+	parentID  string
+	forkedAt  int
+	system    string
+	messages  []Message
+	usage     Usage
+	metadata  map[string]string
+	createdAt time.Time
+
+	budget  int
+	counter TokenCounter
+
+	// version 在历史被删除或替换（而不是追加）时递增，用于检测并发修改
+	version     uint64
+	compactions []CompactionRecord
+	// dropped 被 Trim、Clear 和压缩从历史开头删除的消息数，不计摘要消息
+	dropped int
+}
+
+// NewConversation 创建对话，system 为空时不发送系统消息
+func NewConversation(system string) *Conversation {
+	return &Conversation{
+		id:        newConversationID(),
+		system:    system,
+		messages:  make([]Message, 0),
+		metadata:  make(map[string]string),
+		createdAt: time.Now(),
+		counter:   EstimateTokens,
+	}
+}
+
+// newConversationID 生成随机的对话 ID
+func newConversationID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "conv_" + hex.EncodeToString(b)
+}
+
+// ID 返回对话 ID
+func (c *Conversation) ID() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.id
+}
+
+// SetID 设置对话 ID
+func (c *Conversation) SetID(id string) *Conversation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.id = id
+	return c
+}
+
+// SetMetadata 设置元数据
+func (c *Conversation) SetMetadata(key, value string) *Conversation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.metadata[key] = value
+	return c
+}
+
+// Metadata 返回元数据副本
+func (c *Conversation) Metadata() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return copyStringMap(c.metadata)
+}
+
+// SetSystem 设置系统提示词
+func (c *Conversation) SetSystem(system string) *Conversation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.system = system
+	return c
+}
+
+// System 返回系统提示词
+func (c *Conversation) System() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.system
+}
+
+// SetTokenBudget 设置发送前的令牌预算，maxTokens 为 0 表示不限制
+//
+// counter 为空时使用 EstimateTokens 粗略估算；需要精确计数时传入 TokenCounterFor(model) 返回的计数器。
+func (c *Conversation) SetTokenBudget(maxTokens int, counter TokenCounter) *Conversation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.budget = maxTokens
+	if counter != nil {
+		c.counter = counter
+	}
+	return c
+}
+
+// AddUser 添加用户消息
+func (c *Conversation) AddUser(content string) *Conversation {
+	return c.AddMessage(Message{Role: "user", Content: TextContent(content)})
+}
+
+// AddUserParts 添加多模态用户消息
+func (c *Conversation) AddUserParts(parts ...ContentPart) *Conversation {
+	return c.AddMessage(Message{Role: "user", Content: PartsContent(parts...)})
+}
+
+// AddAssistant 添加助手消息
+func (c *Conversation) AddAssistant(content string) *Conversation {
+	return c.AddMessage(Message{Role: "assistant", Content: TextContent(content)})
+}
+
+// AddToolResult 添加工具调用结果
+func (c *Conversation) AddToolResult(toolCallID, content string) *Conversation {
+	return c.AddMessage(Message{Role: "tool", Content: TextContent(content), ToolCallID: toolCallID})
+}
+
+// AddMessage 添加任意消息，系统消息会替换当前的系统提示词
+func (c *Conversation) AddMessage(messages ...Message) *Conversation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, msg := range messages {
+		if msg.Role == "system" {
+			c.system = ExtractContent(&msg)
+			continue
+		}
+		c.messages = append(c.messages, msg)
+	}
+	return c
+}
+
+// AppendResponse 把响应中第一个选择项的助手消息加入历史，并累计使用量
+func (c *Conversation) AppendResponse(resp *ChatResponse) error {
+	if resp == nil || len(resp.Choices) == 0 || resp.Choices[0].Message == nil {
+		return fmt.Errorf("response has no message to append")
+	}
+
+	msg := *resp.Choices[0].Message
+	if msg.Role == "" {
+		msg.Role = "assistant"
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, msg)
+	c.addUsage(resp.Usage)
+	return nil
+}
+
+// AppendStream 读取整个流并把合并后的助手消息加入历史
+func (c *Conversation) AppendStream(stream *StreamReader) (*ChatResponse, error) {
+	resp, err := stream.Collect()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.AppendResponse(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// addUsage 累计使用量，调用方需持有写锁
+func (c *Conversation) addUsage(usage *Usage) {
+	if usage == nil {
+		return
+	}
+	c.usage.PromptTokens += usage.PromptTokens
+	c.usage.CompletionTokens += usage.CompletionTokens
+	c.usage.TotalTokens += usage.TotalTokens
+}
+
+// Usage 返回累计的使用量
+func (c *Conversation) Usage() Usage {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.usage
+}
+
+// Len 返回历史消息数（不含系统消息）
+func (c *Conversation) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.messages)
+}
+
+// History 返回历史消息副本（不含系统消息）
+func (c *Conversation) History() []Message {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Message(nil), c.messages...)
+}
+
+// Messages 返回包含系统消息在内的完整消息副本
+func (c *Conversation) Messages() []Message {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.withSystem(c.messages)
+}
+
+// withSystem 在消息前加上系统消息，调用方需持有锁
+func (c *Conversation) withSystem(history []Message) []Message {
+	messages := make([]Message, 0, len(history)+1)
+	if c.system != "" {
+		messages = append(messages, Message{Role: "system", Content: TextContent(c.system)})
+	}
+	return append(messages, history...)
+}
+
+// Prepare 返回适合发送的消息：在令牌预算内保留尽可能多的最近轮次，不修改历史
+func (c *Conversation) Prepare() []Message {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	start := c.fitStart()
+	return c.withSystem(c.messages[start:])
+}
+
+// Trim 从历史中删除超出令牌预算的最早轮次，返回删除的消息数
+func (c *Conversation) Trim() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	start := c.fitStart()
+	if start == 0 {
+		return 0
+	}
+	c.dropped += start - c.leadingNotes()
+	c.messages = append([]Message(nil), c.messages[start:]...)
+	c.version++
+	return start
+}
+
+// Clear 清空历史消息和使用量，保留系统提示词
+func (c *Conversation) Clear() *Conversation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dropped += len(c.messages) - c.leadingNotes()
+	c.messages = make([]Message, 0)
+	c.usage = Usage{}
+	c.version++
+	return c
+}
+
+// OverBudget 判断完整历史是否超出令牌预算
+func (c *Conversation) OverBudget() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.budget > 0 && c.counter != nil && c.counter(c.withSystem(c.messages)) > c.budget
+}
+
+// fitStart 计算满足预算的最早保留位置，调用方需持有锁
+//
+// 按轮次边界删除：工具结果总是和发起它的助手消息一起保留或删除，
+// 最后一个轮次即使超出预算也会保留。
+func (c *Conversation) fitStart() int {
+	if c.budget <= 0 || c.counter == nil {
+		return 0
+	}
+
+	boundaries := turnBoundaries(c.messages)
+	for _, start := range boundaries {
+		if c.counter(c.withSystem(c.messages[start:])) <= c.budget {
+			return start
+		}
+	}
+	if len(boundaries) > 0 {
+		return boundaries[len(boundaries)-1]
+	}
+	return 0
+}
+
+// turnBoundaries 返回可以作为保留起点的位置：工具结果不能与其工具调用分离
+func turnBoundaries(messages []Message) []int {
+	boundaries := make([]int, 0, len(messages))
+	for i, msg := range messages {
+		if msg.Role == "tool" {
+			continue
+		}
+		boundaries = append(boundaries, i)
+	}
+	return boundaries
+}
+
+// Complete 使用对话历史发送请求并把回复加入历史
+//
+// req 中的 Messages 会被忽略，由对话历史生成；调用方的 req 不会被修改。
+func (c *Conversation) Complete(ctx context.Context, client *Client, req *ChatRequest) (*ChatResponse, error) {
+	prepared := *req
+	prepared.Messages = c.Prepare()
+
+	resp, err := client.ChatCompletion(ctx, &prepared)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.AppendResponse(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Stream 使用对话历史发送流式请求，流正常结束后自动把合并的回复加入历史
+//
+// 回复无法加入历史时（例如流中没有任何选择），Recv 和 Collect 在流结束时返回该错误而不是 io.EOF。
+func (c *Conversation) Stream(ctx context.Context, client *Client, req *ChatRequest) (*StreamReader, error) {
+	prepared := *req
+	prepared.Messages = c.Prepare()
+
+	stream, err := client.ChatCompletionStream(ctx, &prepared)
+	if err != nil {
+		return nil, err
+	}
+	stream.onCompleteErr(c.AppendResponse)
+	return stream, nil
+}
+
+// EstimateTokens 粗略估算消息的令牌数：ASCII 约 4 个字符一个令牌，其他字符约一个令牌
+func EstimateTokens(messages []Message) int {
+	total := 3 // 回复的起始令牌
+	for _, msg := range messages {
+		total += 4 + estimateTextTokens(msg.Name)
+		total += estimateTextTokens(msg.Content.Text)
+		for _, part := range msg.Content.Parts {
+			switch part.Type {
+			case ContentTypeText:
+				total += estimateTextTokens(part.Text)
+			case ContentTypeImageURL:
+				total += 765 // 高细节 512x512 分块的典型开销
+			default:
+				total += 256
+			}
+		}
+		for _, call := range msg.ToolCalls {
+			total += 3 + estimateTextTokens(call.Function.Name) + estimateTextTokens(call.Function.Arguments)
+		}
+	}
+	return total
+}
+
+// estimateTextTokens 估算文本令牌数
+func estimateTextTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
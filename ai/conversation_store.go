@@ -0,0 +1,674 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrConversationNotFound 对话不存在
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// ConversationRecord 对话的持久化表示
+type ConversationRecord struct {
+	ID          string             `json:"id"`
+	ParentID    string             `json:"parent_id,omitempty"`
+	ForkedAt    int                `json:"forked_at,omitempty"` // 从父对话继承的消息数
+	System      string             `json:"system,omitempty"`
+	Messages    []Message          `json:"messages"`
+	Usage       Usage              `json:"usage"`
+	Metadata    map[string]string  `json:"metadata,omitempty"`
+	Compactions []CompactionRecord `json:"compactions,omitempty"`
+	Dropped     int                `json:"dropped,omitempty"` // 从历史开头删除的消息数，用于计算压缩记录的位置
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+// ConversationStore 对话存储
+type ConversationStore interface {
+	Save(ctx context.Context, record *ConversationRecord) error
+	Load(ctx context.Context, id string) (*ConversationRecord, error)
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context) ([]string, error)
+}
+
+// Snapshot 生成对话的持久化快照
+func (c *Conversation) Snapshot() *ConversationRecord {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return &ConversationRecord{
+		ID:          c.id,
+		ParentID:    c.parentID,
+		ForkedAt:    c.forkedAt,
+		System:      c.system,
+		Messages:    append([]Message(nil), c.messages...),
+		Usage:       c.usage,
+		Metadata:    copyStringMap(c.metadata),
+		Compactions: append([]CompactionRecord(nil), c.compactions...),
+		Dropped:     c.dropped,
+		CreatedAt:   c.createdAt,
+		UpdatedAt:   time.Now(),
+	}
+}
+
+// RestoreConversation 从持久化快照恢复对话
+func RestoreConversation(record *ConversationRecord) *Conversation {
+	conv := NewConversation(record.System)
+	conv.id = record.ID
+	conv.parentID = record.ParentID
+	conv.forkedAt = record.ForkedAt
+	conv.messages = append(conv.messages, record.Messages...)
+	conv.usage = record.Usage
+	conv.compactions = append([]CompactionRecord(nil), record.Compactions...)
+	conv.dropped = record.Dropped
+	if record.Metadata != nil {
+		conv.metadata = copyStringMap(record.Metadata)
+	}
+	if !record.CreatedAt.IsZero() {
+		conv.createdAt = record.CreatedAt
+	}
+	return conv
+}
+
+// Fork 从第 at 条历史消息处创建对话分支，新对话包含前 at 条消息
+func (c *Conversation) Fork(at int) (*Conversation, error) {
+	record := c.Snapshot()
+	forked, err := forkRecord(record, at, "")
+	if err != nil {
+		return nil, err
+	}
+	return RestoreConversation(forked), nil
+}
+
+// SaveConversation 保存对话
+func SaveConversation(ctx context.Context, store ConversationStore, conv *Conversation) error {
+	return store.Save(ctx, conv.Snapshot())
+}
+
+// LoadConversation 加载对话
+func LoadConversation(ctx context.Context, store ConversationStore, id string) (*Conversation, error) {
+	record, err := store.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return RestoreConversation(record), nil
+}
+
+// ForkConversation 从已保存对话的第 at 条消息处创建分支并保存，newID 为空时自动生成
+func ForkConversation(ctx context.Context, store ConversationStore, id string, at int, newID string) (*ConversationRecord, error) {
+	record, err := store.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	forked, err := forkRecord(record, at, newID)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Save(ctx, forked); err != nil {
+		return nil, err
+	}
+	return forked, nil
+}
+
+// forkRecord 创建分支记录
+func forkRecord(record *ConversationRecord, at int, newID string) (*ConversationRecord, error) {
+	if at < 0 || at > len(record.Messages) {
+		return nil, fmt.Errorf("fork position %d out of range [0, %d]", at, len(record.Messages))
+	}
+	if newID == "" {
+		newID = newConversationID()
+	}
+	now := time.Now()
+	return &ConversationRecord{
+		ID:          newID,
+		ParentID:    record.ID,
+		ForkedAt:    at,
+		System:      record.System,
+		Messages:    append([]Message(nil), record.Messages[:at]...),
+		Metadata:    copyStringMap(record.Metadata),
+		Compactions: append([]CompactionRecord(nil), record.Compactions...),
+		Dropped:     record.Dropped,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
+
+// copyStringMap 复制字符串映射
+func copyStringMap(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// validateConversationID 校验对话 ID 可以安全地用作文件名
+func validateConversationID(id string) error {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return fmt.Errorf("invalid conversation id %q", id)
+	}
+	return nil
+}
+
+// listByExtension 列出目录中指定扩展名的文件对应的对话 ID
+func listByExtension(dir, ext string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ext) {
+			ids = append(ids, strings.TrimSuffix(entry.Name(), ext))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// JSONFileStore 每个对话保存为一个 JSON 文件
+type JSONFileStore struct {
+	Dir string
+}
+
+// NewJSONFileStore 创建 JSON 文件存储
+func NewJSONFileStore(dir string) *JSONFileStore {
+	return &JSONFileStore{Dir: dir}
+}
+
+func (s *JSONFileStore) path(id string) string {
+	return filepath.Join(s.Dir, id+".json")
+}
+
+// Save 保存对话，先写临时文件再重命名，避免写入中断时损坏
+func (s *JSONFileStore) Save(ctx context.Context, record *ConversationRecord) error {
+	if err := validateConversationID(record.ID); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.Dir, record.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(record.ID))
+}
+
+// Load 加载对话
+func (s *JSONFileStore) Load(ctx context.Context, id string) (*ConversationRecord, error) {
+	if err := validateConversationID(id); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, err
+	}
+	var record ConversationRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode conversation %s: %w", id, err)
+	}
+	return &record, nil
+}
+
+// Delete 删除对话
+func (s *JSONFileStore) Delete(ctx context.Context, id string) error {
+	if err := validateConversationID(id); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List 列出所有对话 ID
+func (s *JSONFileStore) List(ctx context.Context) ([]string, error) {
+	return listByExtension(s.Dir, ".json")
+}
+
+// jsonlEvent JSONL 存储中的一行事件
+type jsonlEvent struct {
+	Type      string              `json:"type"` // header、message、reset、state、touch
+	Header    *ConversationRecord `json:"header,omitempty"`
+	Message   *Message            `json:"message,omitempty"`
+	Messages  []Message           `json:"messages,omitempty"`
+	State     *ConversationRecord `json:"state,omitempty"`
+	UpdatedAt *time.Time          `json:"updated_at,omitempty"`
+}
+
+// JSONLStore 每个对话一个只追加的 JSONL 文件
+//
+// 新消息逐条追加；历史被裁剪或压缩导致前缀变化时追加一条 reset 事件记录完整消息列表。
+// 使用量、元数据等其他字段变化时才追加 state 事件，只有消息变化时追加记录更新时间的 touch 事件。
+// 加载时按顺序重放所有事件。
+type JSONLStore struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+// NewJSONLStore 创建 JSONL 存储
+func NewJSONLStore(dir string) *JSONLStore {
+	return &JSONLStore{Dir: dir}
+}
+
+func (s *JSONLStore) path(id string) string {
+	return filepath.Join(s.Dir, id+".jsonl")
+}
+
+// Save 追加自上次保存以来的变化
+func (s *JSONLStore) Save(ctx context.Context, record *ConversationRecord) error {
+	if err := validateConversationID(record.ID); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+
+	var events []jsonlEvent
+	existing, err := s.load(record.ID)
+	switch {
+	case errors.Is(err, ErrConversationNotFound):
+		header := *record
+		header.Messages = nil
+		events = append(events, jsonlEvent{Type: "header", Header: &header})
+		existing = &header
+	case err != nil:
+		return err
+	}
+
+	if messagesHavePrefix(record.Messages, existing.Messages) {
+		for i := len(existing.Messages); i < len(record.Messages); i++ {
+			events = append(events, jsonlEvent{Type: "message", Message: &record.Messages[i]})
+		}
+	} else {
+		events = append(events, jsonlEvent{Type: "reset", Messages: record.Messages})
+	}
+
+	state := *record
+	state.Messages = nil
+	changed, err := recordStateChanged(existing, &state)
+	if err != nil {
+		return err
+	}
+	switch {
+	case changed:
+		events = append(events, jsonlEvent{Type: "state", State: &state})
+	case len(events) > 0 && !record.UpdatedAt.Equal(existing.UpdatedAt):
+		events = append(events, jsonlEvent{Type: "touch", UpdatedAt: &state.UpdatedAt})
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(s.path(record.ID), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// recordStateChanged 判断消息以外的字段是否变化，不比较 UpdatedAt
+func recordStateChanged(existing, state *ConversationRecord) (bool, error) {
+	a, b := *existing, *state
+	a.Messages, b.Messages = nil, nil
+	a.UpdatedAt, b.UpdatedAt = time.Time{}, time.Time{}
+	before, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	after, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(before, after), nil
+}
+
+// messagesHavePrefix 判断 messages 是否以 prefix 开头
+func messagesHavePrefix(messages, prefix []Message) bool {
+	if len(prefix) > len(messages) {
+		return false
+	}
+	for i := range prefix {
+		a, _ := json.Marshal(messages[i])
+		b, _ := json.Marshal(prefix[i])
+		if !bytes.Equal(a, b) {
+			return false
+		}
+	}
+	return true
+}
+
+// Load 重放事件加载对话
+func (s *JSONLStore) Load(ctx context.Context, id string) (*ConversationRecord, error) {
+	if err := validateConversationID(id); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(id)
+}
+
+func (s *JSONLStore) load(id string) (*ConversationRecord, error) {
+	f, err := os.Open(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	record := &ConversationRecord{ID: id}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var event jsonlEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("conversation %s line %d: %w", id, line, err)
+		}
+
+		switch event.Type {
+		case "header":
+			if event.Header != nil {
+				messages := record.Messages
+				*record = *event.Header
+				record.Messages = messages
+			}
+		case "message":
+			if event.Message != nil {
+				record.Messages = append(record.Messages, *event.Message)
+			}
+		case "reset":
+			record.Messages = append([]Message(nil), event.Messages...)
+		case "state":
+			if event.State != nil {
+				messages := record.Messages
+				*record = *event.State
+				record.Messages = messages
+			}
+		case "touch":
+			if event.UpdatedAt != nil {
+				record.UpdatedAt = *event.UpdatedAt
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if record.Messages == nil {
+		record.Messages = []Message{}
+	}
+	return record, nil
+}
+
+// Delete 删除对话
+func (s *JSONLStore) Delete(ctx context.Context, id string) error {
+	if err := validateConversationID(id); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List 列出所有对话 ID
+func (s *JSONLStore) List(ctx context.Context) ([]string, error) {
+	return listByExtension(s.Dir, ".jsonl")
+}
+
+// SQLStore 基于 database/sql 的对话存储，不依赖具体驱动
+type SQLStore struct {
+	DB          *sql.DB
+	TablePrefix string             // 表名前缀，默认 ai_
+	Placeholder func(n int) string // 第 n 个参数的占位符，默认 ?，PostgreSQL 可用 PostgresPlaceholder
+}
+
+// NewSQLStore 创建 SQL 存储
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{DB: db, TablePrefix: "ai_"}
+}
+
+// PostgresPlaceholder PostgreSQL 风格的占位符
+func PostgresPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (s *SQLStore) conversationsTable() string {
+	return s.TablePrefix + "conversations"
+}
+
+func (s *SQLStore) messagesTable() string {
+	return s.TablePrefix + "conversation_messages"
+}
+
+// query 把查询中的 ? 替换为驱动需要的占位符
+func (s *SQLStore) query(q string) string {
+	if s.Placeholder == nil {
+		return q
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString(s.Placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// CreateTables 创建所需的表
+func (s *SQLStore) CreateTables(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS ` + s.conversationsTable() + ` (
+			id VARCHAR(128) PRIMARY KEY,
+			parent_id VARCHAR(128),
+			forked_at INTEGER NOT NULL DEFAULT 0,
+			system_prompt TEXT,
+			usage_json TEXT,
+			metadata_json TEXT,
+			compactions_json TEXT,
+			dropped INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS ` + s.messagesTable() + ` (
+			conversation_id VARCHAR(128) NOT NULL,
+			seq INTEGER NOT NULL,
+			role VARCHAR(32) NOT NULL,
+			message_json TEXT NOT NULL,
+			PRIMARY KEY (conversation_id, seq)
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := s.DB.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save 在事务中保存对话及其全部消息
+func (s *SQLStore) Save(ctx context.Context, record *ConversationRecord) (err error) {
+	usage, _ := json.Marshal(record.Usage)
+	metadata, _ := json.Marshal(record.Metadata)
+	compactions, _ := json.Marshal(record.Compactions)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, s.query(`DELETE FROM `+s.conversationsTable()+` WHERE id = ?`), record.ID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, s.query(`DELETE FROM `+s.messagesTable()+` WHERE conversation_id = ?`), record.ID); err != nil {
+		return err
+	}
+
+	createdAt := record.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	updatedAt := record.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = time.Now()
+	}
+	_, err = tx.ExecContext(ctx, s.query(`INSERT INTO `+s.conversationsTable()+
+		` (id, parent_id, forked_at, system_prompt, usage_json, metadata_json, compactions_json, dropped, created_at, updated_at)`+
+		` VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		record.ID, record.ParentID, record.ForkedAt, record.System,
+		string(usage), string(metadata), string(compactions), record.Dropped, createdAt, updatedAt)
+	if err != nil {
+		return err
+	}
+
+	insert := s.query(`INSERT INTO ` + s.messagesTable() + ` (conversation_id, seq, role, message_json) VALUES (?, ?, ?, ?)`)
+	for i, msg := range record.Messages {
+		data, marshalErr := json.Marshal(msg)
+		if marshalErr != nil {
+			err = marshalErr
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, insert, record.ID, i, msg.Role, string(data)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Load 加载对话
+func (s *SQLStore) Load(ctx context.Context, id string) (*ConversationRecord, error) {
+	record := &ConversationRecord{ID: id}
+	var parentID, system, usage, metadata, compactions sql.NullString
+
+	row := s.DB.QueryRowContext(ctx, s.query(`SELECT parent_id, forked_at, system_prompt, usage_json, metadata_json, compactions_json, dropped, created_at, updated_at FROM `+
+		s.conversationsTable()+` WHERE id = ?`), id)
+	err := row.Scan(&parentID, &record.ForkedAt, &system, &usage, &metadata, &compactions, &record.Dropped, &record.CreatedAt, &record.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	record.ParentID = parentID.String
+	record.System = system.String
+	for _, field := range []struct {
+		raw sql.NullString
+		out interface{}
+	}{{usage, &record.Usage}, {metadata, &record.Metadata}, {compactions, &record.Compactions}} {
+		if field.raw.Valid && field.raw.String != "" {
+			if err := json.Unmarshal([]byte(field.raw.String), field.out); err != nil {
+				return nil, fmt.Errorf("failed to decode conversation %s: %w", id, err)
+			}
+		}
+	}
+
+	rows, err := s.DB.QueryContext(ctx, s.query(`SELECT message_json FROM `+s.messagesTable()+` WHERE conversation_id = ? ORDER BY seq`), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record.Messages = []Message{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			return nil, fmt.Errorf("failed to decode message of conversation %s: %w", id, err)
+		}
+		record.Messages = append(record.Messages, msg)
+	}
+	return record, rows.Err()
+}
+
+// Delete 删除对话
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	if _, err := s.DB.ExecContext(ctx, s.query(`DELETE FROM `+s.messagesTable()+` WHERE conversation_id = ?`), id); err != nil {
+		return err
+	}
+	_, err := s.DB.ExecContext(ctx, s.query(`DELETE FROM `+s.conversationsTable()+` WHERE id = ?`), id)
+	return err
+}
+
+// List 列出所有对话 ID
+func (s *SQLStore) List(ctx context.Context) ([]string, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT id FROM `+s.conversationsTable()+` ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
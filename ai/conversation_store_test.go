@@ -0,0 +1,446 @@
+package ai
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sampleConversation 构造包含工具调用和元数据的对话
+func sampleConversation() *Conversation {
+	conv := NewConversation("你是客服助手").SetID("thread-1").SetMetadata("customer", "42")
+	conv.AddUser("查询订单 1001")
+	conv.AddMessage(Message{
+		Role: "assistant",
+		ToolCalls: []ToolCall{{
+			ID:       "call_1",
+			Type:     "function",
+			Function: FunctionCall{Name: "get_order", Arguments: `{"id":"1001"}`},
+		}},
+	})
+	conv.AddToolResult("call_1", `{"status":"shipped"}`)
+	conv.AppendResponse(&ChatResponse{
+		Choices: []Choice{{Message: &Message{Role: "assistant", Content: TextContent("订单已发货")}}},
+		Usage:   &Usage{PromptTokens: 30, CompletionTokens: 5, TotalTokens: 35},
+	})
+	return conv
+}
+
+// TestConversationStores 测试各文件存储的保存、加载、列出和删除
+func TestConversationStores(t *testing.T) {
+	ctx := context.Background()
+	stores := map[string]ConversationStore{
+		"json":  NewJSONFileStore(t.TempDir()),
+		"jsonl": NewJSONLStore(t.TempDir()),
+	}
+
+	for name, store := range stores {
+		conv := sampleConversation()
+		if err := SaveConversation(ctx, store, conv); err != nil {
+			t.Fatalf("%s: 保存失败: %v", name, err)
+		}
+
+		// 继续对话后再次保存，JSONL 只追加新消息
+		conv.AddUser("谢谢")
+		if err := SaveConversation(ctx, store, conv); err != nil {
+			t.Fatalf("%s: 再次保存失败: %v", name, err)
+		}
+
+		loaded, err := LoadConversation(ctx, store, "thread-1")
+		if err != nil {
+			t.Fatalf("%s: 加载失败: %v", name, err)
+		}
+		if !reflect.DeepEqual(normalizeMessages(t, loaded.Messages()), normalizeMessages(t, conv.Messages())) {
+			t.Errorf("%s: 加载的消息与原对话不一致", name)
+		}
+		if loaded.Usage().TotalTokens != 35 || loaded.Metadata()["customer"] != "42" {
+			t.Errorf("%s: 使用量或元数据丢失: %+v %v", name, loaded.Usage(), loaded.Metadata())
+		}
+		if call := loaded.History()[1].ToolCalls; len(call) != 1 || call[0].Function.Arguments != `{"id":"1001"}` {
+			t.Errorf("%s: 工具调用丢失: %+v", name, call)
+		}
+
+		// 裁剪历史后保存，JSONL 需要记录重置事件
+		conv.SetTokenBudget(1, nil).Trim()
+		if err := SaveConversation(ctx, store, conv); err != nil {
+			t.Fatalf("%s: 裁剪后保存失败: %v", name, err)
+		}
+		loaded, _ = LoadConversation(ctx, store, "thread-1")
+		if loaded.Len() != conv.Len() {
+			t.Errorf("%s: 裁剪后的消息数应该为%d，实际%d", name, conv.Len(), loaded.Len())
+		}
+
+		ids, err := store.List(ctx)
+		if err != nil || !reflect.DeepEqual(ids, []string{"thread-1"}) {
+			t.Errorf("%s: 列出对话错误: %v %v", name, ids, err)
+		}
+		if err := store.Delete(ctx, "thread-1"); err != nil {
+			t.Errorf("%s: 删除失败: %v", name, err)
+		}
+		if _, err := store.Load(ctx, "thread-1"); !errors.Is(err, ErrConversationNotFound) {
+			t.Errorf("%s: 删除后应该返回ErrConversationNotFound，实际%v", name, err)
+		}
+		if err := store.Save(ctx, &ConversationRecord{ID: "../escape"}); err == nil {
+			t.Errorf("%s: 包含路径分隔符的ID应该被拒绝", name)
+		}
+	}
+
+	t.Logf("对话存储测试通过")
+}
+
+// TestJSONLStoreEvents 测试 JSONL 存储只在字段变化时追加 state 事件
+func TestJSONLStoreEvents(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := NewJSONLStore(dir)
+	conv := sampleConversation()
+	conv.compactions = []CompactionRecord{{Model: "m", End: 2, Messages: conv.History()[:2], Summary: "摘要"}}
+
+	countEvents := func() map[string]int {
+		data, err := os.ReadFile(filepath.Join(dir, "thread-1.jsonl"))
+		if err != nil {
+			t.Fatalf("读取文件失败: %v", err)
+		}
+		counts := map[string]int{}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var event jsonlEvent
+			json.Unmarshal([]byte(line), &event)
+			counts[event.Type]++
+		}
+		return counts
+	}
+
+	// 首次保存只有 header 和消息，未变化时不追加任何事件
+	SaveConversation(ctx, store, conv)
+	SaveConversation(ctx, store, conv)
+	if counts := countEvents(); counts["header"] != 1 || counts["state"] != 0 || counts["message"] != 4 {
+		t.Errorf("未变化时不应追加事件: %v", counts)
+	}
+
+	// 只追加消息时记录更新时间
+	conv.AddUser("谢谢")
+	SaveConversation(ctx, store, conv)
+	if counts := countEvents(); counts["state"] != 0 || counts["touch"] != 1 {
+		t.Errorf("只有消息变化时不应写入state: %v", counts)
+	}
+	record := conv.Snapshot()
+	record.UpdatedAt = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	record.Messages = append(record.Messages, Message{Role: "assistant", Content: TextContent("不客气")})
+	store.Save(ctx, record)
+	if loaded, _ := store.Load(ctx, "thread-1"); !loaded.UpdatedAt.Equal(record.UpdatedAt) {
+		t.Errorf("touch事件应该更新UpdatedAt: %v", loaded.UpdatedAt)
+	}
+
+	// 元数据变化时写入 state
+	conv.SetMetadata("tier", "gold")
+	SaveConversation(ctx, store, conv)
+	loaded, err := store.Load(ctx, "thread-1")
+	if counts := countEvents(); counts["state"] != 1 || err != nil || loaded.Metadata["tier"] != "gold" || len(loaded.Compactions) != 1 {
+		t.Errorf("字段变化时应该写入state: %v %+v %v", counts, loaded, err)
+	}
+
+	t.Logf("JSONL事件测试通过")
+}
+
+// TestSQLStore 测试 SQL 存储的建表、往返、占位符替换和事务回滚
+func TestSQLStore(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeSQL{placeholder: "$", tables: map[string][]map[string]driver.Value{}}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	store := NewSQLStore(db)
+	store.Placeholder = PostgresPlaceholder
+	if err := store.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	if _, ok := fake.tables["ai_conversation_messages"]; !ok {
+		t.Fatalf("应该创建消息表: %v", fake.tables)
+	}
+
+	conv := sampleConversation()
+	conv.compactions = []CompactionRecord{{Model: "m", End: 1, Messages: conv.History()[:1], Summary: "摘要"}}
+	conv.dropped = 1
+	if err := SaveConversation(ctx, store, conv); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	loaded, err := store.Load(ctx, "thread-1")
+	if err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	if normalizeMessages(t, loaded.Messages) != normalizeMessages(t, conv.History()) || loaded.System != "你是客服助手" ||
+		loaded.Usage.TotalTokens != 35 || loaded.Metadata["customer"] != "42" || len(loaded.Compactions) != 1 || loaded.Dropped != 1 {
+		t.Errorf("加载的记录与原对话不一致: %+v", loaded)
+	}
+	if fake.badQuery != "" {
+		t.Errorf("占位符没有被替换: %s", fake.badQuery)
+	}
+
+	// 写入消息失败时回滚，之前保存的记录保持不变
+	fake.fail = func(query string, args []driver.Value) error {
+		if strings.Contains(query, "conversation_messages (") && args[1] == int64(2) {
+			return errors.New("disk full")
+		}
+		return nil
+	}
+	conv.AddUser("谢谢")
+	if err := SaveConversation(ctx, store, conv); err == nil {
+		t.Fatalf("写入失败时应该返回错误")
+	}
+	fake.fail = nil
+	if loaded, err := store.Load(ctx, "thread-1"); err != nil || len(loaded.Messages) != 4 {
+		t.Errorf("失败的保存应该被回滚: %+v %v", loaded, err)
+	}
+
+	ids, err := store.List(ctx)
+	if err != nil || !reflect.DeepEqual(ids, []string{"thread-1"}) {
+		t.Errorf("列出对话错误: %v %v", ids, err)
+	}
+	if err := store.Delete(ctx, "thread-1"); err != nil {
+		t.Errorf("删除失败: %v", err)
+	}
+	if _, err := store.Load(ctx, "thread-1"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("删除后应该返回ErrConversationNotFound，实际%v", err)
+	}
+	if len(fake.tables["ai_conversation_messages"]) != 0 {
+		t.Errorf("删除后不应留下消息")
+	}
+
+	t.Logf("SQL存储测试通过")
+}
+
+// TestForkConversation 测试从任意消息处创建分支
+func TestForkConversation(t *testing.T) {
+	ctx := context.Background()
+	store := NewJSONFileStore(t.TempDir())
+	conv := sampleConversation()
+	if err := SaveConversation(ctx, store, conv); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+
+	forked, err := ForkConversation(ctx, store, "thread-1", 1, "thread-1-b")
+	if err != nil {
+		t.Fatalf("分支失败: %v", err)
+	}
+	if forked.ParentID != "thread-1" || forked.ForkedAt != 1 || len(forked.Messages) != 1 {
+		t.Errorf("分支记录错误: %+v", forked)
+	}
+
+	branch, err := LoadConversation(ctx, store, "thread-1-b")
+	if err != nil {
+		t.Fatalf("加载分支失败: %v", err)
+	}
+	branch.AddAssistant("请稍等")
+	if conv.Len() != 4 || branch.Len() != 2 || branch.System() != "你是客服助手" {
+		t.Errorf("分支应该独立于原对话: 原%d 分支%d", conv.Len(), branch.Len())
+	}
+
+	local, err := conv.Fork(3)
+	if err != nil || local.Len() != 3 || local.ID() == conv.ID() {
+		t.Errorf("内存分支错误: %v", err)
+	}
+	if _, err := conv.Fork(10); err == nil {
+		t.Error("超出范围的分支位置应该返回错误")
+	}
+
+	t.Logf("对话分支测试通过")
+}
+
+// normalizeMessages 把消息编码为 JSON 再解码，便于比较
+func normalizeMessages(t *testing.T, messages []Message) string {
+	t.Helper()
+	data, err := json.Marshal(messages)
+	if err != nil {
+		t.Fatalf("编码失败: %v", err)
+	}
+	return normalizeJSON(t, data)
+}
+
+// fakeSQL 只支持 SQLStore 所用语句的内存数据库，实现 driver.Connector
+//
+// placeholder 为 $ 时查询中出现 ? 或编号不连续的占位符会被记录到 badQuery；
+// fail 返回错误时对应的语句执行失败。
+type fakeSQL struct {
+	mu          sync.Mutex
+	placeholder string
+	tables      map[string][]map[string]driver.Value
+	snapshot    map[string][]map[string]driver.Value
+	badQuery    string
+	fail        func(query string, args []driver.Value) error
+}
+
+var (
+	fakeCreate = regexp.MustCompile(`^CREATE TABLE IF NOT EXISTS (\w+) \(`)
+	fakeDelete = regexp.MustCompile(`^DELETE FROM (\w+) WHERE (\w+) = \S+$`)
+	fakeInsert = regexp.MustCompile(`^INSERT INTO (\w+) \(([^)]*)\) VALUES`)
+	fakeSelect = regexp.MustCompile(`^SELECT (.+) FROM (\w+)(?: WHERE (\w+) = \S+)?(?: ORDER BY (\w+))?$`)
+	fakeParam  = regexp.MustCompile(`\?|\$\d+`)
+)
+
+func (f *fakeSQL) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: f}, nil }
+func (f *fakeSQL) Driver() driver.Driver                        { return nil }
+
+// exec 执行一条语句，返回查询的列和行
+func (f *fakeSQL) exec(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, param := range fakeParam.FindAllString(query, -1) {
+		want := "?"
+		if f.placeholder == "$" {
+			want = fmt.Sprintf("$%d", i+1)
+		}
+		if param != want {
+			f.badQuery = query
+		}
+	}
+	if f.fail != nil {
+		if err := f.fail(query, args); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	switch {
+	case fakeCreate.MatchString(query):
+		name := fakeCreate.FindStringSubmatch(query)[1]
+		if _, ok := f.tables[name]; !ok {
+			f.tables[name] = nil
+		}
+		return nil, nil, nil
+	case fakeDelete.MatchString(query):
+		m := fakeDelete.FindStringSubmatch(query)
+		var kept []map[string]driver.Value
+		for _, row := range f.tables[m[1]] {
+			if row[m[2]] != args[0] {
+				kept = append(kept, row)
+			}
+		}
+		f.tables[m[1]] = kept
+		return nil, nil, nil
+	case fakeInsert.MatchString(query):
+		m := fakeInsert.FindStringSubmatch(query)
+		row := map[string]driver.Value{}
+		for i, column := range strings.Split(m[2], ", ") {
+			row[column] = args[i]
+		}
+		f.tables[m[1]] = append(f.tables[m[1]], row)
+		return nil, nil, nil
+	case fakeSelect.MatchString(query):
+		m := fakeSelect.FindStringSubmatch(query)
+		columns := strings.Split(m[1], ", ")
+		var matched []map[string]driver.Value
+		for _, row := range f.tables[m[2]] {
+			if m[3] == "" || row[m[3]] == args[0] {
+				matched = append(matched, row)
+			}
+		}
+		if m[4] != "" {
+			sortFakeRows(matched, m[4])
+		}
+		rows := make([][]driver.Value, len(matched))
+		for i, row := range matched {
+			for _, column := range columns {
+				rows[i] = append(rows[i], row[column])
+			}
+		}
+		return columns, rows, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported query: %s", query)
+}
+
+// sortFakeRows 按列排序，列的值为字符串或整数
+func sortFakeRows(rows []map[string]driver.Value, column string) {
+	less := func(a, b driver.Value) bool {
+		if x, ok := a.(int64); ok {
+			return x < b.(int64)
+		}
+		return a.(string) < b.(string)
+	}
+	for i := 1; i < len(rows); i++ {
+		for j := i; j > 0 && less(rows[j][column], rows[j-1][column]); j-- {
+			rows[j], rows[j-1] = rows[j-1], rows[j]
+		}
+	}
+}
+
+type fakeConn struct{ db *fakeSQL }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: strings.Join(strings.Fields(query), " ")}, nil
+}
+func (c *fakeConn) Close() error { return nil }
+
+// Begin 保存所有表的快照，回滚时恢复
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.snapshot = map[string][]map[string]driver.Value{}
+	for name, rows := range c.db.tables {
+		c.db.snapshot[name] = append([]map[string]driver.Value(nil), rows...)
+	}
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.snapshot = nil
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.tables, c.db.snapshot = c.db.snapshot, nil
+	return nil
+}
+
+type fakeStmt struct {
+	db    *fakeSQL
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	_, _, err := s.db.exec(s.query, args)
+	return driver.RowsAffected(0), err
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	columns, rows, err := s.db.exec(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,177 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newStreamServer 启动按顺序返回预设 SSE 数据块的模拟服务器
+func newStreamServer(t *testing.T, chunks ...string) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	return NewClient(NewConfig(server.URL, "test-key"))
+}
+
+// TestConversationTrim 测试按令牌预算裁剪历史且不拆散工具调用
+func TestConversationTrim(t *testing.T) {
+	conv := NewConversation("你是一个测试助手")
+	call := ToolCall{ID: "call_1", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"location":"北京"}`}}
+
+	conv.AddUser(strings.Repeat("很长的第一轮问题", 20)).
+		AddAssistant(strings.Repeat("很长的第一轮回答", 20)).
+		AddUser("北京天气怎么样？").
+		AddMessage(Message{Role: "assistant", ToolCalls: []ToolCall{call}}).
+		AddToolResult("call_1", strings.Repeat("晴", 100)).
+		AddAssistant("北京今天晴。").
+		AddUser("谢谢")
+
+	full := EstimateTokens(conv.Messages())
+	conv.SetTokenBudget(full-50, nil)
+
+	prepared := conv.Prepare()
+	if prepared[0].Role != "system" {
+		t.Fatalf("系统消息应该始终保留: %+v", prepared[0])
+	}
+	if EstimateTokens(prepared) > full-50 {
+		t.Errorf("裁剪后仍超出预算: %d", EstimateTokens(prepared))
+	}
+	if conv.Len() != 7 {
+		t.Errorf("Prepare不应该修改历史，实际%d条", conv.Len())
+	}
+
+	// 预算只够保留工具结果时，工具调用必须一起保留
+	toolOnly := EstimateTokens(conv.Messages()[5:])
+	conv.SetTokenBudget(toolOnly, nil)
+	prepared = conv.Prepare()
+	for i, msg := range prepared {
+		if msg.Role != "tool" {
+			continue
+		}
+		if i == 0 || len(prepared[i-1].ToolCalls) == 0 {
+			t.Fatalf("工具结果与工具调用被拆散: %+v", prepared)
+		}
+	}
+
+	dropped := conv.Trim()
+	if dropped == 0 || conv.Len() != 7-dropped {
+		t.Errorf("Trim应该删除超出预算的消息，删除%d条，剩余%d条", dropped, conv.Len())
+	}
+	if conv.History()[0].Role == "tool" {
+		t.Error("裁剪后的历史不应该以工具结果开头")
+	}
+
+	t.Logf("对话裁剪测试通过")
+}
+
+// TestConversationComplete 测试对话自动追加回复和流式结果
+func TestConversationComplete(t *testing.T) {
+	client, requests := newTestServer(t, "第一轮回答")
+	conv := NewConversation("你是一个测试助手")
+	conv.AddUser("第一轮问题")
+
+	req := NewRequest("gpt-4.1").Build()
+	if _, err := conv.Complete(context.Background(), client, req); err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	if conv.Len() != 2 || ExtractContent(&conv.History()[1]) != "第一轮回答" {
+		t.Errorf("回复未加入历史: %+v", conv.History())
+	}
+	if conv.Usage().TotalTokens != 15 {
+		t.Errorf("使用量未累计: %+v", conv.Usage())
+	}
+	if sent := (*requests)[0]["messages"].([]interface{}); len(sent) != 2 {
+		t.Errorf("应该发送系统消息和历史，实际%d条", len(sent))
+	}
+
+	// 流式回复（含分片的工具调用）在结束后加入历史
+	chunks := []string{
+		`{"id":"c1","model":"gpt-4.1","choices":[{"index":0,"delta":{"role":"assistant","content":null,"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		`{"id":"c1","model":"gpt-4.1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"location\":"}}]}}]}`,
+		`{"id":"c1","model":"gpt-4.1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"北京\"}"}}]}}]}`,
+		`{"id":"c1","model":"gpt-4.1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":20,"completion_tokens":10,"total_tokens":30}}`,
+	}
+	streamClient := newStreamServer(t, chunks...)
+	conv.AddUser("北京天气怎么样？")
+
+	stream, err := conv.Stream(context.Background(), streamClient, req)
+	if err != nil {
+		t.Fatalf("流式请求失败: %v", err)
+	}
+	resp, err := stream.Collect()
+	if err != nil {
+		t.Fatalf("读取流失败: %v", err)
+	}
+
+	last := conv.History()[conv.Len()-1]
+	if len(last.ToolCalls) != 1 || last.ToolCalls[0].Function.Arguments != `{"location":"北京"}` || last.ToolCalls[0].Index != nil {
+		t.Fatalf("流式工具调用合并错误: %+v", last)
+	}
+	if resp.Choices[0].FinishReason != "tool_calls" || conv.Usage().TotalTokens != 45 {
+		t.Errorf("流式结果或使用量错误: %+v %+v", resp.Choices[0], conv.Usage())
+	}
+
+	encoded, _ := json.Marshal(last)
+	if strings.Contains(string(encoded), `"index"`) {
+		t.Errorf("合并后的工具调用不应该包含index: %s", encoded)
+	}
+
+	// 回复无法加入历史时在流结束时返回错误
+	emptyClient := newStreamServer(t, `{"id":"c2","model":"gpt-4.1","choices":[],"usage":{"prompt_tokens":1,"completion_tokens":0,"total_tokens":1}}`)
+	stream, err = conv.Stream(context.Background(), emptyClient, req)
+	if err != nil {
+		t.Fatalf("流式请求失败: %v", err)
+	}
+	before := conv.Len()
+	if _, err := stream.Collect(); err == nil || !strings.Contains(err.Error(), "no message to append") {
+		t.Errorf("加入历史失败时应该返回错误，实际%v", err)
+	}
+	if conv.Len() != before {
+		t.Errorf("失败时不应修改历史")
+	}
+
+	t.Logf("对话追加测试通过")
+}
+
+// TestConversationConcurrency 测试并发读写
+func TestConversationConcurrency(t *testing.T) {
+	conv := NewConversation("system").SetTokenBudget(200, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				conv.AddUser(fmt.Sprintf("消息%d-%d", i, j))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_ = conv.Prepare()
+				_ = conv.Messages()
+				_ = conv.Usage()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if conv.Len() != 400 {
+		t.Errorf("期望400条消息，实际%d条", conv.Len())
+	}
+
+	t.Logf("对话并发测试通过")
+}
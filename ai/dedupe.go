@@ -0,0 +1,89 @@
+package ai
+
+import (
+	"context"
+	"sync"
+)
+
+// flightGroup 合并相同的进行中请求，同一时刻每个键只有一个上游请求
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight 一个进行中的上游请求及等待它的调用方数量
+type flight struct {
+	done    chan struct{}
+	resp    *ChatResponse
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// do 执行 fn，键相同的并发调用共享同一次执行的结果
+//
+// fn 使用独立于调用方的上下文运行（保留第一个调用方上下文中的值），
+// 某个调用方取消时只有它自己返回 ctx.Err()；所有调用方都取消后才取消上游请求。
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (*ChatResponse, error)) (*ChatResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f, ok := g.flights[key]
+	if !ok {
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.flights[key] = f
+		go func() {
+			f.resp, f.err = fn(flightCtx)
+			g.mu.Lock()
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+			g.mu.Unlock()
+			cancel()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		if f.err != nil {
+			return nil, f.err
+		}
+		// 每个调用方得到独立的响应结构，选择和消息等内部数据仍然共享
+		resp := *f.resp
+		return &resp, nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+			// 已取消的请求不再接收新的调用方
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// doChatShared 配置了 Dedupe 时与相同的进行中请求共享 fn 的执行，否则直接执行
+//
+// 请求是否相同由 CacheKey 判断。
+func (c *Client) doChatShared(ctx context.Context, state *clientState, req *ChatRequest, fn func(ctx context.Context) (*ChatResponse, error)) (*ChatResponse, error) {
+	if !state.config.Dedupe {
+		return fn(ctx)
+	}
+	key, err := CacheKey(req)
+	if err != nil {
+		return fn(ctx)
+	}
+	return c.flights.do(ctx, key, fn)
+}
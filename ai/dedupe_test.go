@@ -0,0 +1,126 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestDedupe 测试并发的相同请求合并为一次上游请求
+func TestDedupe(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	canceled := make(chan struct{}, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 读完请求体后服务端才能感知客户端断开
+		io.ReadAll(r.Body)
+		atomic.AddInt32(&calls, 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			canceled <- struct{}{}
+			return
+		}
+		w.Write([]byte(`{"id":"r1","choices":[{"index":0,"message":{"role":"assistant","content":"positive"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(NewConfig(server.URL, "k").WithDedupe(true))
+	newRequest := func() *ChatRequest {
+		return NewRequest("m").Messages(NewMessageBuilder().User("classify").Build()).Build()
+	}
+	waitCalls := func(n int32) {
+		for atomic.LoadInt32(&calls) < n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// 多个调用方共享一次请求，其中一个取消不影响其他调用方
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	results := make([]*ChatResponse, 5)
+	errs := make([]error, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			callCtx := context.Background()
+			if i == 0 {
+				callCtx = ctx
+			}
+			results[i], errs[i] = client.ChatCompletion(callCtx, newRequest())
+		}(i)
+	}
+	waitCalls(1)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if !errors.Is(errs[0], context.Canceled) {
+		t.Errorf("取消的调用方应该返回context.Canceled，实际%v", errs[0])
+	}
+	for i := 1; i < len(results); i++ {
+		if errs[i] != nil || ExtractContent(results[i].Choices[0].Message) != "positive" || results[i].ServedModel != "m" {
+			t.Errorf("调用方%d的结果错误: %+v %v", i, results[i], errs[i])
+		}
+	}
+	if results[1] == results[2] {
+		t.Errorf("每个调用方应该得到独立的响应结构")
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("应该只发出1个上游请求，实际%d个", calls)
+	}
+
+	// 所有调用方都取消后取消上游请求，之后的请求重新发出
+	release = make(chan struct{})
+	atomic.StoreInt32(&calls, 0)
+	ctx, cancel = context.WithCancel(context.Background())
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := client.ChatCompletion(ctx, newRequest())
+			done <- err
+		}()
+	}
+	waitCalls(1)
+	cancel()
+	for i := 0; i < 2; i++ {
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("应该返回context.Canceled，实际%v", err)
+		}
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Errorf("所有调用方取消后上游请求应该被取消")
+	}
+	close(release)
+	if _, err := client.ChatCompletion(context.Background(), newRequest()); err != nil || atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("取消后的请求应该重新发出: %v", err)
+	}
+
+	// 未开启时每次调用都发出请求
+	atomic.StoreInt32(&calls, 0)
+	plain := NewClient(NewConfig(server.URL, "k"))
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			plain.ChatCompletion(context.Background(), newRequest())
+		}()
+	}
+	wg.Wait()
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("未开启 Dedupe 时应该发出3个请求，实际%d个", calls)
+	}
+
+	t.Logf("请求合并测试通过")
+}
@@ -0,0 +1,272 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 多端点的选择策略
+const (
+	EndpointStrategyPriority = "priority" // 按配置顺序，前面的端点不可用时才使用后面的（默认）
+	EndpointStrategyWeighted = "weighted" // 按 Weight 分配请求，失败时转移到其他端点
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"    // 正常
+	BreakerOpen     = "open"      // 连续失败，暂停使用
+	BreakerHalfOpen = "half_open" // 冷却结束，允许一个探测请求
+)
+
+// 熔断器默认参数
+const (
+	DefaultBreakerThreshold = 3
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrNoAvailableEndpoint 所有端点的熔断器都处于打开状态
+var ErrNoAvailableEndpoint = errors.New("no endpoint available: all circuit breakers are open")
+
+// EndpointConfig 一个服务端点，配置文件中也可以直接写地址字符串
+type EndpointConfig struct {
+	URL string `json:"url"`
+	// Name 统计中显示的名称，默认为地址
+	Name string `json:"name,omitempty"`
+	// Weight weighted 策略下的权重，默认为 1
+	Weight int `json:"weight,omitempty"`
+}
+
+// UnmarshalJSON 同时接受 "https://..." 和 {"url": "https://...", "weight": 2}
+func (e *EndpointConfig) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		*e = EndpointConfig{URL: url}
+		return nil
+	}
+	type plain EndpointConfig
+	return json.Unmarshal(data, (*plain)(e))
+}
+
+// EndpointStats 单个端点的健康状态和统计
+type EndpointStats struct {
+	Name     string
+	URL      string
+	Requests int64
+	Failures int64
+	// State 熔断器状态：closed、open 或 half_open
+	State string
+	// ConsecutiveFailures 连续失败次数，成功后清零
+	ConsecutiveFailures int
+	// OpenUntil 熔断器打开时允许探测的时间
+	OpenUntil time.Time
+	LastError string
+}
+
+// endpointPool 端点池，被动地根据请求结果跟踪健康状态
+type endpointPool struct {
+	mu        sync.Mutex
+	strategy  string
+	threshold int
+	cooldown  time.Duration
+	endpoints []*endpoint
+	now       func() time.Time
+}
+
+// endpoint 端点及其熔断状态
+type endpoint struct {
+	url           string
+	weight        int
+	currentWeight int
+	probing       bool
+	stats         EndpointStats
+}
+
+// newEndpointPool 按配置创建端点池，没有配置 Endpoints 时返回 nil
+//
+// previous 中相同地址的健康状态会被保留。
+func newEndpointPool(config *Config, previous *endpointPool) *endpointPool {
+	if len(config.Endpoints) == 0 {
+		return nil
+	}
+
+	pool := &endpointPool{
+		strategy:  config.EndpointStrategy,
+		threshold: config.BreakerThreshold,
+		cooldown:  config.BreakerCooldown,
+		now:       time.Now,
+	}
+	if pool.strategy == "" {
+		pool.strategy = EndpointStrategyPriority
+	}
+	if pool.threshold <= 0 {
+		pool.threshold = DefaultBreakerThreshold
+	}
+	if pool.cooldown <= 0 {
+		pool.cooldown = DefaultBreakerCooldown
+	}
+
+	old := make(map[string]EndpointStats)
+	if previous != nil {
+		previous.mu.Lock()
+		for _, e := range previous.endpoints {
+			old[e.url] = e.stats
+		}
+		previous.mu.Unlock()
+	}
+
+	for _, ec := range config.Endpoints {
+		e := &endpoint{url: NormalizeBaseURL(ec.URL), weight: ec.Weight}
+		if e.weight <= 0 {
+			e.weight = 1
+		}
+		if stats, ok := old[e.url]; ok {
+			e.stats = stats
+			if e.stats.State == BreakerHalfOpen {
+				e.stats.State = BreakerOpen
+			}
+		} else {
+			e.stats.State = BreakerClosed
+		}
+		e.stats.URL = e.url
+		e.stats.Name = ec.Name
+		if e.stats.Name == "" {
+			e.stats.Name = e.url
+		}
+		pool.endpoints = append(pool.endpoints, e)
+	}
+	return pool
+}
+
+// available 判断端点当前能否接收请求，冷却结束的打开状态转为半开
+func (p *endpointPool) available(e *endpoint, now time.Time) bool {
+	switch e.stats.State {
+	case BreakerOpen:
+		return !now.Before(e.stats.OpenUntil)
+	case BreakerHalfOpen:
+		// 半开时只允许一个探测请求
+		return !e.probing
+	default:
+		return true
+	}
+}
+
+// acquire 选择一个可用且本次调用未尝试过的端点
+func (p *endpointPool) acquire(tried map[*endpoint]bool) (*endpoint, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	var chosen *endpoint
+	switch p.strategy {
+	case EndpointStrategyWeighted:
+		total := 0
+		for _, e := range p.endpoints {
+			if tried[e] || !p.available(e, now) {
+				continue
+			}
+			e.currentWeight += e.weight
+			total += e.weight
+			if chosen == nil || e.currentWeight > chosen.currentWeight {
+				chosen = e
+			}
+		}
+		if chosen != nil {
+			chosen.currentWeight -= total
+		}
+	default:
+		for _, e := range p.endpoints {
+			if !tried[e] && p.available(e, now) {
+				chosen = e
+				break
+			}
+		}
+	}
+	if chosen == nil {
+		return nil, ErrNoAvailableEndpoint
+	}
+
+	if chosen.stats.State == BreakerOpen {
+		chosen.stats.State = BreakerHalfOpen
+	}
+	if chosen.stats.State == BreakerHalfOpen {
+		chosen.probing = true
+	}
+	chosen.stats.Requests++
+	return chosen, nil
+}
+
+// release 记录一次请求的结果
+//
+// failed 为 true 表示端点故障（连接错误或 5xx），连续失败达到阈值或半开探测失败时打开熔断器；
+// failed 为 false 时关闭熔断器。canceled 表示调用方取消了请求，不影响健康状态。
+func (p *endpointPool) release(e *endpoint, failed, canceled bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e.probing = false
+	if canceled {
+		return
+	}
+	if !failed {
+		e.stats.State = BreakerClosed
+		e.stats.ConsecutiveFailures = 0
+		return
+	}
+
+	e.stats.Failures++
+	e.stats.ConsecutiveFailures++
+	if err != nil {
+		e.stats.LastError = err.Error()
+	}
+	if e.stats.State == BreakerHalfOpen || e.stats.ConsecutiveFailures >= p.threshold {
+		e.stats.State = BreakerOpen
+		e.stats.OpenUntil = p.now().Add(p.cooldown)
+	}
+}
+
+// stats 返回所有端点的统计快照，按配置顺序排列
+func (p *endpointPool) stats() []EndpointStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]EndpointStats, len(p.endpoints))
+	for i, e := range p.endpoints {
+		stats[i] = e.stats
+	}
+	return stats
+}
+
+// EndpointStats 返回各端点的健康状态，未配置 Endpoints 时返回 nil
+func (c *Client) EndpointStats() []EndpointStats {
+	pool := c.load().endpoints
+	if pool == nil {
+		return nil
+	}
+	return pool.stats()
+}
+
+// endpointPoolKey 返回影响端点池的设置，相同时复用端点池
+func (c *Config) endpointPoolKey() string {
+	parts := []string{c.EndpointStrategy, strconv.Itoa(c.BreakerThreshold), c.BreakerCooldown.String()}
+	for _, e := range c.Endpoints {
+		parts = append(parts, e.URL+"\x00"+e.Name+"\x00"+strconv.Itoa(e.Weight))
+	}
+	return strings.Join(parts, "\x01")
+}
+
+// isEndpointFailure 判断错误是否说明端点本身故障：连接失败、超时或 5xx 响应
+func isEndpointFailure(err error) bool {
+	var apiErr *APIError
+	var rateErr *RateLimitError
+	switch {
+	case errors.As(err, &rateErr):
+		return false
+	case errors.As(err, &apiErr):
+		return apiErr.Code >= 500
+	default:
+		return err != nil
+	}
+}
@@ -0,0 +1,128 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestEndpointFailover 测试多端点故障转移和熔断器
+func TestEndpointFailover(t *testing.T) {
+	var mu sync.Mutex
+	primaryDown := true
+	var hits []string
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hits = append(hits, name)
+			down := primaryDown && name == "primary"
+			mu.Unlock()
+			if down {
+				w.WriteHeader(http.StatusBadGateway)
+				w.Write([]byte(`{"error":{"message":"upstream unavailable","type":"server_error"}}`))
+				return
+			}
+			if r.Header.Get("Accept") == "text/event-stream" {
+				w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"" + name + "\"}}]}\n\ndata: [DONE]\n\n"))
+				return
+			}
+			w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"` + name + `"}}]}`))
+		}
+	}
+	primary := httptest.NewServer(handler("primary"))
+	defer primary.Close()
+	secondary := httptest.NewServer(handler("secondary"))
+	defer secondary.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	hitsSince := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		got := hits
+		hits = nil
+		return got
+	}
+	newReq := func() *ChatRequest {
+		return NewRequest("m").Messages(NewMessageBuilder().User("hi").Build()).Build()
+	}
+
+	config := NewConfig("", "k").WithEndpoints(closed.URL, primary.URL+"/v1/", secondary.URL).WithCircuitBreaker(2, time.Minute)
+	client := NewClient(config)
+	now := time.Now()
+	client.load().endpoints.now = func() time.Time { return now }
+
+	// 连接错误和 5xx 都转移到下一个端点
+	for i := 0; i < 2; i++ {
+		resp, err := client.ChatCompletion(context.Background(), newReq())
+		if err != nil || ExtractContent(resp.Choices[0].Message) != "secondary" {
+			t.Fatalf("第%d次请求应该转移到secondary: %v", i+1, err)
+		}
+	}
+	if got := hitsSince(); !reflect.DeepEqual(got, []string{"primary", "secondary", "primary", "secondary"}) {
+		t.Errorf("请求顺序错误: %v", got)
+	}
+
+	// 连续失败达到阈值后熔断器打开，不再请求故障端点
+	stats := client.EndpointStats()
+	if stats[0].State != BreakerOpen || stats[1].State != BreakerOpen || stats[2].State != BreakerClosed || stats[1].Failures != 2 {
+		t.Errorf("熔断器状态错误: %+v", stats)
+	}
+	stream, err := client.ChatCompletionStream(context.Background(), newReq())
+	if err != nil {
+		t.Fatalf("流式请求失败: %v", err)
+	}
+	resp, err := stream.Collect()
+	if err != nil || ExtractContent(resp.Choices[0].Message) != "secondary" {
+		t.Errorf("流式请求应该使用secondary: %v", err)
+	}
+	if got := hitsSince(); !reflect.DeepEqual(got, []string{"secondary"}) {
+		t.Errorf("熔断后不应请求primary: %v", got)
+	}
+
+	// 冷却结束后半开，探测成功则恢复
+	mu.Lock()
+	primaryDown = false
+	mu.Unlock()
+	now = now.Add(2 * time.Minute)
+	resp, err = client.ChatCompletion(context.Background(), newReq())
+	if err != nil || ExtractContent(resp.Choices[0].Message) != "primary" {
+		t.Fatalf("冷却结束后应该探测并恢复primary: %v", err)
+	}
+	stats = client.EndpointStats()
+	if stats[0].State != BreakerOpen || stats[1].State != BreakerClosed || stats[1].ConsecutiveFailures != 0 {
+		t.Errorf("探测后的熔断器状态错误: %+v", stats)
+	}
+
+	// 4xx 不是端点故障，直接返回且不计入熔断器
+	invalid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"bad request","type":"invalid_request_error"}}`))
+	}))
+	defer invalid.Close()
+	hitsSince()
+	client = NewClient(NewConfig("", "k").WithEndpoints(invalid.URL, secondary.URL))
+	var apiErr *APIError
+	if _, err := client.ChatCompletion(context.Background(), newReq()); !errors.As(err, &apiErr) || apiErr.Code != 400 {
+		t.Errorf("4xx应该直接返回，实际%v", err)
+	}
+	if got := hitsSince(); len(got) != 0 || client.EndpointStats()[0].Failures != 0 {
+		t.Errorf("4xx不应转移或计为故障: %v %+v", got, client.EndpointStats())
+	}
+
+	// 所有端点都熔断时返回错误
+	down := NewClient(NewConfig("", "k").WithEndpoints(closed.URL).WithCircuitBreaker(1, time.Hour))
+	if _, err := down.ChatCompletion(context.Background(), newReq()); err == nil || errors.Is(err, ErrNoAvailableEndpoint) {
+		t.Errorf("第一次应该返回连接错误，实际%v", err)
+	}
+	if _, err := down.ChatCompletion(context.Background(), newReq()); !errors.Is(err, ErrNoAvailableEndpoint) {
+		t.Errorf("熔断后应该返回ErrNoAvailableEndpoint，实际%v", err)
+	}
+
+	t.Logf("多端点故障转移测试通过")
+}
@@ -1,18 +1,42 @@
 package ai
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
 
-// APIError API 错误
+// APIError API 错误，Code 为 HTTP 状态码
 type APIError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 	Type    string `json:"type"`
+	// ErrorCode 错误体中的 code 字段，如 insufficient_quota
+	ErrorCode string `json:"error_code,omitempty"`
 }
 
 func (e *APIError) Error() string {
 	return fmt.Sprintf("OpenAI API error (code: %d, type: %s): %s", e.Code, e.Type, e.Message)
 }
 
+// IsQuotaExceeded 判断错误是否表示额度耗尽
+//
+// 以 type 或 code 为 insufficient_quota 为准；one-api 等网关只在消息中提示额度不足，
+// 因此 401、403 和 429 响应的消息包含 quota 或“额度”时也视为额度耗尽，其他状态码不按消息判断。
+func (e *APIError) IsQuotaExceeded() bool {
+	if e.Type == "insufficient_quota" || e.ErrorCode == "insufficient_quota" {
+		return true
+	}
+	switch e.Code {
+	case 401, 403, 429:
+		message := strings.ToLower(e.Message)
+		return strings.Contains(message, "quota") || strings.Contains(message, "额度")
+	}
+	return false
+}
+
 // RateLimitError 速率限制错误
 type RateLimitError struct {
 	*APIError
@@ -23,6 +47,41 @@ func (e *RateLimitError) Error() string {
 	return fmt.Sprintf("Rate limit exceeded, retry after %d seconds: %s", e.RetryAfter, e.APIError.Error())
 }
 
+// newAPIError 把非 200 响应解析为 *APIError，429 且不是额度耗尽时返回 *RateLimitError
+//
+// 错误体不是 OpenAI 格式时使用原始内容作为错误信息。
+func newAPIError(resp *http.Response, body []byte) error {
+	apiErr := &APIError{Code: resp.StatusCode}
+
+	var payload struct {
+		Error *struct {
+			Message string          `json:"message"`
+			Type    string          `json:"type"`
+			Code    json.RawMessage `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && payload.Error != nil {
+		apiErr.Message = payload.Error.Message
+		apiErr.Type = payload.Error.Type
+		// code 可能是字符串、数字或 null
+		var code interface{}
+		if json.Unmarshal(payload.Error.Code, &code) == nil && code != nil {
+			apiErr.ErrorCode = fmt.Sprint(code)
+		}
+	} else {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests && !apiErr.IsQuotaExceeded() {
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return &RateLimitError{APIError: apiErr, RetryAfter: retryAfter}
+	}
+	return apiErr
+}
+
 // ValidationError 验证错误
 type ValidationError struct {
 	Field   string
@@ -51,5 +110,93 @@ func ValidateRequest(req *ChatRequest) error {
 		return &ValidationError{Field: "top_p", Message: "top_p must be between 0 and 1"}
 	}
 
+	if req.N != nil && *req.N < 1 {
+		return &ValidationError{Field: "n", Message: "n must be at least 1"}
+	}
+
+	if req.MaxTokens != nil && *req.MaxTokens < 1 {
+		return &ValidationError{Field: "max_tokens", Message: "max_tokens must be positive"}
+	}
+
+	if req.PresencePenalty != nil && (*req.PresencePenalty < -2 || *req.PresencePenalty > 2) {
+		return &ValidationError{Field: "presence_penalty", Message: "presence_penalty must be between -2 and 2"}
+	}
+
+	if req.FrequencyPenalty != nil && (*req.FrequencyPenalty < -2 || *req.FrequencyPenalty > 2) {
+		return &ValidationError{Field: "frequency_penalty", Message: "frequency_penalty must be between -2 and 2"}
+	}
+
+	for token, bias := range req.LogitBias {
+		if _, err := strconv.Atoi(token); err != nil {
+			return &ValidationError{Field: "logit_bias", Message: fmt.Sprintf("key '%s' must be a token ID", token)}
+		}
+		if bias < -100 || bias > 100 {
+			return &ValidationError{Field: "logit_bias", Message: fmt.Sprintf("bias for token %s must be between -100 and 100", token)}
+		}
+	}
+
+	if req.TopLogprobs != nil {
+		if *req.TopLogprobs < 0 || *req.TopLogprobs > 20 {
+			return &ValidationError{Field: "top_logprobs", Message: "top_logprobs must be between 0 and 20"}
+		}
+		if req.Logprobs == nil || !*req.Logprobs {
+			return &ValidationError{Field: "top_logprobs", Message: "top_logprobs requires logprobs to be true"}
+		}
+	}
+
+	switch req.ReasoningEffort {
+	case "", ReasoningEffortMinimal, ReasoningEffortLow, ReasoningEffortMedium, ReasoningEffortHigh:
+	default:
+		return &ValidationError{Field: "reasoning_effort", Message: "reasoning_effort must be minimal, low, medium or high"}
+	}
+
+	wantsAudio := false
+	for _, modality := range req.Modalities {
+		switch modality {
+		case ModalityText:
+		case ModalityAudio:
+			wantsAudio = true
+		default:
+			return &ValidationError{Field: "modalities", Message: fmt.Sprintf("unsupported modality '%s'", modality)}
+		}
+	}
+	if wantsAudio && req.Audio == nil {
+		return &ValidationError{Field: "audio", Message: "audio output parameters are required when requesting the audio modality"}
+	}
+	if req.Audio != nil && (req.Audio.Voice == "" || req.Audio.Format == "") {
+		return &ValidationError{Field: "audio", Message: "audio requires voice and format"}
+	}
+
+	if req.Prediction != nil && req.Prediction.Type != "content" {
+		return &ValidationError{Field: "prediction", Message: "prediction type must be 'content'"}
+	}
+
+	if len(req.Metadata) > 16 {
+		return &ValidationError{Field: "metadata", Message: "metadata supports at most 16 key-value pairs"}
+	}
+	for k, v := range req.Metadata {
+		if len(k) > 64 || len(v) > 512 {
+			return &ValidationError{Field: "metadata", Message: fmt.Sprintf("metadata key '%s' exceeds 64 characters or its value exceeds 512 characters", k)}
+		}
+	}
+
+	switch req.ServiceTier {
+	case "", ServiceTierAuto, ServiceTierDefault, ServiceTierFlex, ServiceTierPriority:
+	default:
+		return &ValidationError{Field: "service_tier", Message: "service_tier must be auto, default, flex or priority"}
+	}
+
+	if req.ResponseFormat != nil {
+		switch req.ResponseFormat.Type {
+		case ResponseFormatText, ResponseFormatJSONObject:
+		case ResponseFormatJSONSchema:
+			if req.ResponseFormat.JSONSchema == nil || req.ResponseFormat.JSONSchema.Name == "" {
+				return &ValidationError{Field: "response_format", Message: "json_schema requires a name and a schema"}
+			}
+		default:
+			return &ValidationError{Field: "response_format", Message: "type must be text, json_object or json_schema"}
+		}
+	}
+
 	return nil
 }
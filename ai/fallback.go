@@ -0,0 +1,166 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// 错误类别，用于决定是否回退到下一个模型
+const (
+	ErrorKindRateLimit      = "rate_limit"      // 429 速率限制
+	ErrorKindServer         = "server_error"    // 5xx、连接失败或所有端点不可用
+	ErrorKindTimeout        = "timeout"         // 请求超时
+	ErrorKindContextLength  = "context_length"  // 超出模型上下文长度
+	ErrorKindAuth           = "auth"            // 认证失败、无权限或额度耗尽
+	ErrorKindInvalidRequest = "invalid_request" // 其他 4xx
+	ErrorKindUnknown        = "unknown"
+)
+
+// DefaultFallbackOn 未配置 FallbackOn 时触发模型回退的错误类别
+var DefaultFallbackOn = []string{ErrorKindRateLimit, ErrorKindServer, ErrorKindTimeout}
+
+// ClassifyError 返回错误的类别，nil 返回空字符串
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var rateErr *RateLimitError
+	var apiErr *APIError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &rateErr):
+		return ErrorKindRateLimit
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.Code >= 500:
+			return ErrorKindServer
+		case apiErr.Code == 401 || apiErr.Code == 403 || apiErr.IsQuotaExceeded():
+			return ErrorKindAuth
+		case apiErr.ErrorCode == "context_length_exceeded" || isContextLengthMessage(apiErr.Message):
+			return ErrorKindContextLength
+		case apiErr.Code == 429:
+			return ErrorKindRateLimit
+		case apiErr.Code >= 400:
+			return ErrorKindInvalidRequest
+		}
+	case errors.Is(err, ErrNoAvailableKey):
+		return ErrorKindAuth
+	case errors.Is(err, ErrNoAvailableEndpoint):
+		return ErrorKindServer
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorKindTimeout
+	case errors.As(err, &netErr):
+		return ErrorKindServer
+	}
+	return ErrorKindUnknown
+}
+
+// isContextLengthMessage 判断错误信息是否表示超出上下文长度
+func isContextLengthMessage(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "context length") || strings.Contains(message, "context_length") ||
+		strings.Contains(message, "maximum context") || strings.Contains(message, "too many tokens")
+}
+
+// FallbackAttempt 模型回退链中一次失败的尝试
+type FallbackAttempt struct {
+	Model string
+	Err   error
+}
+
+// FallbackError 回退链中的所有模型都失败
+type FallbackError struct {
+	Attempts []FallbackAttempt
+}
+
+func (e *FallbackError) Error() string {
+	parts := make([]string, len(e.Attempts))
+	for i, attempt := range e.Attempts {
+		parts[i] = fmt.Sprintf("%s: %v", attempt.Model, attempt.Err)
+	}
+	return fmt.Sprintf("all fallback models failed: %s", strings.Join(parts, "; "))
+}
+
+// Unwrap 返回最后一个模型的错误
+func (e *FallbackError) Unwrap() error {
+	return e.Attempts[len(e.Attempts)-1].Err
+}
+
+// fallbackChain 返回依次尝试的请求，每个请求都已解析模型并填充对应的默认参数
+//
+// 回退列表优先使用请求的 Fallbacks，其次是配置中以请求模型（角色名或具体模型名）为键的 Fallbacks。
+// 列表中的角色名会被解析，重复的模型只尝试一次。
+func (c *Config) fallbackChain(req *ChatRequest) []*ChatRequest {
+	fallbacks := req.Fallbacks
+	if fallbacks == nil {
+		role := req.Model
+		if role == "" {
+			role = ModelRoleChat
+		}
+		fallbacks = c.Fallbacks[role]
+		if fallbacks == nil {
+			fallbacks = c.Fallbacks[c.ResolveModel(req.Model)]
+		}
+	}
+
+	chain := []*ChatRequest{c.prepareRequest(req)}
+	seen := map[string]bool{chain[0].Model: true}
+	for _, model := range fallbacks {
+		if seen[c.ResolveModel(model)] {
+			continue
+		}
+		candidate := *req
+		candidate.Model = model
+		prepared := c.prepareRequest(&candidate)
+		seen[prepared.Model] = true
+		chain = append(chain, prepared)
+	}
+	return chain
+}
+
+// shouldFallback 判断错误是否应该回退到下一个模型，调用方取消的请求不回退
+func (c *Config) shouldFallback(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if c.FallbackIf != nil && c.FallbackIf(err) {
+		return true
+	}
+	kinds := c.FallbackOn
+	if kinds == nil {
+		kinds = DefaultFallbackOn
+	}
+	kind := ClassifyError(err)
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// withFallbacks 依次用回退链中的请求调用 do，直到成功或遇到不回退的错误
+func withFallbacks[T any](ctx context.Context, config *Config, req *ChatRequest, do func(*ChatRequest) (T, error)) (T, error) {
+	chain := config.fallbackChain(req)
+	var attempts []FallbackAttempt
+	for i, candidate := range chain {
+		result, err := do(candidate)
+		if err == nil {
+			return result, nil
+		}
+		attempts = append(attempts, FallbackAttempt{Model: candidate.Model, Err: err})
+		if i == len(chain)-1 || !config.shouldFallback(ctx, err) {
+			break
+		}
+	}
+
+	var zero T
+	if len(attempts) == 1 {
+		return zero, attempts[0].Err
+	}
+	return zero, &FallbackError{Attempts: attempts}
+}
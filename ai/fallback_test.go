@@ -0,0 +1,134 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// TestModelFallback 测试模型回退链、错误分类和实际使用的模型
+func TestModelFallback(t *testing.T) {
+	var mu sync.Mutex
+	var models []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model       string   `json:"model"`
+			Temperature *float64 `json:"temperature"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		models = append(models, body.Model)
+		mu.Unlock()
+
+		switch body.Model {
+		case "busy":
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"message":"rate limited","type":"requests"}}`))
+		case "broken":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"message":"overloaded","type":"server_error"}}`))
+		case "small":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"This model's maximum context length is 8192 tokens","type":"invalid_request_error","code":"context_length_exceeded"}}`))
+		default:
+			if r.Header.Get("Accept") == "text/event-stream" {
+				w.Write([]byte("data: {\"model\":\"" + body.Model + "\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ok\"}}]}\n\ndata: [DONE]\n\n"))
+				return
+			}
+			// 回复内容为请求的温度，用于检查回退模型的默认参数
+			temperature := "unset"
+			if body.Temperature != nil {
+				temperature = strconv.FormatFloat(*body.Temperature, 'f', -1, 64)
+			}
+			resp, _ := json.Marshal(map[string]interface{}{
+				"model":   body.Model,
+				"choices": []interface{}{map[string]interface{}{"index": 0, "message": map[string]interface{}{"role": "assistant", "content": temperature}}},
+			})
+			w.Write(resp)
+		}
+	}))
+	defer server.Close()
+
+	taken := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		got := models
+		models = nil
+		return got
+	}
+	messages := NewMessageBuilder().User("hi").Build()
+
+	config := NewConfig(server.URL, "k").
+		WithModel(ModelRoleChat, "busy").
+		WithModel("backup", "gpt-4.1-mini").
+		WithFallbacks(ModelRoleChat, "broken", "busy", "backup").
+		WithModelDefaults("gpt-4.1-mini", RequestDefaults{Temperature: &[]float64{0.5}[0]})
+	client := NewClient(config)
+
+	// 按角色配置的回退链，跳过重复的模型，回退模型使用自己的默认参数
+	resp, err := client.ChatCompletion(context.Background(), NewRequest("").Messages(messages).Build())
+	if err != nil {
+		t.Fatalf("回退请求失败: %v", err)
+	}
+	if resp.ServedModel != "gpt-4.1-mini" || resp.Model != "gpt-4.1-mini" {
+		t.Errorf("实际使用的模型应为gpt-4.1-mini，实际为%s", resp.ServedModel)
+	}
+	if got := taken(); !reflect.DeepEqual(got, []string{"busy", "broken", "gpt-4.1-mini"}) {
+		t.Errorf("回退顺序错误: %v", got)
+	}
+	if content := ExtractContent(resp.Choices[0].Message); content != "0.5" {
+		t.Errorf("回退模型应使用自己的默认温度，实际为%s", content)
+	}
+
+	// 请求级的回退列表优先，上下文超长默认不回退
+	req := NewRequest("small").Messages(messages).Fallbacks("gpt-4.1").Build()
+	if _, err := client.ChatCompletion(context.Background(), req); ClassifyError(err) != ErrorKindContextLength {
+		t.Errorf("上下文超长默认不应回退，实际%v", err)
+	}
+	taken()
+
+	// 配置上下文超长后回退到更大的模型
+	contextConfig := NewConfig(server.URL, "k").WithFallbackOn(ErrorKindContextLength)
+	client = NewClient(contextConfig)
+	stream, err := client.ChatCompletionStream(context.Background(), req)
+	if err != nil {
+		t.Fatalf("流式回退失败: %v", err)
+	}
+	collected, err := stream.Collect()
+	if err != nil || stream.ServedModel() != "gpt-4.1" || collected.ServedModel != "gpt-4.1" {
+		t.Errorf("流式回退应使用gpt-4.1: %v %s", err, stream.ServedModel())
+	}
+	if got := taken(); !reflect.DeepEqual(got, []string{"small", "gpt-4.1"}) {
+		t.Errorf("流式回退顺序错误: %v", got)
+	}
+
+	// 全部失败时返回每个模型的错误，可以取出最后一个错误
+	client = NewClient(NewConfig(server.URL, "k"))
+	_, err = client.ChatCompletion(context.Background(), NewRequest("broken").Messages(messages).Fallbacks("busy").Build())
+	var fallbackErr *FallbackError
+	var rateErr *RateLimitError
+	if !errors.As(err, &fallbackErr) || len(fallbackErr.Attempts) != 2 || !errors.As(err, &rateErr) || rateErr.RetryAfter != 3 {
+		t.Errorf("应该返回包含全部尝试的FallbackError，实际%v", err)
+	}
+
+	// 自定义判断
+	custom := NewConfig(server.URL, "k").WithFallbackOn()
+	custom.FallbackIf = func(err error) bool { return ClassifyError(err) == ErrorKindServer }
+	client = NewClient(custom)
+	taken()
+	if _, err := client.ChatCompletion(context.Background(), NewRequest("busy").Messages(messages).Fallbacks("gpt-4.1").Build()); err == nil {
+		t.Error("FallbackOn为空且自定义判断不匹配时不应回退")
+	}
+	if resp, err := client.ChatCompletion(context.Background(), NewRequest("broken").Messages(messages).Fallbacks("gpt-4.1").Build()); err != nil || resp.ServedModel != "gpt-4.1" {
+		t.Errorf("自定义判断匹配时应该回退: %v", err)
+	}
+
+	t.Logf("模型回退测试通过")
+}
@@ -0,0 +1,99 @@
+//go:build ignore
+
+// gen_tiktoken 下载 cl100k_base 和 o200k_base 秩表，校验 SHA-256 后以 gzip 压缩保存到 tiktoken 目录
+//
+// 由 tokenizer_tables.go 中的 go:generate 调用。压缩后的文件随源码提交，
+// 已存在且解压后校验通过的文件不会重新下载。
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const baseURL = "https://openaipublic.blob.core.windows.net/encodings/"
+
+// checksums 与 tokenizer_tables.go 中的 tiktokenSHA256 保持一致，针对解压后的内容
+var checksums = map[string]string{
+	"cl100k_base": "223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7",
+	"o200k_base":  "446a9538cb6c348e3516120d7c08b09f57c36495e2acfffe59a5bf8b0cfb1a2d",
+}
+
+func main() {
+	client := &http.Client{Timeout: 5 * time.Minute}
+	for _, name := range []string{"cl100k_base", "o200k_base"} {
+		path := filepath.Join("tiktoken", name+".tiktoken.gz")
+		if data, err := readGzip(path); err == nil && sha256Hex(data) == checksums[name] {
+			fmt.Printf("%s: up to date\n", path)
+			continue
+		}
+		if err := fetch(client, name, path); err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+		fmt.Printf("%s: downloaded\n", path)
+	}
+}
+
+// fetch 下载秩表，校验通过后压缩写入临时文件再重命名
+func fetch(client *http.Client, name, path string) error {
+	resp, err := client.Get(baseURL + name + ".tiktoken")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if got := sha256Hex(data); got != checksums[name] {
+		return fmt.Errorf("checksum mismatch: got %s, want %s", got, checksums[name])
+	}
+
+	var buf bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readGzip 读取并解压文件
+func readGzip(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -8,101 +8,206 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
 // doChatRequest 执行聊天请求
-func (c *Client) doChatRequest(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
-	// 合并额外参数
-	reqMap := make(map[string]interface{})
-	reqBytes, _ := json.Marshal(req)
-	json.Unmarshal(reqBytes, &reqMap)
-
-	for k, v := range req.Extra {
-		reqMap[k] = v
-	}
-
-	jsonData, err := json.Marshal(reqMap)
+func (c *Client) doChatRequest(ctx context.Context, state *clientState, req *ChatRequest) (*ChatResponse, error) {
+	// 序列化请求，额外参数在序列化时合并
+	jsonData, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/v1/chat/completions", c.config.BaseURL)
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	estimated, err := c.waitRateLimit(ctx, state, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
-
-	c.setHeaders(httpReq)
-
-	resp, err := c.http.Do(httpReq)
+	resp, key, err := c.send(ctx, state, req.Model, jsonData, false)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("failed to read response: %w", err)
+		state.keys.finish(key, nil, err)
+		return nil, err
 	}
 
 	var response ChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := json.Unmarshal(body, &response); err != nil {
+		err = fmt.Errorf("failed to decode response: %w", err)
+		state.keys.finish(key, nil, err)
+		return nil, err
 	}
+	response.Raw = body
+	state.keys.finish(key, response.Usage, nil)
+	state.limiter.reconcile(req.Model, estimated, response.Usage)
 
 	return &response, nil
 }
 
 // doChatStreamRequest 执行流式聊天请求
-func (c *Client) doChatStreamRequest(ctx context.Context, req *ChatRequest) (*StreamReader, error) {
-	// 合并额外参数
-	reqMap := make(map[string]interface{})
-	reqBytes, _ := json.Marshal(req)
-	json.Unmarshal(reqBytes, &reqMap)
-
-	for k, v := range req.Extra {
-		reqMap[k] = v
+func (c *Client) doChatStreamRequest(ctx context.Context, state *clientState, req *ChatRequest) (*StreamReader, error) {
+	// 序列化请求，额外参数在序列化时合并
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	jsonData, err := json.Marshal(reqMap)
+	estimated, err := c.waitRateLimit(ctx, state, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, err
+	}
+	resp, key, err := c.send(ctx, state, req.Model, jsonData, true)
+	if err != nil {
+		return nil, err
 	}
 
-	url := fmt.Sprintf("%s/v1/chat/completions", c.config.BaseURL)
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	return &StreamReader{
+		reader:  resp.Body,
+		scanner: bufio.NewScanner(resp.Body),
+		ctx:     ctx,
+		onDone: func(usage *Usage, err error) {
+			state.keys.finish(key, usage, err)
+			state.limiter.reconcile(req.Model, estimated, usage)
+		},
+	}, nil
+}
+
+// waitRateLimit 配置了 RateLimits 时等待模型的请求和令牌余量，返回预估的令牌数
+func (c *Client) waitRateLimit(ctx context.Context, state *clientState, req *ChatRequest) (int, error) {
+	if state.limiter == nil {
+		return 0, nil
+	}
+	estimated := estimateRequestTokens(req)
+	if err := state.limiter.wait(ctx, req.Model, estimated); err != nil {
+		return 0, fmt.Errorf("waiting for rate limit: %w", err)
+	}
+	return estimated, nil
+}
+
+// send 发送请求，返回状态码为 200 的响应和所用的密钥
+//
+// 使用密钥池时，密钥因认证失败或额度耗尽被拒绝后会换下一个可用密钥重试，直到所有密钥都尝试过。
+// 成功时返回的密钥需要在读完响应后通过 finish 归还。
+func (c *Client) send(ctx context.Context, state *clientState, model string, body []byte, stream bool) (*http.Response, *pooledKey, error) {
+	if state.keys == nil {
+		resp, err := c.sendWithKey(ctx, state, model, body, stream, state.config.APIKey)
+		return resp, nil, err
+	}
+
+	tried := make(map[*pooledKey]bool)
+	var lastErr error
+	for {
+		key, err := state.keys.acquire(tried)
+		if err != nil {
+			if lastErr != nil {
+				return nil, nil, lastErr
+			}
+			return nil, nil, err
+		}
+		tried[key] = true
+
+		resp, err := c.sendWithKey(ctx, state, model, body, stream, key.key)
+		if err == nil {
+			return resp, key, nil
+		}
+		state.keys.release(key, err)
+		if !isKeyError(err) {
+			return nil, nil, err
+		}
+		lastErr = err
+	}
+}
+
+// sendWithKey 使用指定密钥发送请求
+//
+// 配置了多个端点时，连接错误和 5xx 响应会转移到下一个可用端点，并计入该端点的熔断器。
+// 转移只发生在收到响应之前，流式响应开始后的中断不会切换端点。
+func (c *Client) sendWithKey(ctx context.Context, state *clientState, model string, body []byte, stream bool, apiKey string) (*http.Response, error) {
+	if state.endpoints == nil {
+		return c.sendTo(ctx, state, state.config.BaseURL, model, body, stream, apiKey)
+	}
+
+	tried := make(map[*endpoint]bool)
+	var lastErr error
+	for {
+		e, err := state.endpoints.acquire(tried)
+		if err != nil {
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, err
+		}
+		tried[e] = true
+
+		resp, err := c.sendTo(ctx, state, e.url, model, body, stream, apiKey)
+		failed := isEndpointFailure(err)
+		canceled := ctx.Err() != nil
+		state.endpoints.release(e, failed, canceled, err)
+		if !failed || canceled {
+			return resp, err
+		}
+		lastErr = err
+	}
+}
+
+// sendTo 向指定端点发送一次请求，非 200 响应解析为 *APIError
+func (c *Client) sendTo(ctx context.Context, state *clientState, baseURL, model string, body []byte, stream bool, apiKey string) (*http.Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", state.config.chatURL(baseURL, model), bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	c.setHeaders(httpReq)
-	httpReq.Header.Set("Accept", "text/event-stream")
+	state.config.setHeaders(httpReq, apiKey)
+	if stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
 
-	resp, err := c.http.Do(httpReq)
+	resp, err := state.http.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
 
+	state.limiter.observe(model, resp.Header)
+
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+		err := newAPIError(resp, body)
+		if rateErr, ok := err.(*RateLimitError); ok {
+			state.limiter.throttle(model, time.Duration(rateErr.RetryAfter)*time.Second)
+		}
+		return nil, err
 	}
+	return resp, nil
+}
 
-	return &StreamReader{
-		reader:  resp.Body,
-		scanner: bufio.NewScanner(resp.Body),
-		ctx:     ctx,
-	}, nil
+// chatURL 返回 baseURL 上的聊天补全接口地址，Azure 按部署名拼接路径
+func (c *Config) chatURL(baseURL, model string) string {
+	if c.Provider == ProviderAzure {
+		return fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+			strings.TrimRight(baseURL, "/"), url.PathEscape(model), url.QueryEscape(c.APIVersion))
+	}
+	return fmt.Sprintf("%s/v1/chat/completions", NormalizeBaseURL(baseURL))
 }
 
 // setHeaders 设置请求头
-func (c *Client) setHeaders(req *http.Request) {
+func (c *Config) setHeaders(req *http.Request, apiKey string) {
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.config.APIKey))
+	if c.Provider == ProviderAzure {
+		req.Header.Set("api-key", apiKey)
+	} else {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
+	}
 
 	// 添加自定义头部
-	for k, v := range c.config.Headers {
+	for k, v := range c.Headers {
 		req.Header.Set(k, v)
 	}
 }
@@ -0,0 +1,267 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 密钥池的选择策略
+const (
+	KeyStrategyRoundRobin = "round_robin" // 依次轮换（默认）
+	KeyStrategyWeighted   = "weighted"    // 按 Weight 平滑加权轮换
+	KeyStrategyLeastUsed  = "least_used"  // 选择进行中请求最少、累计请求最少的密钥
+)
+
+// DefaultKeyCooldown 密钥因认证失败或额度耗尽被暂停使用的默认时长
+const DefaultKeyCooldown = 5 * time.Minute
+
+// ErrNoAvailableKey 密钥池中的密钥都处于暂停状态
+var ErrNoAvailableKey = errors.New("no API key available: all keys are cooling down")
+
+// APIKeyConfig 密钥池中的一个密钥，配置文件中也可以直接写字符串
+type APIKeyConfig struct {
+	Key string `json:"key"`
+	// Name 统计中显示的名称，默认为脱敏后的密钥
+	Name string `json:"name,omitempty"`
+	// Weight weighted 策略下的权重，默认为 1
+	Weight int `json:"weight,omitempty"`
+}
+
+// UnmarshalJSON 同时接受 "sk-..." 和 {"key": "sk-...", "weight": 2}
+func (k *APIKeyConfig) UnmarshalJSON(data []byte) error {
+	var key string
+	if err := json.Unmarshal(data, &key); err == nil {
+		*k = APIKeyConfig{Key: key}
+		return nil
+	}
+	type plain APIKeyConfig
+	return json.Unmarshal(data, (*plain)(k))
+}
+
+// KeyStats 单个密钥的使用统计
+type KeyStats struct {
+	Name             string
+	Requests         int64 // 发出的请求数
+	Failures         int64 // 失败的请求数
+	PromptTokens     int64
+	CompletionTokens int64
+	TotalTokens      int64
+	InFlight         int
+	// BenchedUntil 暂停使用的截止时间，零值表示可用
+	BenchedUntil time.Time
+	// LastError 最近一次失败的错误信息
+	LastError string
+}
+
+// Available 判断密钥在 now 时是否可用
+func (s KeyStats) Available(now time.Time) bool {
+	return !now.Before(s.BenchedUntil)
+}
+
+// keyPool 密钥池，在同一配置的所有请求间共享
+type keyPool struct {
+	mu       sync.Mutex
+	strategy string
+	cooldown time.Duration
+	keys     []*pooledKey
+	next     int
+	now      func() time.Time
+}
+
+// pooledKey 密钥及其统计
+type pooledKey struct {
+	key           string
+	weight        int
+	currentWeight int
+	stats         KeyStats
+}
+
+// newKeyPool 按配置创建密钥池，没有配置 APIKeys 时返回 nil
+//
+// previous 中相同密钥的统计和暂停状态会被保留，配置热加载不会让失效的密钥重新生效。
+func newKeyPool(config *Config, previous *keyPool) *keyPool {
+	if len(config.APIKeys) == 0 {
+		return nil
+	}
+
+	pool := &keyPool{
+		strategy: config.KeyStrategy,
+		cooldown: config.KeyCooldown,
+		now:      time.Now,
+	}
+	if pool.strategy == "" {
+		pool.strategy = KeyStrategyRoundRobin
+	}
+	if pool.cooldown == 0 {
+		pool.cooldown = DefaultKeyCooldown
+	}
+
+	old := make(map[string]KeyStats)
+	if previous != nil {
+		previous.mu.Lock()
+		for _, k := range previous.keys {
+			old[k.key] = k.stats
+		}
+		previous.mu.Unlock()
+	}
+
+	for _, kc := range config.APIKeys {
+		k := &pooledKey{key: kc.Key, weight: kc.Weight}
+		if k.weight <= 0 {
+			k.weight = 1
+		}
+		if stats, ok := old[kc.Key]; ok {
+			k.stats = stats
+			k.stats.InFlight = 0
+		}
+		k.stats.Name = kc.Name
+		if k.stats.Name == "" {
+			k.stats.Name = maskKey(kc.Key)
+		}
+		pool.keys = append(pool.keys, k)
+	}
+	return pool
+}
+
+// maskKey 脱敏密钥，只保留前缀和最后 4 位
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:3] + "..." + key[len(key)-4:]
+}
+
+// acquire 按策略选择一个可用且本次调用未尝试过的密钥
+func (p *keyPool) acquire(tried map[*pooledKey]bool) (*pooledKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	candidates := make([]*pooledKey, 0, len(p.keys))
+	for _, k := range p.keys {
+		if !tried[k] && k.stats.Available(now) {
+			candidates = append(candidates, k)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoAvailableKey
+	}
+
+	var chosen *pooledKey
+	switch p.strategy {
+	case KeyStrategyWeighted:
+		// 平滑加权轮询：每轮所有候选累加权重，选出最大者后减去总权重
+		total := 0
+		for _, k := range candidates {
+			k.currentWeight += k.weight
+			total += k.weight
+			if chosen == nil || k.currentWeight > chosen.currentWeight {
+				chosen = k
+			}
+		}
+		chosen.currentWeight -= total
+	case KeyStrategyLeastUsed:
+		for _, k := range candidates {
+			if chosen == nil || k.stats.InFlight < chosen.stats.InFlight ||
+				k.stats.InFlight == chosen.stats.InFlight && k.stats.Requests < chosen.stats.Requests {
+				chosen = k
+			}
+		}
+	default:
+		// 从上次位置之后找第一个候选
+		for i := 0; i < len(p.keys) && chosen == nil; i++ {
+			k := p.keys[(p.next+i)%len(p.keys)]
+			for _, c := range candidates {
+				if c == k {
+					chosen = k
+					p.next = (p.next + i + 1) % len(p.keys)
+					break
+				}
+			}
+		}
+	}
+
+	chosen.stats.Requests++
+	chosen.stats.InFlight++
+	return chosen, nil
+}
+
+// release 结束一次请求，err 为认证或额度错误时暂停该密钥
+func (p *keyPool) release(k *pooledKey, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k.stats.InFlight--
+	if err == nil {
+		return
+	}
+	k.stats.Failures++
+	k.stats.LastError = err.Error()
+	if isKeyError(err) {
+		k.stats.BenchedUntil = p.now().Add(p.cooldown)
+	}
+}
+
+// finish 在读完响应后归还密钥并累计令牌用量，未使用密钥池时什么也不做
+func (p *keyPool) finish(k *pooledKey, usage *Usage, err error) {
+	if p == nil || k == nil {
+		return
+	}
+	if usage != nil {
+		p.mu.Lock()
+		k.stats.PromptTokens += int64(usage.PromptTokens)
+		k.stats.CompletionTokens += int64(usage.CompletionTokens)
+		k.stats.TotalTokens += int64(usage.TotalTokens)
+		p.mu.Unlock()
+	}
+	p.release(k, err)
+}
+
+// stats 返回所有密钥的统计快照，按配置顺序排列
+func (p *keyPool) stats() []KeyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]KeyStats, len(p.keys))
+	for i, k := range p.keys {
+		stats[i] = k.stats
+	}
+	return stats
+}
+
+// KeyStats 返回密钥池中各密钥的使用统计，未配置 APIKeys 时返回 nil
+func (c *Client) KeyStats() []KeyStats {
+	pool := c.load().keys
+	if pool == nil {
+		return nil
+	}
+	return pool.stats()
+}
+
+// keyPoolKey 返回影响密钥池的设置，相同时复用密钥池
+func (c *Config) keyPoolKey() string {
+	parts := []string{c.KeyStrategy, c.KeyCooldown.String()}
+	for _, k := range c.APIKeys {
+		parts = append(parts, k.Key+"\x00"+k.Name+"\x00"+strconv.Itoa(k.Weight))
+	}
+	return strings.Join(parts, "\x01")
+}
+
+// isKeyError 判断错误是否说明密钥本身不可用：认证失败、无权限或额度耗尽
+func isKeyError(err error) bool {
+	var apiErr *APIError
+	var rateErr *RateLimitError
+	switch {
+	case errors.As(err, &rateErr):
+		apiErr = rateErr.APIError
+	case !errors.As(err, &apiErr):
+		return false
+	}
+	if apiErr == nil {
+		return false
+	}
+	return apiErr.Code == 401 || apiErr.Code == 403 || apiErr.IsQuotaExceeded()
+}
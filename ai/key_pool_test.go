@@ -0,0 +1,179 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestKeyPool 测试密钥池的选择策略、失效密钥暂停和用量统计
+func TestKeyPool(t *testing.T) {
+	var mu sync.Mutex
+	var used []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mu.Lock()
+		used = append(used, key)
+		mu.Unlock()
+		switch key {
+		case "sk-revoked":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"invalid api key","type":"invalid_request_error","code":"invalid_api_key"}}`))
+		case "sk-empty":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":{"message":"该令牌额度已用尽","type":"one_api_error"}}`))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`))
+		}
+	}))
+	defer server.Close()
+
+	req := func(client *Client) error {
+		_, err := client.ChatCompletion(context.Background(), NewRequest("m").Messages(NewMessageBuilder().User("hi").Build()).Build())
+		return err
+	}
+	reset := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		got := used
+		used = nil
+		return got
+	}
+
+	// 轮换时跳过失效的密钥，失效密钥被暂停后不再使用
+	client := NewClient(NewConfig(server.URL, "").WithAPIKeys("sk-good-1", "sk-revoked", "sk-empty", "sk-good-2"))
+	for i := 0; i < 4; i++ {
+		if err := req(client); err != nil {
+			t.Fatalf("第%d次请求失败: %v", i+1, err)
+		}
+	}
+	want := []string{"sk-good-1", "sk-revoked", "sk-empty", "sk-good-2", "sk-good-1", "sk-good-2"}
+	if got := reset(); !reflect.DeepEqual(got, want) {
+		t.Errorf("密钥使用顺序错误:\n期望%v\n实际%v", want, got)
+	}
+
+	stats := client.KeyStats()
+	if len(stats) != 4 || stats[0].Name != "sk-...od-1" || stats[0].Requests != 2 || stats[0].TotalTokens != 10 ||
+		stats[1].Failures != 1 || stats[1].Available(time.Now()) || stats[2].Available(time.Now()) || !stats[3].Available(time.Now()) {
+		t.Errorf("密钥统计错误: %+v", stats)
+	}
+
+	// 配置热加载保留暂停状态
+	if err := client.SetConfig(NewConfig(server.URL, "").WithAPIKeys("sk-revoked", "sk-good-2").WithKeyCooldown(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	req(client)
+	if got := reset(); !reflect.DeepEqual(got, []string{"sk-good-2"}) {
+		t.Errorf("替换配置后不应再使用暂停的密钥，实际%v", got)
+	}
+
+	// 所有密钥都失效时返回最后一个错误
+	client = NewClient(NewConfig(server.URL, "").WithAPIKeys("sk-revoked", "sk-empty"))
+	err := req(client)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.IsQuotaExceeded() {
+		t.Errorf("应该返回额度耗尽的错误，实际%v", err)
+	}
+	if err := req(client); !errors.Is(err, ErrNoAvailableKey) {
+		t.Errorf("所有密钥暂停后应该返回ErrNoAvailableKey，实际%v", err)
+	}
+	reset()
+
+	// 加权轮换按权重分配请求
+	weighted := NewConfig(server.URL, "").WithKeyStrategy(KeyStrategyWeighted)
+	weighted.APIKeys = []APIKeyConfig{{Key: "sk-heavy", Weight: 3}, {Key: "sk-light", Weight: 1}}
+	client = NewClient(weighted)
+	for i := 0; i < 8; i++ {
+		req(client)
+	}
+	counts := map[string]int{}
+	for _, key := range reset() {
+		counts[key]++
+	}
+	if counts["sk-heavy"] != 6 || counts["sk-light"] != 2 {
+		t.Errorf("加权分配错误: %v", counts)
+	}
+
+	// 最少使用优先选择请求数最少的密钥
+	client = NewClient(NewConfig(server.URL, "").WithAPIKeys("sk-a", "sk-b").WithKeyStrategy(KeyStrategyLeastUsed))
+	stream, err := client.ChatCompletionStream(context.Background(), NewRequest("m").Messages(NewMessageBuilder().User("hi").Build()).Build())
+	if err == nil {
+		if stats := client.KeyStats(); stats[0].InFlight != 1 {
+			t.Errorf("流未关闭时应计为进行中: %+v", stats)
+		}
+		req(client)
+		stream.Close()
+		if stats := client.KeyStats(); stats[0].InFlight != 0 || stats[1].Requests != 1 {
+			t.Errorf("最少使用策略应该选择空闲的密钥: %+v", stats)
+		}
+	}
+
+	// 配置文件中的密钥池可以写字符串或对象
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+openai:
+  base_url: https://api.example.com
+  api_keys:
+    - sk-plain
+    - {key: sk-weighted, weight: 2, name: backup}
+  key_strategy: weighted
+  key_cooldown: 10m
+`), 0o644)
+	config, file, err := LoadConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("加载密钥池配置失败: %v", err)
+	}
+	if len(config.APIKeys) != 2 || config.APIKeys[0].Key != "sk-plain" || config.APIKeys[1].Weight != 2 ||
+		config.APIKeys[1].Name != "backup" || config.KeyCooldown != 10*time.Minute || len(file.Warnings) != 0 {
+		t.Errorf("密钥池配置错误: %+v %v", config, file.Warnings)
+	}
+
+	// 只有额度错误码或 401/403/429 的额度提示才使密钥失效
+	for _, tc := range []struct {
+		err  *APIError
+		want bool
+	}{
+		{&APIError{Code: 400, Type: "insufficient_quota"}, true},
+		{&APIError{Code: 429, ErrorCode: "insufficient_quota"}, true},
+		{&APIError{Code: 403, Message: "该令牌额度已用尽"}, true},
+		{&APIError{Code: 429, Message: "You exceeded your current quota"}, true},
+		{&APIError{Code: 400, Message: "max_tokens exceeds model quota"}, false},
+		{&APIError{Code: 500, Message: "upstream quota service unavailable"}, false},
+	} {
+		if got := tc.err.IsQuotaExceeded(); got != tc.want {
+			t.Errorf("%+v 的额度判断错误: %v", tc.err, got)
+		}
+		if got := isKeyError(tc.err); got != tc.want {
+			t.Errorf("%+v 的密钥失效判断错误: %v", tc.err, got)
+		}
+	}
+
+	// 流中出现无法解析的数据块时，关闭后计为密钥失败
+	malformed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: {not json}\n\ndata: [DONE]\n\n"))
+	}))
+	defer malformed.Close()
+	client = NewClient(NewConfig(malformed.URL, "").WithAPIKeys("sk-stream"))
+	stream, err = client.ChatCompletionStream(context.Background(), NewRequest("m").Messages(NewMessageBuilder().User("hi").Build()).Build())
+	if err != nil {
+		t.Fatalf("流式请求失败: %v", err)
+	}
+	if _, err := stream.Recv(); err == nil {
+		t.Errorf("无法解析的数据块应该返回错误")
+	}
+	stream.Close()
+	if stats := client.KeyStats(); stats[0].Failures != 1 || stats[0].InFlight != 0 || !strings.Contains(stats[0].LastError, "unmarshal") {
+		t.Errorf("解析失败应该计入密钥统计: %+v", stats[0])
+	}
+
+	t.Logf("密钥池测试通过")
+}
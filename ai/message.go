@@ -1,8 +1,11 @@
 package ai
 
+import "fmt"
+
 // MessageBuilder 消息构建器
 type MessageBuilder struct {
 	messages []Message
+	err      error
 }
 
 // NewMessageBuilder 创建消息构建器
@@ -16,7 +19,7 @@ func NewMessageBuilder() *MessageBuilder {
 func (b *MessageBuilder) System(content string) *MessageBuilder {
 	b.messages = append(b.messages, Message{
 		Role:    "system",
-		Content: content,
+		Content: TextContent(content),
 	})
 	return b
 }
@@ -25,36 +28,33 @@ func (b *MessageBuilder) System(content string) *MessageBuilder {
 func (b *MessageBuilder) User(content string) *MessageBuilder {
 	b.messages = append(b.messages, Message{
 		Role:    "user",
-		Content: content,
+		Content: TextContent(content),
 	})
 	return b
 }
 
 // UserWithImages 添加用户消息（带图片）
 func (b *MessageBuilder) UserWithImages(text string, imageUrls ...string) *MessageBuilder {
-	var content []map[string]interface{}
+	var parts []ContentPart
 
 	// 添加文本内容
 	if text != "" {
-		content = append(content, map[string]interface{}{
-			"type": "text",
-			"text": text,
-		})
+		parts = append(parts, TextPart(text))
 	}
 
 	// 添加图片内容
 	for _, url := range imageUrls {
-		content = append(content, map[string]interface{}{
-			"type": "image_url",
-			"image_url": map[string]interface{}{
-				"url": url,
-			},
-		})
+		parts = append(parts, ImagePart(url, ""))
 	}
 
+	return b.UserWithParts(parts...)
+}
+
+// UserWithParts 添加由多模态片段组成的用户消息
+func (b *MessageBuilder) UserWithParts(parts ...ContentPart) *MessageBuilder {
 	b.messages = append(b.messages, Message{
 		Role:    "user",
-		Content: content,
+		Content: PartsContent(parts...),
 	})
 	return b
 }
@@ -63,38 +63,86 @@ func (b *MessageBuilder) UserWithImages(text string, imageUrls ...string) *Messa
 func (b *MessageBuilder) Assistant(content string) *MessageBuilder {
 	b.messages = append(b.messages, Message{
 		Role:    "assistant",
-		Content: content,
+		Content: TextContent(content),
 	})
 	return b
 }
 
-// AssistantWithTools 添加带工具调用的助手消息
+// AssistantWithTools 添加带工具调用的助手消息，内容为空时按协议发送 null
 func (b *MessageBuilder) AssistantWithTools(content string, toolCalls ...ToolCall) *MessageBuilder {
-	b.messages = append(b.messages, Message{
+	message := Message{
 		Role:      "assistant",
-		Content:   content,
 		ToolCalls: toolCalls,
-	})
+	}
+	if content != "" {
+		message.Content = TextContent(content)
+	}
+	b.messages = append(b.messages, message)
+	return b
+}
+
+// AssistantMessage 原样添加模型返回的助手消息（保留工具调用、拒答和推理内容）
+func (b *MessageBuilder) AssistantMessage(message *Message) *MessageBuilder {
+	if message == nil {
+		return b
+	}
+	msg := *message
+	msg.Role = "assistant"
+	b.messages = append(b.messages, msg)
 	return b
 }
 
 // Tool 添加工具消息
 func (b *MessageBuilder) Tool(toolCallId, content string) *MessageBuilder {
 	b.messages = append(b.messages, Message{
-		Role:    "tool",
-		Content: content,
-		Name:    toolCallId,
+		Role:       "tool",
+		Content:    TextContent(content),
+		ToolCallID: toolCallId,
 	})
 	return b
 }
 
 // Build 构建消息数组
+//
+// Err() 不为 nil 时结果不完整：出错的消息（如附件读取失败的用户消息）没有被添加。
+// 使用附件时应改用 BuildE 或 MustBuild，避免发出缺少用户消息的对话。
 func (b *MessageBuilder) Build() []Message {
 	return b.messages
 }
 
+// BuildE 构建消息数组，构建过程中出错时返回第一个错误和 nil
+func (b *MessageBuilder) BuildE() ([]Message, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.messages, nil
+}
+
+// MustBuild 构建消息数组，构建过程中出错时 panic
+func (b *MessageBuilder) MustBuild() []Message {
+	messages, err := b.BuildE()
+	if err != nil {
+		panic(fmt.Sprintf("ai: failed to build messages: %v", err))
+	}
+	return messages
+}
+
+// Err 返回构建过程中遇到的第一个错误（如附件读取失败），出错的消息不会被添加
+func (b *MessageBuilder) Err() error {
+	return b.err
+}
+
+// fail 记录第一个错误
+func (b *MessageBuilder) fail(err error) *MessageBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
 // Clear 清空消息
 func (b *MessageBuilder) Clear() *MessageBuilder {
 	b.messages = b.messages[:0]
+	b.err = nil
 	return b
 }
@@ -0,0 +1,171 @@
+package ai
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loadTestdata 读取录制的 OpenAI 格式报文
+func loadTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("读取测试数据%s失败: %v", name, err)
+	}
+	return data
+}
+
+// normalizeJSON 规范化 JSON 以便比较，去掉除 content 以外值为 null 的键
+func normalizeJSON(t *testing.T, data []byte) string {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("解析JSON失败: %v", err)
+	}
+	return compactJSON(dropNulls(v))
+}
+
+func dropNulls(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, item := range value {
+			if item == nil && k != "content" {
+				delete(value, k)
+				continue
+			}
+			value[k] = dropNulls(item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = dropNulls(item)
+		}
+	}
+	return v
+}
+
+// TestToolMessageRoundTrip 测试工具调用多轮对话报文往返
+func TestToolMessageRoundTrip(t *testing.T) {
+	var resp ChatResponse
+	if err := json.Unmarshal(loadTestdata(t, "tool_call_response.json"), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+
+	assistant := resp.Choices[0].Message
+	if len(assistant.ToolCalls) != 1 || !assistant.Content.IsEmpty() {
+		t.Fatalf("工具调用响应解析错误: %+v", assistant)
+	}
+
+	call := assistant.ToolCalls[0]
+	messages := NewMessageBuilder().
+		User("请帮我查询北京的天气").
+		AssistantWithTools("", call).
+		Tool(call.ID, `{"temperature":22,"condition":"晴"}`).
+		Build()
+
+	if messages[2].ToolCallID != call.ID || messages[2].Name != "" {
+		t.Errorf("工具消息应该使用tool_call_id，实际: %+v", messages[2])
+	}
+
+	req := NewRequest("gpt-4.1").
+		Messages(messages).
+		Tools(NewToolBuilder().AddWeatherFunction().Build()...).
+		Build()
+
+	got, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("序列化请求失败: %v", err)
+	}
+
+	want := normalizeJSON(t, loadTestdata(t, "tool_call_followup_request.json"))
+	if normalizeJSON(t, got) != want {
+		t.Errorf("后续请求与录制报文不一致\n期望: %s\n实际: %s", want, got)
+	}
+
+	// 原样回填助手消息也应得到相同的报文
+	viaMessage := NewMessageBuilder().
+		User("请帮我查询北京的天气").
+		AssistantMessage(assistant).
+		Tool(call.ID, `{"temperature":22,"condition":"晴"}`).
+		Build()
+	req.Messages = viaMessage
+	got, _ = json.Marshal(req)
+	if normalizeJSON(t, got) != want {
+		t.Errorf("回填助手消息后的请求与录制报文不一致: %s", got)
+	}
+
+	t.Logf("工具消息往返测试通过")
+}
+
+// TestReasoningAndRefusalFields 测试推理内容和拒答字段
+func TestReasoningAndRefusalFields(t *testing.T) {
+	raw := loadTestdata(t, "reasoning_refusal_response.json")
+
+	var resp ChatResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+
+	msg := resp.Choices[0].Message
+	if msg.ReasoningContent == "" || msg.Refusal == "" {
+		t.Fatalf("推理内容或拒答字段丢失: %+v", msg)
+	}
+
+	var original struct {
+		Choices []struct {
+			Message json.RawMessage `json:"message"`
+		} `json:"choices"`
+	}
+	json.Unmarshal(raw, &original)
+
+	encoded, _ := json.Marshal(msg)
+	if normalizeJSON(t, encoded) != normalizeJSON(t, original.Choices[0].Message) {
+		t.Errorf("消息往返不一致\n期望: %s\n实际: %s", original.Choices[0].Message, encoded)
+	}
+
+	t.Logf("推理内容和拒答字段测试通过")
+}
+
+// TestMessageContentJSON 测试消息内容的字符串/数组/null 编解码
+func TestMessageContentJSON(t *testing.T) {
+	cases := []struct {
+		name    string
+		content MessageContent
+		want    string
+	}{
+		{"文本", TextContent("你好"), `"你好"`},
+		{"显式空文本", TextContent(""), `""`},
+		{"空内容", MessageContent{}, `null`},
+		{"图片细节", PartsContent(TextPart("看图"), ImagePart("https://example.com/a.png", ImageDetailHigh)),
+			`[{"type":"text","text":"看图"},{"type":"image_url","image_url":{"url":"https://example.com/a.png","detail":"high"}}]`},
+		{"音频和文件", PartsContent(AudioPart("UklGRg==", "wav"), FilePart("a.pdf", "data:application/pdf;base64,JVBERi0=")),
+			`[{"type":"input_audio","input_audio":{"data":"UklGRg==","format":"wav"}},{"type":"file","file":{"file_data":"data:application/pdf;base64,JVBERi0=","filename":"a.pdf"}}]`},
+	}
+
+	for _, tc := range cases {
+		got, err := json.Marshal(tc.content)
+		if err != nil {
+			t.Fatalf("%s: 序列化失败: %v", tc.name, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: 期望%s，实际%s", tc.name, tc.want, got)
+		}
+
+		var decoded MessageContent
+		if err := json.Unmarshal(got, &decoded); err != nil {
+			t.Fatalf("%s: 反序列化失败: %v", tc.name, err)
+		}
+		again, _ := json.Marshal(decoded)
+		if string(again) != tc.want {
+			t.Errorf("%s: 往返不一致，期望%s，实际%s", tc.name, tc.want, again)
+		}
+	}
+
+	var bad MessageContent
+	if err := json.Unmarshal([]byte(`42`), &bad); err == nil {
+		t.Error("数字内容应该返回错误")
+	}
+
+	t.Logf("消息内容编解码测试通过")
+}
@@ -0,0 +1,81 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+)
+
+// ChatHandler 处理一次非流式聊天请求
+type ChatHandler func(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
+
+// StreamHandler 处理一次流式聊天请求
+type StreamHandler func(ctx context.Context, req *ChatRequest) (*StreamReader, error)
+
+// ChatMiddleware 包装 ChatHandler，可以修改请求、记录日志或统计指标
+//
+// 中间件在模型解析和默认参数填充之后、查缓存之前调用，回退链中的每个模型各调用一次。
+// 传入的请求是浅拷贝，可以直接修改字段；修改 Messages 等切片或 Extra 的内容前应先复制。
+type ChatMiddleware func(next ChatHandler) ChatHandler
+
+// StreamMiddleware 包装 StreamHandler，调用时机与 ChatMiddleware 相同
+//
+// 需要读取完整结果时可以在返回的流上注册 OnComplete。
+type StreamMiddleware func(next StreamHandler) StreamHandler
+
+// TransportMiddleware 包装 HTTP 传输层，可以注入请求头、记录原始请求和响应
+//
+// 传输层中间件对每次 HTTP 请求调用，包括密钥轮换和端点转移产生的重试。
+type TransportMiddleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc 把函数适配为 http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip 调用 f(req)
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// chatHandler 用配置的中间件包装 h，第一个中间件在最外层
+func (c *Config) chatHandler(h ChatHandler) ChatHandler {
+	for i := len(c.Middlewares) - 1; i >= 0; i-- {
+		h = c.Middlewares[i](h)
+	}
+	return h
+}
+
+// streamHandler 用配置的流式中间件包装 h，第一个中间件在最外层
+func (c *Config) streamHandler(h StreamHandler) StreamHandler {
+	for i := len(c.StreamMiddlewares) - 1; i >= 0; i-- {
+		h = c.StreamMiddlewares[i](h)
+	}
+	return h
+}
+
+// newHTTPClient 用传输层中间件包装 base，创建发送请求的 HTTP 客户端
+//
+// 设置了 HTTPClient 时复制它并替换传输层，其超时、Cookie 和重定向设置保持不变。
+func (c *Config) newHTTPClient(base http.RoundTripper) *http.Client {
+	for i := len(c.TransportMiddlewares) - 1; i >= 0; i-- {
+		base = c.TransportMiddlewares[i](base)
+	}
+	if c.HTTPClient != nil {
+		client := *c.HTTPClient
+		client.Transport = base
+		return &client
+	}
+	return &http.Client{Timeout: c.Timeout, Transport: base}
+}
+
+// customTransport 返回 HTTPClient 或 Transport 提供的传输层，都未设置时返回 nil
+func (c *Config) customTransport() http.RoundTripper {
+	switch {
+	case c.HTTPClient != nil:
+		if c.HTTPClient.Transport != nil {
+			return c.HTTPClient.Transport
+		}
+		return http.DefaultTransport
+	case c.Transport != nil:
+		return c.Transport
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMiddleware 测试请求中间件和传输层中间件
+func TestMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body ChatRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		content := body.Model + "|" + r.Header.Get("X-Trace") + "|" + body.Messages[0].Content.Text
+		if r.Header.Get("Accept") == "text/event-stream" {
+			w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"" + content + "\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n"))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"` + content + `"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	var order []string
+	trace := func(name string) ChatMiddleware {
+		return func(next ChatHandler) ChatHandler {
+			return func(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+				order = append(order, name+":"+req.Model)
+				resp, err := next(ctx, req)
+				order = append(order, name+":"+resp.ServedModel)
+				return resp, err
+			}
+		}
+	}
+	// 脱敏：替换消息内容，复制切片以免修改调用方的请求
+	redact := func(next ChatHandler) ChatHandler {
+		return func(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+			req.Messages = append([]Message(nil), req.Messages...)
+			req.Messages[0].Content = TextContent(strings.ReplaceAll(req.Messages[0].Content.Text, "secret", "***"))
+			return next(ctx, req)
+		}
+	}
+	var transported int
+	config := NewConfig(server.URL, "k").WithModel(ModelRoleChat, "gpt").
+		Use(trace("outer"), trace("inner"), redact).
+		UseTransport(func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				transported++
+				req.Header.Set("X-Trace", "t1")
+				return next.RoundTrip(req)
+			})
+		})
+	client := NewClient(config)
+
+	req := NewRequest("").Messages(NewMessageBuilder().User("my secret").Build()).Build()
+	resp, err := client.ChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	if got := ExtractContent(resp.Choices[0].Message); got != "gpt|t1|my ***" {
+		t.Errorf("中间件的修改没有生效: %s", got)
+	}
+	if strings.Join(order, ",") != "outer:gpt,inner:gpt,inner:gpt,outer:gpt" {
+		t.Errorf("中间件的调用顺序错误: %v", order)
+	}
+	if req.Model != "" || req.Messages[0].Content.Text != "my secret" || transported != 1 {
+		t.Errorf("中间件不应修改调用方的请求: %+v", req)
+	}
+
+	// 流式中间件可以在流上注册完成回调
+	var completed string
+	config.UseStream(func(next StreamHandler) StreamHandler {
+		return func(ctx context.Context, req *ChatRequest) (*StreamReader, error) {
+			req.Model = "stream-" + req.Model
+			stream, err := next(ctx, req)
+			if err == nil {
+				stream.OnComplete(func(resp *ChatResponse) { completed = ExtractContent(resp.Choices[0].Message) })
+			}
+			return stream, err
+		}
+	})
+	client.SetConfig(config)
+	stream, err := client.ChatCompletionStream(context.Background(), NewRequest("").Messages(NewMessageBuilder().User("hi").Build()).Build())
+	if err != nil {
+		t.Fatalf("流式请求失败: %v", err)
+	}
+	if _, err := stream.Collect(); err != nil || completed != "stream-gpt|t1|hi" || stream.ServedModel() != "stream-gpt" {
+		t.Errorf("流式中间件错误: %q %v", completed, err)
+	}
+
+	t.Logf("中间件测试通过")
+}
+
+// TestCustomTransport 测试自定义 HTTP 客户端和传输层
+func TestCustomTransport(t *testing.T) {
+	var seen []string
+	fake := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		seen = append(seen, req.URL.String()+" "+req.Header.Get("X-Mw"))
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"fake"}}]}`))),
+			Request:    req,
+		}, nil
+	})
+	header := func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Mw", "1")
+			return next.RoundTrip(req)
+		})
+	}
+	request := func() *ChatRequest {
+		return NewRequest("m").Messages(NewMessageBuilder().User("hi").Build()).Build()
+	}
+
+	client := NewClient(NewConfig("http://example.invalid", "k").WithTransport(fake).UseTransport(header))
+	resp, err := client.ChatCompletion(context.Background(), request())
+	if err != nil || ExtractContent(resp.Choices[0].Message) != "fake" {
+		t.Fatalf("自定义传输层的请求失败: %v", err)
+	}
+	if len(seen) != 1 || seen[0] != "http://example.invalid/v1/chat/completions 1" {
+		t.Errorf("请求没有经过自定义传输层: %v", seen)
+	}
+
+	// 自定义 HTTP 客户端保留自身设置，调用方的客户端不被修改
+	hc := &http.Client{Transport: fake}
+	client = NewClient(NewConfig("http://example.invalid", "k").WithHTTPClient(hc).UseTransport(header))
+	if _, err := client.ChatCompletion(context.Background(), request()); err != nil || len(seen) != 2 || seen[1] != "http://example.invalid/v1/chat/completions 1" {
+		t.Errorf("自定义 HTTP 客户端的请求失败: %v %v", seen, err)
+	}
+	if _, ok := hc.Transport.(RoundTripperFunc); !ok || client.load().http == hc {
+		t.Errorf("不应修改调用方的 HTTP 客户端")
+	}
+
+	err = NewConfig("http://example.invalid", "k").WithHTTPClient(hc).WithTransport(fake).WithProxy("http://127.0.0.1:1").Validate()
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || len(configErr.Problems) != 2 {
+		t.Errorf("自定义传输层与代理冲突时应该报错: %v", err)
+	}
+
+	t.Logf("自定义传输层测试通过")
+}
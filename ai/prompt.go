@@ -0,0 +1,808 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+// ErrPromptNotFound 提示词不存在
+var ErrPromptNotFound = errors.New("prompt not found")
+
+// 变量类型
+const (
+	PromptVarString = "string"
+	PromptVarInt    = "int"
+	PromptVarNumber = "number"
+	PromptVarBool   = "bool"
+	PromptVarList   = "list"
+	PromptVarObject = "object"
+)
+
+// PromptVariable 模板变量定义
+type PromptVariable struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type,omitempty"` // 为空时不检查类型
+	Required    bool        `json:"required,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+// PromptMessage 模板中的一条消息，Content 为 text/template 文本
+type PromptMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// PromptError 提示词编译、校验或渲染失败
+type PromptError struct {
+	Prompt   string
+	Problems []string
+}
+
+func (e *PromptError) Error() string {
+	return fmt.Sprintf("prompt %s: %s", e.Prompt, strings.Join(e.Problems, "; "))
+}
+
+// PromptTemplate 基于 text/template 的提示词模板
+//
+// 消息内容中通过 {{.name}} 引用变量，通过 {{template "partial" .}} 引用片段。
+// 渲染时缺失的变量会返回错误，而不是输出 <no value>。
+type PromptTemplate struct {
+	Name        string            `json:"name"`
+	Version     string            `json:"version,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Model       string            `json:"model,omitempty"`
+	Defaults    RequestDefaults   `json:"defaults"`
+	Variables   []PromptVariable  `json:"variables,omitempty"`
+	Partials    map[string]string `json:"partials,omitempty"`
+	Messages    []PromptMessage   `json:"messages"`
+
+	compiled *template.Template
+}
+
+// NewPromptTemplate 创建提示词模板
+func NewPromptTemplate(name string) *PromptTemplate {
+	return &PromptTemplate{Name: name}
+}
+
+// System 添加系统消息模板
+func (p *PromptTemplate) System(text string) *PromptTemplate {
+	return p.Message("system", text)
+}
+
+// User 添加用户消息模板
+func (p *PromptTemplate) User(text string) *PromptTemplate {
+	return p.Message("user", text)
+}
+
+// Assistant 添加助手消息模板
+func (p *PromptTemplate) Assistant(text string) *PromptTemplate {
+	return p.Message("assistant", text)
+}
+
+// Message 添加任意角色的消息模板
+func (p *PromptTemplate) Message(role, text string) *PromptTemplate {
+	p.Messages = append(p.Messages, PromptMessage{Role: role, Content: text})
+	p.compiled = nil
+	return p
+}
+
+// Variable 声明变量
+func (p *PromptTemplate) Variable(v PromptVariable) *PromptTemplate {
+	p.Variables = append(p.Variables, v)
+	p.compiled = nil
+	return p
+}
+
+// Partial 添加模板内的片段
+func (p *PromptTemplate) Partial(name, text string) *PromptTemplate {
+	if p.Partials == nil {
+		p.Partials = make(map[string]string)
+	}
+	p.Partials[name] = text
+	p.compiled = nil
+	return p
+}
+
+// Compile 预先编译模板并检查引用的变量是否都已声明
+//
+// 未调用 Compile 时，Render 每次都会临时编译。编译后的模板可以被并发渲染。
+func (p *PromptTemplate) Compile() error {
+	compiled, err := p.compile(nil)
+	if err != nil {
+		return err
+	}
+	p.compiled = compiled
+	return nil
+}
+
+// promptFuncs 模板中可用的函数
+var promptFuncs = template.FuncMap{
+	"join":  func(sep string, items interface{}) string { return strings.Join(stringList(items), sep) },
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"default": func(fallback, v interface{}) interface{} {
+		if v == nil || reflect.ValueOf(v).IsZero() {
+			return fallback
+		}
+		return v
+	},
+}
+
+// stringList 把列表转为字符串切片
+func stringList(items interface{}) []string {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return []string{fmt.Sprint(items)}
+	}
+	out := make([]string, v.Len())
+	for i := range out {
+		out[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return out
+}
+
+// messageTemplateName 返回第 i 条消息的模板名
+func messageTemplateName(i int) string {
+	return "message#" + strconv.Itoa(i)
+}
+
+// compile 编译消息和片段，shared 为提示词库中的公共片段
+func (p *PromptTemplate) compile(shared map[string]string) (*template.Template, error) {
+	promptErr := &PromptError{Prompt: p.Name}
+	if len(p.Messages) == 0 {
+		promptErr.Problems = append(promptErr.Problems, "no messages")
+	}
+
+	root := template.New(p.Name).Option("missingkey=error").Funcs(promptFuncs)
+	partials := make(map[string]string, len(shared)+len(p.Partials))
+	for name, text := range shared {
+		partials[name] = text
+	}
+	for name, text := range p.Partials {
+		partials[name] = text
+	}
+	for _, name := range sortedKeys(partials) {
+		if _, err := root.New(name).Parse(partials[name]); err != nil {
+			promptErr.Problems = append(promptErr.Problems, fmt.Sprintf("partial %s: %v", name, err))
+		}
+	}
+
+	for i, msg := range p.Messages {
+		switch msg.Role {
+		case "system", "developer", "user", "assistant":
+		default:
+			promptErr.Problems = append(promptErr.Problems, fmt.Sprintf("message %d: invalid role %q", i, msg.Role))
+		}
+		if _, err := root.New(messageTemplateName(i)).Parse(msg.Content); err != nil {
+			promptErr.Problems = append(promptErr.Problems, fmt.Sprintf("message %d: %v", i, err))
+		}
+	}
+	if len(promptErr.Problems) > 0 {
+		return nil, promptErr
+	}
+
+	// 声明了变量时，模板中引用的每个变量都必须已声明
+	if len(p.Variables) > 0 {
+		declared := make(map[string]bool, len(p.Variables))
+		for _, v := range p.Variables {
+			declared[v.Name] = true
+		}
+		refs := make(map[string]bool)
+		for i := range p.Messages {
+			collectTemplateFields(root, root.Lookup(messageTemplateName(i)).Tree.Root, refs, make(map[string]bool), true)
+		}
+		for _, name := range sortedKeys(refs) {
+			if !declared[name] {
+				promptErr.Problems = append(promptErr.Problems, fmt.Sprintf("variable %s is used but not declared", name))
+			}
+		}
+	}
+	for _, v := range p.Variables {
+		if v.Name == "" {
+			promptErr.Problems = append(promptErr.Problems, "variable without name")
+		}
+		switch v.Type {
+		case "", PromptVarString, PromptVarInt, PromptVarNumber, PromptVarBool, PromptVarList, PromptVarObject:
+		default:
+			promptErr.Problems = append(promptErr.Problems, fmt.Sprintf("variable %s: unknown type %q", v.Name, v.Type))
+		}
+	}
+	if len(promptErr.Problems) > 0 {
+		return nil, promptErr
+	}
+	return root, nil
+}
+
+// collectTemplateFields 收集模板在顶层数据上引用的字段名
+//
+// range 和 with 的主体中 . 指向其他数据，只收集其中通过 $ 引用的字段。
+func collectTemplateFields(set *template.Template, node parse.Node, refs, visited map[string]bool, topDot bool) {
+	switch n := node.(type) {
+	case nil:
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectTemplateFields(set, child, refs, visited, topDot)
+		}
+	case *parse.ActionNode:
+		collectTemplateFields(set, n.Pipe, refs, visited, topDot)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectTemplateFields(set, cmd, refs, visited, topDot)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectTemplateFields(set, arg, refs, visited, topDot)
+		}
+	case *parse.FieldNode:
+		if topDot && len(n.Ident) > 0 {
+			refs[n.Ident[0]] = true
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			refs[n.Ident[1]] = true
+		}
+	case *parse.IfNode:
+		collectTemplateFields(set, n.Pipe, refs, visited, topDot)
+		collectTemplateFields(set, n.List, refs, visited, topDot)
+		collectTemplateFields(set, n.ElseList, refs, visited, topDot)
+	case *parse.RangeNode:
+		collectTemplateFields(set, n.Pipe, refs, visited, topDot)
+		collectTemplateFields(set, n.List, refs, visited, false)
+		collectTemplateFields(set, n.ElseList, refs, visited, topDot)
+	case *parse.WithNode:
+		collectTemplateFields(set, n.Pipe, refs, visited, topDot)
+		collectTemplateFields(set, n.List, refs, visited, false)
+		collectTemplateFields(set, n.ElseList, refs, visited, topDot)
+	case *parse.TemplateNode:
+		collectTemplateFields(set, n.Pipe, refs, visited, topDot)
+		// 以 . 调用的片段在同一数据上渲染
+		passesDot := topDot && n.Pipe != nil && len(n.Pipe.Cmds) == 1 && len(n.Pipe.Cmds[0].Args) == 1
+		if passesDot {
+			_, passesDot = n.Pipe.Cmds[0].Args[0].(*parse.DotNode)
+		}
+		if tmpl := set.Lookup(n.Name); tmpl != nil && tmpl.Tree != nil && passesDot && !visited[n.Name] {
+			visited[n.Name] = true
+			collectTemplateFields(set, tmpl.Tree.Root, refs, visited, true)
+		}
+	}
+}
+
+// Render 渲染模板，vars 可以是 map[string]interface{}、map[string]string 或结构体
+func (p *PromptTemplate) Render(vars interface{}) ([]Message, error) {
+	compiled := p.compiled
+	if compiled == nil {
+		var err error
+		if compiled, err = p.compile(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	values, err := p.resolveVariables(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]Message, 0, len(p.Messages))
+	for i, msg := range p.Messages {
+		var buf bytes.Buffer
+		if err := compiled.ExecuteTemplate(&buf, messageTemplateName(i), values); err != nil {
+			return nil, &PromptError{Prompt: p.Name, Problems: []string{fmt.Sprintf("message %d: %v", i, err)}}
+		}
+		messages = append(messages, Message{Role: msg.Role, Content: TextContent(buf.String())})
+	}
+	return messages, nil
+}
+
+// Request 渲染模板并生成请求，使用模板的模型和默认参数
+func (p *PromptTemplate) Request(vars interface{}) (*ChatRequest, error) {
+	messages, err := p.Render(vars)
+	if err != nil {
+		return nil, err
+	}
+	req := NewRequest(p.Model).Messages(messages).Build()
+	p.Defaults.fill(req)
+	return req, nil
+}
+
+// Prompt 渲染提示词模板并添加其中的消息，渲染失败时记录错误
+func (b *MessageBuilder) Prompt(p *PromptTemplate, vars interface{}) *MessageBuilder {
+	messages, err := p.Render(vars)
+	if err != nil {
+		return b.fail(err)
+	}
+	b.messages = append(b.messages, messages...)
+	return b
+}
+
+// resolveVariables 合并默认值并校验必填变量和类型
+func (p *PromptTemplate) resolveVariables(vars interface{}) (map[string]interface{}, error) {
+	values, err := variableMap(vars)
+	if err != nil {
+		return nil, &PromptError{Prompt: p.Name, Problems: []string{err.Error()}}
+	}
+
+	var problems []string
+	for _, v := range p.Variables {
+		value, ok := values[v.Name]
+		if !ok || value == nil {
+			if v.Default != nil {
+				value, ok = v.Default, true
+			} else if v.Required {
+				problems = append(problems, fmt.Sprintf("missing required variable %s", v.Name))
+				continue
+			} else {
+				// 可选变量未提供时渲染为空值
+				values[v.Name] = zeroVariable(v.Type)
+				continue
+			}
+		}
+		converted, err := convertVariable(value, v.Type)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("variable %s: %v", v.Name, err))
+			continue
+		}
+		values[v.Name] = converted
+	}
+	if len(problems) > 0 {
+		return nil, &PromptError{Prompt: p.Name, Problems: problems}
+	}
+	return values, nil
+}
+
+// variableMap 把渲染参数转为映射
+func variableMap(vars interface{}) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	if vars == nil {
+		return values, nil
+	}
+
+	v := reflect.ValueOf(vars)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return values, nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("variables map must have string keys")
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			values[iter.Key().String()] = iter.Value().Interface()
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Name
+			if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+			values[name] = v.Field(i).Interface()
+		}
+	default:
+		return nil, fmt.Errorf("variables must be a map or struct, got %T", vars)
+	}
+	return values, nil
+}
+
+// zeroVariable 返回类型的零值
+func zeroVariable(typ string) interface{} {
+	switch typ {
+	case PromptVarInt:
+		return 0
+	case PromptVarNumber:
+		return 0.0
+	case PromptVarBool:
+		return false
+	case PromptVarList:
+		return []interface{}{}
+	case PromptVarObject:
+		return map[string]interface{}{}
+	default:
+		return ""
+	}
+}
+
+// convertVariable 检查变量类型，必要时把数字转为 int
+func convertVariable(value interface{}, typ string) (interface{}, error) {
+	v := reflect.ValueOf(value)
+	kind := v.Kind()
+	switch typ {
+	case "":
+		return value, nil
+	case PromptVarString:
+		if kind == reflect.String {
+			return value, nil
+		}
+	case PromptVarInt:
+		switch {
+		case kind >= reflect.Int && kind <= reflect.Int64:
+			return int(v.Int()), nil
+		case kind >= reflect.Uint && kind <= reflect.Uint64:
+			return int(v.Uint()), nil
+		case kind == reflect.Float32 || kind == reflect.Float64:
+			if f := v.Float(); f == math.Trunc(f) {
+				return int(f), nil
+			}
+		}
+	case PromptVarNumber:
+		if kind >= reflect.Int && kind <= reflect.Float64 {
+			return value, nil
+		}
+	case PromptVarBool:
+		if kind == reflect.Bool {
+			return value, nil
+		}
+	case PromptVarList:
+		if kind == reflect.Slice || kind == reflect.Array {
+			return value, nil
+		}
+	case PromptVarObject:
+		if kind == reflect.Map || kind == reflect.Struct || (kind == reflect.Pointer && v.Elem().Kind() == reflect.Struct) {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("expected %s, got %T", typ, value)
+}
+
+// sortedKeys 返回排序后的键
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PromptLibrary 按名称和版本管理的提示词库，可被并发读取
+type PromptLibrary struct {
+	mu       sync.RWMutex
+	prompts  map[string][]*PromptTemplate // 按版本升序
+	partials map[string]string
+}
+
+// NewPromptLibrary 创建空的提示词库
+func NewPromptLibrary() *PromptLibrary {
+	return &PromptLibrary{
+		prompts:  make(map[string][]*PromptTemplate),
+		partials: make(map[string]string),
+	}
+}
+
+// LoadPromptLibrary 从目录加载提示词库
+func LoadPromptLibrary(dir string) (*PromptLibrary, error) {
+	lib := NewPromptLibrary()
+	if err := lib.LoadDir(dir); err != nil {
+		return nil, err
+	}
+	return lib, nil
+}
+
+// AddPartial 添加所有提示词共享的片段，需要在添加使用它的提示词之前调用
+func (l *PromptLibrary) AddPartial(name, text string) *PromptLibrary {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.partials[name] = text
+	return l
+}
+
+// Add 编译并添加提示词，同名同版本的提示词会被替换
+func (l *PromptLibrary) Add(p *PromptTemplate) error {
+	if p.Name == "" {
+		return &PromptError{Prompt: "(unnamed)", Problems: []string{"name is required"}}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	compiled, err := p.compile(l.partials)
+	if err != nil {
+		return err
+	}
+	p.compiled = compiled
+
+	versions := l.prompts[p.Name]
+	for i, existing := range versions {
+		if existing.Version == p.Version {
+			versions[i] = p
+			return nil
+		}
+	}
+	versions = append(versions, p)
+	sort.SliceStable(versions, func(i, j int) bool {
+		return compareVersions(versions[i].Version, versions[j].Version) < 0
+	})
+	l.prompts[p.Name] = versions
+	return nil
+}
+
+// Get 返回提示词的最新版本
+func (l *PromptLibrary) Get(name string) (*PromptTemplate, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	versions := l.prompts[name]
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPromptNotFound, name)
+	}
+	return versions[len(versions)-1], nil
+}
+
+// GetVersion 返回提示词的指定版本
+func (l *PromptLibrary) GetVersion(name, version string) (*PromptTemplate, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, p := range l.prompts[name] {
+		if p.Version == version {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s@%s", ErrPromptNotFound, name, version)
+}
+
+// Names 返回所有提示词名称
+func (l *PromptLibrary) Names() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return sortedKeys(l.prompts)
+}
+
+// Versions 返回提示词的所有版本，按升序排列
+func (l *PromptLibrary) Versions(name string) []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var versions []string
+	for _, p := range l.prompts[name] {
+		versions = append(versions, p.Version)
+	}
+	return versions
+}
+
+// Render 渲染提示词的最新版本
+func (l *PromptLibrary) Render(name string, vars interface{}) ([]Message, error) {
+	p, err := l.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.Render(vars)
+}
+
+// LoadDir 递归加载目录中的提示词文件
+//
+// 支持 .yaml/.yml 和带 front-matter 的 .md 文件。文件名形如 name@v2.yaml 时，
+// 名称和版本取自文件名，front-matter 中的 name 和 version 优先。
+// 以 _ 开头的文件或 partials 目录中的文件作为共享片段，片段名为去掉 _ 和扩展名的文件名。
+func (l *PromptLibrary) LoadDir(dir string) error {
+	var partialFiles, promptFiles []string
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		base := entry.Name()
+		if strings.HasPrefix(base, ".") {
+			return nil
+		}
+		if strings.HasPrefix(base, "_") || filepath.Base(filepath.Dir(path)) == "partials" {
+			partialFiles = append(partialFiles, path)
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(base)) {
+		case ".yaml", ".yml", ".md":
+			promptFiles = append(promptFiles, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range partialFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		_, body, err := splitFrontMatter(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		name := strings.TrimPrefix(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), "_")
+		l.AddPartial(name, strings.TrimSuffix(body, "\n"))
+	}
+
+	for _, path := range promptFiles {
+		p, err := ParsePromptFile(path)
+		if err != nil {
+			return err
+		}
+		if err := l.Add(p); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// ParsePromptFile 解析单个提示词文件
+func ParsePromptFile(path string) (*PromptTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p *PromptTemplate
+	if strings.ToLower(filepath.Ext(path)) == ".md" {
+		p, err = ParsePromptMarkdown(data)
+	} else {
+		p, err = ParsePromptYAML(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	name, version, _ := strings.Cut(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), "@")
+	if p.Name == "" {
+		p.Name = name
+	}
+	if p.Version == "" {
+		p.Version = version
+	}
+	return p, nil
+}
+
+// promptFile 提示词文件格式，system 和 user 是只有一两条消息时的简写
+type promptFile struct {
+	PromptTemplate
+	Role   string `json:"role,omitempty"`
+	System string `json:"system,omitempty"`
+	User   string `json:"user,omitempty"`
+}
+
+// ParsePromptYAML 解析 YAML 格式的提示词
+func ParsePromptYAML(data []byte) (*PromptTemplate, error) {
+	var file promptFile
+	if err := decodeYAML(data, &file); err != nil {
+		return nil, err
+	}
+	p := &file.PromptTemplate
+	if file.System != "" {
+		p.Messages = append([]PromptMessage{{Role: "system", Content: file.System}}, p.Messages...)
+	}
+	if file.User != "" {
+		p.Messages = append(p.Messages, PromptMessage{Role: "user", Content: file.User})
+	}
+	return p, nil
+}
+
+// ParsePromptMarkdown 解析带 YAML front-matter 的 Markdown 提示词
+//
+// 正文按 "## system"、"## user"、"## assistant" 等标题拆分为消息；
+// 没有角色标题时整个正文作为一条消息，角色取 front-matter 中的 role，默认为 system。
+func ParsePromptMarkdown(data []byte) (*PromptTemplate, error) {
+	front, body, err := splitFrontMatter(data)
+	if err != nil {
+		return nil, err
+	}
+	var file promptFile
+	if front != "" {
+		if err := decodeYAML([]byte(front), &file); err != nil {
+			return nil, fmt.Errorf("front-matter: %w", err)
+		}
+	}
+	p := &file.PromptTemplate
+
+	role := file.Role
+	if role == "" {
+		role = "system"
+	}
+	var current *PromptMessage
+	var preamble []string
+	for _, line := range strings.Split(body, "\n") {
+		if heading, ok := strings.CutPrefix(line, "## "); ok {
+			switch name := strings.ToLower(strings.TrimSpace(heading)); name {
+			case "system", "developer", "user", "assistant":
+				p.Messages = append(p.Messages, PromptMessage{Role: name})
+				current = &p.Messages[len(p.Messages)-1]
+				continue
+			}
+		}
+		if current == nil {
+			preamble = append(preamble, line)
+			continue
+		}
+		current.Content += line + "\n"
+	}
+
+	for i := range p.Messages {
+		p.Messages[i].Content = strings.TrimSpace(p.Messages[i].Content)
+	}
+	if text := strings.TrimSpace(strings.Join(preamble, "\n")); text != "" {
+		if len(p.Messages) > 0 {
+			return nil, fmt.Errorf("text before the first role heading")
+		}
+		p.Messages = []PromptMessage{{Role: role, Content: text}}
+	}
+	return p, nil
+}
+
+// splitFrontMatter 拆分 --- 包围的 front-matter 和正文
+func splitFrontMatter(data []byte) (front, body string, err error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if !strings.HasPrefix(text, "---\n") {
+		return "", text, nil
+	}
+	rest := text[len("---\n"):]
+	if strings.HasPrefix(rest, "---\n") {
+		return "", rest[len("---\n"):], nil
+	}
+	end := strings.Index(rest, "\n---\n")
+	if end < 0 {
+		if strings.HasSuffix(rest, "\n---") {
+			return rest[:len(rest)-len("\n---")], "", nil
+		}
+		return "", "", fmt.Errorf("unterminated front-matter")
+	}
+	return rest[:end], rest[end+len("\n---\n"):], nil
+}
+
+// compareVersions 比较版本号，忽略前缀 v，数字段按数值比较
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(strings.TrimPrefix(a, "v"), "V"), ".")
+	bs := strings.Split(strings.TrimPrefix(strings.TrimPrefix(b, "v"), "V"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		switch {
+		case xerr == nil && yerr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,182 @@
+package ai
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseYAML 测试 YAML 子集解析
+func TestParseYAML(t *testing.T) {
+	src := `# 注释
+name: demo  # 行尾注释
+count: 3
+ratio: 0.5
+enabled: true
+empty:
+zip: "02134"
+tags: [a, "b c", 1]
+inline: {x: 1, y: two}
+text: |
+  第一行
+  第二行
+folded: >-
+  a
+  b
+
+  c
+items:
+- name: first
+  value: 1
+- - nested
+- plain: "quoted # not comment"
+`
+	got, err := parseYAML([]byte(src))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	want := map[string]interface{}{
+		"name":    "demo",
+		"count":   3,
+		"ratio":   0.5,
+		"enabled": true,
+		"empty":   nil,
+		"zip":     "02134",
+		"tags":    []interface{}{"a", "b c", 1},
+		"inline":  map[string]interface{}{"x": 1, "y": "two"},
+		"text":    "第一行\n第二行\n",
+		"folded":  "a b\nc",
+		"items": []interface{}{
+			map[string]interface{}{"name": "first", "value": 1},
+			[]interface{}{"nested"},
+			map[string]interface{}{"plain": "quoted # not comment"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("解析结果错误\n期望: %#v\n实际: %#v", want, got)
+	}
+
+	for _, bad := range []string{"a: 1\n  b: 2\n", "a: 1\na: 2\n", "a: [1, 2\n"} {
+		if _, err := parseYAML([]byte(bad)); err == nil {
+			t.Errorf("应该拒绝无效的YAML: %q", bad)
+		}
+	}
+
+	t.Logf("YAML解析测试通过")
+}
+
+// TestPromptTemplate 测试模板渲染、变量校验和片段
+func TestPromptTemplate(t *testing.T) {
+	prompt := NewPromptTemplate("review").
+		Variable(PromptVariable{Name: "language", Type: PromptVarString, Required: true}).
+		Variable(PromptVariable{Name: "rules", Type: PromptVarList}).
+		Variable(PromptVariable{Name: "limit", Type: PromptVarInt, Default: 5}).
+		Partial("rules", `{{range $.rules}}- {{.}}
+{{end}}`).
+		System(`审查 {{upper .language}} 代码，最多 {{.limit}} 条意见。
+{{template "rules" .}}`).
+		User("{{.code}}")
+
+	if err := prompt.Compile(); err == nil || !strings.Contains(err.Error(), "code is used but not declared") {
+		t.Errorf("未声明的变量应该在编译时报错，实际%v", err)
+	}
+	prompt.Variable(PromptVariable{Name: "code", Required: true})
+	if err := prompt.Compile(); err != nil {
+		t.Fatalf("编译失败: %v", err)
+	}
+
+	messages, err := prompt.Render(map[string]interface{}{
+		"language": "go",
+		"rules":    []string{"检查错误处理"},
+		"code":     "func main() {}",
+	})
+	if err != nil {
+		t.Fatalf("渲染失败: %v", err)
+	}
+	if ExtractContent(&messages[0]) != "审查 GO 代码，最多 5 条意见。\n- 检查错误处理\n" || ExtractContent(&messages[1]) != "func main() {}" {
+		t.Errorf("渲染结果错误: %q / %q", ExtractContent(&messages[0]), ExtractContent(&messages[1]))
+	}
+
+	_, err = prompt.Render(map[string]interface{}{"limit": "many"})
+	var promptErr *PromptError
+	if !errors.As(err, &promptErr) || len(promptErr.Problems) != 3 {
+		t.Errorf("应该同时报告缺失的变量和类型错误，实际%v", err)
+	}
+
+	// 结构体参数按 json 标签映射
+	type reviewVars struct {
+		Language string `json:"language"`
+		Code     string `json:"code"`
+	}
+	builder := NewMessageBuilder().Prompt(prompt, reviewVars{Language: "rust", Code: "fn main() {}"}).User("谢谢")
+	if builder.Err() != nil || len(builder.Build()) != 3 {
+		t.Errorf("渲染到消息构建器失败: %v", builder.Err())
+	}
+	if NewMessageBuilder().Prompt(prompt, nil).Err() == nil {
+		t.Error("缺少变量时消息构建器应该记录错误")
+	}
+
+	// 未声明变量时依靠 missingkey=error 在渲染时发现缺失
+	if _, err := NewPromptTemplate("loose").User("{{.name}}").Render(nil); err == nil {
+		t.Error("缺失变量应该返回错误而不是输出<no value>")
+	}
+
+	t.Logf("提示词模板测试通过")
+}
+
+// TestPromptLibrary 测试从目录加载带版本的提示词
+func TestPromptLibrary(t *testing.T) {
+	lib, err := LoadPromptLibrary("testdata/prompts")
+	if err != nil {
+		t.Fatalf("加载提示词库失败: %v", err)
+	}
+	if !reflect.DeepEqual(lib.Names(), []string{"support", "translate"}) || !reflect.DeepEqual(lib.Versions("support"), []string{"v1", "v2"}) {
+		t.Errorf("提示词名称或版本错误: %v %v", lib.Names(), lib.Versions("support"))
+	}
+
+	latest, err := lib.Get("support")
+	if err != nil || latest.Version != "v2" || latest.Model != "gpt-4o" {
+		t.Fatalf("应该返回最新版本: %+v %v", latest, err)
+	}
+	req, err := latest.Request(map[string]interface{}{
+		"product":  "云盘",
+		"question": "怎么退款？",
+		"orders":   []string{"A1", "B2"},
+	})
+	if err != nil {
+		t.Fatalf("生成请求失败: %v", err)
+	}
+	if req.Model != "gpt-4o" || req.Temperature == nil || *req.Temperature != 0.3 || !reflect.DeepEqual(req.Stop, []string{"###"}) {
+		t.Errorf("请求默认参数错误: %+v", req)
+	}
+	if system := ExtractContent(&req.Messages[0]); system != "你是 云盘 的客服，最多列出 3 条订单。\n回复结尾署名“云盘 团队”。" {
+		t.Errorf("系统消息错误: %q", system)
+	}
+	if user := ExtractContent(&req.Messages[1]); user != "- A1\n- B2\n问题：怎么退款？" {
+		t.Errorf("用户消息错误: %q", user)
+	}
+
+	v1, err := lib.GetVersion("support", "v1")
+	if err != nil || v1.Defaults.MaxTokens == nil || *v1.Defaults.MaxTokens != 300 {
+		t.Fatalf("加载v1失败: %+v %v", v1, err)
+	}
+	messages, err := v1.Render(map[string]string{"product": "云盘", "question": "你好"})
+	if err != nil || !strings.HasPrefix(ExtractContent(&messages[0]), "你是 云盘 的客服，语气友好。") {
+		t.Errorf("v1渲染错误: %v %v", messages, err)
+	}
+
+	translate, _ := lib.Get("translate")
+	if len(translate.Messages) != 1 || translate.Messages[0].Role != "user" {
+		t.Errorf("没有角色标题的Markdown应该使用front-matter中的role: %+v", translate.Messages)
+	}
+
+	if _, err := lib.Get("missing"); !errors.Is(err, ErrPromptNotFound) {
+		t.Errorf("不存在的提示词应该返回ErrPromptNotFound，实际%v", err)
+	}
+	if compareVersions("v1.10", "v1.9") <= 0 || compareVersions("2", "v2") != 0 {
+		t.Error("版本比较错误")
+	}
+
+	t.Logf("提示词库测试通过")
+}
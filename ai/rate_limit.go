@@ -0,0 +1,294 @@
+package ai
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitAnyModel RateLimits 中适用于所有未单独配置的模型的键
+const RateLimitAnyModel = "*"
+
+// RateLimit 每分钟的请求数和令牌数上限，为 0 表示不限制
+type RateLimit struct {
+	RequestsPerMinute int `json:"rpm,omitempty"`
+	TokensPerMinute   int `json:"tpm,omitempty"`
+}
+
+// rateLimiter 按模型的令牌桶限流器，请求前阻塞直到有余量
+//
+// 每个模型有独立的请求桶和令牌桶，容量为一分钟的额度并匀速恢复。
+// 响应中的 x-ratelimit-* 头会校正桶的容量和剩余量，使限流与网关保持一致。
+// 网关按密钥计算额度，使用多个密钥时一个密钥的响应头不代表模型的整体余量，因此不做校正。
+type rateLimiter struct {
+	mu      sync.Mutex
+	limits  map[string]RateLimit
+	buckets map[string]*modelBuckets
+	now     func() time.Time
+	// adaptive 是否根据响应头和 429 校正令牌桶，APIKeys 多于一个时为 false
+	adaptive bool
+}
+
+// modelBuckets 单个模型的请求桶和令牌桶，未限制的维度为 nil
+type modelBuckets struct {
+	requests *tokenBucket
+	tokens   *tokenBucket
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	// limit 配置的每分钟额度，响应头只能把容量降到它以下
+	limit    float64
+	capacity float64
+	rate     float64 // 每秒恢复量
+	level    float64
+	last     time.Time
+	// pausedUntil 网关报告额度用尽时，在重置时间之前不再恢复
+	pausedUntil time.Time
+}
+
+// newRateLimiter 按配置创建限流器，没有配置 RateLimits 时返回 nil
+func newRateLimiter(config *Config) *rateLimiter {
+	if len(config.RateLimits) == 0 {
+		return nil
+	}
+	return &rateLimiter{
+		limits:   config.RateLimits,
+		buckets:  make(map[string]*modelBuckets),
+		now:      time.Now,
+		adaptive: len(config.APIKeys) <= 1,
+	}
+}
+
+// newTokenBucket 创建满的令牌桶，perMinute 为 0 时返回 nil
+func newTokenBucket(perMinute int, now time.Time) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	capacity := float64(perMinute)
+	return &tokenBucket{limit: capacity, capacity: capacity, rate: capacity / 60, level: capacity, last: now}
+}
+
+// refill 按经过的时间恢复余量
+func (b *tokenBucket) refill(now time.Time) {
+	from := b.last
+	if b.pausedUntil.After(from) {
+		from = b.pausedUntil
+	}
+	if elapsed := now.Sub(from).Seconds(); elapsed > 0 {
+		b.level = math.Min(b.capacity, b.level+elapsed*b.rate)
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+}
+
+// wait 返回余量达到 n 还需等待的时间，n 超过容量时按容量计算
+func (b *tokenBucket) wait(n float64, now time.Time) time.Duration {
+	n = math.Min(n, b.capacity)
+	var d time.Duration
+	if now.Before(b.pausedUntil) {
+		d = b.pausedUntil.Sub(now)
+	}
+	if b.level < n {
+		d += time.Duration((n - b.level) / b.rate * float64(time.Second))
+	}
+	return d
+}
+
+// bucketsFor 返回模型的令牌桶，模型未限制时返回 nil
+func (l *rateLimiter) bucketsFor(model string) *modelBuckets {
+	if buckets, ok := l.buckets[model]; ok {
+		return buckets
+	}
+	limit, ok := l.limits[model]
+	if !ok {
+		limit, ok = l.limits[RateLimitAnyModel]
+	}
+	if !ok || (limit.RequestsPerMinute <= 0 && limit.TokensPerMinute <= 0) {
+		l.buckets[model] = nil
+		return nil
+	}
+	now := l.now()
+	buckets := &modelBuckets{
+		requests: newTokenBucket(limit.RequestsPerMinute, now),
+		tokens:   newTokenBucket(limit.TokensPerMinute, now),
+	}
+	l.buckets[model] = buckets
+	return buckets
+}
+
+// wait 阻塞直到模型有一个请求和 tokens 个令牌的余量并扣除，ctx 结束时返回其错误
+func (l *rateLimiter) wait(ctx context.Context, model string, tokens int) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		buckets := l.bucketsFor(model)
+		if buckets == nil {
+			l.mu.Unlock()
+			return nil
+		}
+
+		now := l.now()
+		var delay time.Duration
+		if b := buckets.requests; b != nil {
+			b.refill(now)
+			delay = max(delay, b.wait(1, now))
+		}
+		if b := buckets.tokens; b != nil {
+			b.refill(now)
+			delay = max(delay, b.wait(float64(tokens), now))
+		}
+		if delay <= 0 {
+			if b := buckets.requests; b != nil {
+				b.level--
+			}
+			if b := buckets.tokens; b != nil {
+				b.level -= math.Min(float64(tokens), b.capacity)
+			}
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// observe 根据响应头校正模型的令牌桶
+//
+// 支持 x-ratelimit-limit-requests/tokens（更新容量和恢复速率，不超过配置的额度）、
+// x-ratelimit-remaining-requests/tokens（余量不超过网关报告的剩余量）
+// 和 x-ratelimit-reset-requests/tokens（剩余量为 0 时在重置前暂停恢复）。
+func (l *rateLimiter) observe(model string, header http.Header) {
+	if l == nil || !l.adaptive {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	buckets := l.bucketsFor(model)
+	if buckets == nil {
+		return
+	}
+	now := l.now()
+	for _, dim := range []struct {
+		name   string
+		bucket *tokenBucket
+	}{{"requests", buckets.requests}, {"tokens", buckets.tokens}} {
+		b := dim.bucket
+		if b == nil {
+			continue
+		}
+		b.refill(now)
+
+		if limit, err := strconv.ParseFloat(header.Get("x-ratelimit-limit-"+dim.name), 64); err == nil && limit > 0 {
+			limit = math.Min(limit, b.limit)
+			b.capacity = limit
+			b.rate = limit / 60
+			b.level = math.Min(b.level, b.capacity)
+		}
+		remaining, err := strconv.ParseFloat(header.Get("x-ratelimit-remaining-"+dim.name), 64)
+		if err != nil {
+			continue
+		}
+		if remaining < b.level {
+			b.level = math.Max(remaining, 0)
+		}
+		if remaining <= 0 {
+			if reset, ok := parseRateLimitReset(header.Get("x-ratelimit-reset-" + dim.name)); ok {
+				b.pausedUntil = now.Add(reset)
+			}
+		}
+	}
+}
+
+// throttle 收到 429 时暂停模型的请求桶，retryAfter 为 0 时只清空余量
+func (l *rateLimiter) throttle(model string, retryAfter time.Duration) {
+	if l == nil || !l.adaptive {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	buckets := l.bucketsFor(model)
+	if buckets == nil || buckets.requests == nil {
+		return
+	}
+	now := l.now()
+	buckets.requests.refill(now)
+	buckets.requests.level = 0
+	if retryAfter > 0 {
+		buckets.requests.pausedUntil = now.Add(retryAfter)
+	}
+}
+
+// reconcile 用实际用量修正预估的令牌数，多扣的部分退回
+func (l *rateLimiter) reconcile(model string, estimated int, usage *Usage) {
+	if l == nil || usage == nil || usage.TotalTokens <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	buckets := l.bucketsFor(model)
+	if buckets == nil || buckets.tokens == nil {
+		return
+	}
+	b := buckets.tokens
+	b.level = math.Min(b.capacity, b.level+float64(estimated-usage.TotalTokens))
+}
+
+// parseRateLimitReset 解析重置时间，支持 "1s"、"6m0s"、"20ms" 和纯秒数
+func parseRateLimitReset(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d, true
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	return 0, false
+}
+
+// estimateRequestTokens 预估请求消耗的令牌数：输入令牌加上最大输出令牌
+//
+// 编码不可用时输入令牌按 EstimateTokens 粗略估算，限流不因此失败。
+func estimateRequestTokens(req *ChatRequest) int {
+	tokens, err := CountRequestTokens(req)
+	if err != nil {
+		tokens = EstimateTokens(req.Messages) + countToolTokens(estimateTextTokens, req.Tools)
+	}
+	if req.MaxTokens != nil {
+		tokens += *req.MaxTokens
+	}
+	return tokens
+}
+
+// rateLimitKey 返回影响限流器的设置，相同时复用限流器
+func (c *Config) rateLimitKey() string {
+	parts := make([]string, 0, len(c.RateLimits))
+	for _, model := range sortedKeys(c.RateLimits) {
+		limit := c.RateLimits[model]
+		parts = append(parts, model+"="+strconv.Itoa(limit.RequestsPerMinute)+"/"+strconv.Itoa(limit.TokensPerMinute))
+	}
+	if len(c.APIKeys) > 1 {
+		parts = append(parts, "keys")
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,186 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRateLimiter 测试按模型的请求数和令牌数限流及响应头校正
+func TestRateLimiter(t *testing.T) {
+	// 预先加载秩表，避免首次请求的加载时间计入等待
+	if _, err := GetEncoding(EncodingO200K); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	headers := map[string]string{}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		for k, v := range headers {
+			w.Header().Set(k, v)
+		}
+		mu.Unlock()
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`))
+	}))
+	defer server.Close()
+
+	call := func(client *Client, model string, timeout time.Duration) error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		req := NewRequest(model).Messages(NewMessageBuilder().User("hi").Build()).Build()
+		_, err := client.ChatCompletion(ctx, req)
+		return err
+	}
+
+	// 请求数用完后阻塞，直到上下文结束；不同模型的额度互不影响
+	client := NewClient(NewConfig(server.URL, "k").WithRateLimit("limited", 2, 0))
+	for i := 0; i < 2; i++ {
+		if err := call(client, "limited", time.Second); err != nil {
+			t.Fatalf("第%d次请求失败: %v", i+1, err)
+		}
+	}
+	start := time.Now()
+	if err := call(client, "limited", 50*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("额度用完后应该等待到超时，实际%v", err)
+	}
+	if time.Since(start) < 40*time.Millisecond {
+		t.Error("额度用完后应该阻塞")
+	}
+	if err := call(client, "other", time.Second); err != nil {
+		t.Errorf("未限流的模型不应等待: %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("等待超时的请求不应发出，实际发出%d个", requests)
+	}
+
+	// 响应头报告剩余量为 0 时，在重置时间之前暂停
+	client = NewClient(NewConfig(server.URL, "k").WithRateLimit(RateLimitAnyModel, 1000, 100000))
+	mu.Lock()
+	headers["x-ratelimit-remaining-requests"] = "0"
+	headers["x-ratelimit-reset-requests"] = "100ms"
+	mu.Unlock()
+	if err := call(client, "m", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	delete(headers, "x-ratelimit-remaining-requests")
+	mu.Unlock()
+	start = time.Now()
+	if err := call(client, "m", time.Second); err != nil {
+		t.Fatalf("重置后应该继续请求: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("应该等待网关的重置时间，实际只等待了%v", elapsed)
+	}
+
+	// 响应头中的上限会替换配置的容量
+	mu.Lock()
+	headers = map[string]string{"x-ratelimit-limit-tokens": "50"}
+	mu.Unlock()
+	if err := call(client, "m", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	limiter := client.load().limiter
+	limiter.mu.Lock()
+	tokens := limiter.buckets["m"].tokens
+	if tokens.capacity != 50 || tokens.rate != 50.0/60 {
+		t.Errorf("令牌桶应该按响应头调整为50/分钟，实际%v", tokens.capacity)
+	}
+	limiter.mu.Unlock()
+
+	// 响应头中的上限高于配置时保持配置的额度
+	mu.Lock()
+	headers = map[string]string{"x-ratelimit-limit-requests": "5000", "x-ratelimit-limit-tokens": "900000"}
+	mu.Unlock()
+	if err := call(client, "m", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	limiter.mu.Lock()
+	if b := limiter.buckets["m"]; b.requests.capacity != 1000 || b.requests.rate != 1000.0/60 || b.tokens.capacity != 100000 {
+		t.Errorf("响应头不应把容量提高到配置的额度以上: %v %v", b.requests.capacity, b.tokens.capacity)
+	}
+	limiter.mu.Unlock()
+
+	// 多个密钥时一个密钥报告额度用尽不影响其他密钥，不暂停模型的令牌桶
+	client = NewClient(NewConfig(server.URL, "").WithAPIKeys("k1", "k2").WithRateLimit(RateLimitAnyModel, 1000, 100000))
+	mu.Lock()
+	headers = map[string]string{"x-ratelimit-remaining-requests": "0", "x-ratelimit-reset-requests": "200ms", "x-ratelimit-limit-tokens": "50"}
+	mu.Unlock()
+	start = time.Now()
+	for i := 0; i < 2; i++ {
+		if err := call(client, "m", time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= 150*time.Millisecond {
+		t.Errorf("多个密钥时不应按单个密钥的响应头暂停，实际等待了%v", elapsed)
+	}
+	limiter = client.load().limiter
+	limiter.mu.Lock()
+	if b := limiter.buckets["m"]; b.tokens.capacity != 100000 || !b.requests.pausedUntil.IsZero() {
+		t.Errorf("多个密钥时不应根据响应头校正令牌桶: %+v %+v", b.requests, b.tokens)
+	}
+	limiter.mu.Unlock()
+	limiter.throttle("m", time.Minute)
+	if d := limiter.buckets["m"].requests.wait(1, time.Now()); d != 0 {
+		t.Errorf("多个密钥时429不应暂停模型的令牌桶，实际需等待%v", d)
+	}
+
+	t.Logf("限流测试通过")
+}
+
+// TestTokenBucket 测试令牌桶的恢复、等待时间和用量修正
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newRateLimiter(NewConfig("", "").WithRateLimit("m", 0, 600))
+	limiter.now = func() time.Time { return now }
+
+	if err := limiter.wait(context.Background(), "m", 500); err != nil {
+		t.Fatal(err)
+	}
+	b := limiter.buckets["m"].tokens
+	if b.level != 100 || limiter.buckets["m"].requests != nil {
+		t.Errorf("扣除后剩余应为100，实际%v", b.level)
+	}
+	if d := b.wait(200, now); d != 10*time.Second {
+		t.Errorf("还差100个令牌，按每秒10个应等待10秒，实际%v", d)
+	}
+	if d := b.wait(5000, now); d != 50*time.Second {
+		t.Errorf("超过容量的请求按容量等待，实际%v", d)
+	}
+
+	// 实际用量少于预估时退回差额
+	limiter.reconcile("m", 500, &Usage{TotalTokens: 200})
+	if b.level != 400 {
+		t.Errorf("退回后剩余应为400，实际%v", b.level)
+	}
+
+	now = now.Add(30 * time.Second)
+	b.refill(now)
+	if b.level != 600 {
+		t.Errorf("恢复不应超过容量，实际%v", b.level)
+	}
+
+	// 429 清空请求余量并在 Retry-After 之前暂停
+	limiter = newRateLimiter(NewConfig("", "").WithRateLimit("m", 60, 0))
+	limiter.now = func() time.Time { return now }
+	limiter.throttle("m", 5*time.Second)
+	if d := limiter.buckets["m"].requests.wait(1, now); d != 6*time.Second {
+		t.Errorf("应等待Retry-After加一个请求的恢复时间，实际%v", d)
+	}
+
+	if d, ok := parseRateLimitReset("6m0s"); !ok || d != 6*time.Minute {
+		t.Errorf("重置时间解析错误: %v", d)
+	}
+	if d, ok := parseRateLimitReset("1.5"); !ok || d != 1500*time.Millisecond {
+		t.Errorf("秒数形式的重置时间解析错误: %v", d)
+	}
+
+	t.Logf("令牌桶测试通过")
+}
@@ -63,6 +63,134 @@ func (b *RequestBuilder) ToolChoice(choice interface{}) *RequestBuilder {
 	return b
 }
 
+// ResponseFormat 设置响应格式
+func (b *RequestBuilder) ResponseFormat(format *ResponseFormat) *RequestBuilder {
+	b.request.ResponseFormat = format
+	return b
+}
+
+// JSONMode 设置为 JSON 对象输出
+func (b *RequestBuilder) JSONMode() *RequestBuilder {
+	b.request.ResponseFormat = &ResponseFormat{Type: ResponseFormatJSONObject}
+	return b
+}
+
+// JSONSchema 设置为按 JSON Schema 输出结构化数据
+func (b *RequestBuilder) JSONSchema(name string, schema interface{}, strict bool) *RequestBuilder {
+	b.request.ResponseFormat = &ResponseFormat{
+		Type: ResponseFormatJSONSchema,
+		JSONSchema: &JSONSchemaFormat{
+			Name:   name,
+			Schema: schema,
+			Strict: &strict,
+		},
+	}
+	return b
+}
+
+// Seed 设置随机种子
+func (b *RequestBuilder) Seed(seed int) *RequestBuilder {
+	b.request.Seed = &seed
+	return b
+}
+
+// PresencePenalty 设置存在惩罚
+func (b *RequestBuilder) PresencePenalty(penalty float64) *RequestBuilder {
+	b.request.PresencePenalty = &penalty
+	return b
+}
+
+// FrequencyPenalty 设置频率惩罚
+func (b *RequestBuilder) FrequencyPenalty(penalty float64) *RequestBuilder {
+	b.request.FrequencyPenalty = &penalty
+	return b
+}
+
+// LogitBias 设置令牌偏置
+func (b *RequestBuilder) LogitBias(bias map[string]int) *RequestBuilder {
+	b.request.LogitBias = bias
+	return b
+}
+
+// Logprobs 返回输出令牌的对数概率，topN 大于 0 时同时返回候选令牌
+func (b *RequestBuilder) Logprobs(topN int) *RequestBuilder {
+	enabled := true
+	b.request.Logprobs = &enabled
+	if topN > 0 {
+		b.request.TopLogprobs = &topN
+	}
+	return b
+}
+
+// User 设置终端用户标识
+func (b *RequestBuilder) User(user string) *RequestBuilder {
+	b.request.User = user
+	return b
+}
+
+// ParallelToolCalls 设置是否允许并行工具调用
+func (b *RequestBuilder) ParallelToolCalls(enabled bool) *RequestBuilder {
+	b.request.ParallelToolCalls = &enabled
+	return b
+}
+
+// ReasoningEffort 设置推理强度
+func (b *RequestBuilder) ReasoningEffort(effort string) *RequestBuilder {
+	b.request.ReasoningEffort = effort
+	return b
+}
+
+// Modalities 设置输出模态
+func (b *RequestBuilder) Modalities(modalities ...string) *RequestBuilder {
+	b.request.Modalities = modalities
+	return b
+}
+
+// Audio 设置音频输出参数
+func (b *RequestBuilder) Audio(voice, format string) *RequestBuilder {
+	b.request.Audio = &AudioOutput{Voice: voice, Format: format}
+	return b
+}
+
+// Prediction 设置预测输出内容
+func (b *RequestBuilder) Prediction(content string) *RequestBuilder {
+	b.request.Prediction = &Prediction{Type: "content", Content: TextContent(content)}
+	return b
+}
+
+// Metadata 设置元数据
+func (b *RequestBuilder) Metadata(key, value string) *RequestBuilder {
+	if b.request.Metadata == nil {
+		b.request.Metadata = make(map[string]string)
+	}
+	b.request.Metadata[key] = value
+	return b
+}
+
+// Store 设置是否存储本次补全
+func (b *RequestBuilder) Store(store bool) *RequestBuilder {
+	b.request.Store = &store
+	return b
+}
+
+// ServiceTier 设置服务等级
+func (b *RequestBuilder) ServiceTier(tier string) *RequestBuilder {
+	b.request.ServiceTier = tier
+	return b
+}
+
+// Fallbacks 设置模型失败时依次尝试的模型或角色
+func (b *RequestBuilder) Fallbacks(models ...string) *RequestBuilder {
+	b.request.Fallbacks = models
+	return b
+}
+
+// NoCache 跳过响应缓存
+func (b *RequestBuilder) NoCache() *RequestBuilder {
+	b.request.NoCache = true
+	return b
+}
+
 // Extra 设置额外参数
 func (b *RequestBuilder) Extra(key string, value interface{}) *RequestBuilder {
 	b.request.Extra[key] = value
@@ -0,0 +1,112 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// chatRequestJSON 去掉自定义序列化方法的 ChatRequest，用于默认编解码
+type chatRequestJSON ChatRequest
+
+// requestField ChatRequest 中的 JSON 字段信息
+type requestField struct {
+	index     int
+	omitempty bool
+}
+
+// chatRequestFields JSON 字段名到结构体字段的映射
+var chatRequestFields = func() map[string]requestField {
+	fields := make(map[string]requestField)
+	t := reflect.TypeOf(ChatRequest{})
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("json")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		fields[name] = requestField{index: i, omitempty: strings.Contains(opts, "omitempty")}
+	}
+	return fields
+}()
+
+// MarshalJSON 一次性序列化请求，并把 Extra 直接写入输出
+//
+// Extra 中与可选字段同名的键会覆盖该字段；model 和 messages 不能被覆盖。
+func (r ChatRequest) MarshalJSON() ([]byte, error) {
+	body := chatRequestJSON(r)
+	if len(r.Extra) == 0 {
+		return json.Marshal(body)
+	}
+
+	keys := make([]string, 0, len(r.Extra))
+	for k := range r.Extra {
+		if field, ok := chatRequestFields[k]; ok {
+			if !field.omitempty {
+				continue
+			}
+			reflect.ValueOf(&body).Elem().Field(field.index).SetZero()
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	base, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(base) + 32*len(keys))
+	buf.Write(base[:len(base)-1])
+	needComma := len(base) > 2
+
+	for _, k := range keys {
+		value, err := json.Marshal(r.Extra[k])
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal extra parameter %q: %w", k, err)
+		}
+		if needComma {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(quoteJSON(k))
+		buf.WriteByte(':')
+		buf.Write(value)
+		needComma = true
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON 解析请求，未知字段保存到 Extra 中
+func (r *ChatRequest) UnmarshalJSON(data []byte) error {
+	var body chatRequestJSON
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for k, v := range raw {
+		if _, known := chatRequestFields[k]; known {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(v, &value); err != nil {
+			return err
+		}
+		if body.Extra == nil {
+			body.Extra = make(map[string]interface{})
+		}
+		body.Extra[k] = value
+	}
+
+	*r = ChatRequest(body)
+	return nil
+}
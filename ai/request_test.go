@@ -0,0 +1,119 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// TestRequestEncoding 测试类型化字段和额外参数的一次性序列化
+func TestRequestEncoding(t *testing.T) {
+	req := NewRequest("gpt-4.1").
+		Messages(NewMessageBuilder().User("你好").Build()).
+		Seed(42).
+		PresencePenalty(0.5).
+		FrequencyPenalty(-0.5).
+		Logprobs(3).
+		ParallelToolCalls(false).
+		ReasoningEffort(ReasoningEffortLow).
+		Metadata("trace", "abc").
+		Extra("temperature", 0.3).
+		Extra("model", "should-be-ignored").
+		Extra("vendor_option", map[string]interface{}{"enabled": true}).
+		Temperature(1.5).
+		Build()
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatalf("序列化结果不是合法JSON: %s", data)
+	}
+
+	checks := map[string]interface{}{
+		"model":               "gpt-4.1",
+		"seed":                float64(42),
+		"presence_penalty":    0.5,
+		"frequency_penalty":   -0.5,
+		"logprobs":            true,
+		"top_logprobs":        float64(3),
+		"parallel_tool_calls": false,
+		"reasoning_effort":    "low",
+		"temperature":         0.3, // Extra 覆盖类型化字段
+	}
+	for k, want := range checks {
+		if body[k] != want {
+			t.Errorf("字段%s期望%v，实际%v", k, want, body[k])
+		}
+	}
+	if body["vendor_option"].(map[string]interface{})["enabled"] != true {
+		t.Errorf("额外参数未合并: %s", data)
+	}
+
+	// 反序列化时未知字段进入 Extra
+	var decoded ChatRequest
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("反序列化失败: %v", err)
+	}
+	if *decoded.Seed != 42 || decoded.Extra["vendor_option"] == nil || decoded.Extra["seed"] != nil {
+		t.Errorf("反序列化结果错误: %+v", decoded)
+	}
+	again, _ := json.Marshal(decoded)
+	if normalizeJSON(t, again) != normalizeJSON(t, data) {
+		t.Errorf("往返不一致\n期望: %s\n实际: %s", data, again)
+	}
+
+	t.Logf("请求序列化测试通过")
+}
+
+// TestValidateRequestFields 测试扩展字段的范围校验
+func TestValidateRequestFields(t *testing.T) {
+	messages := NewMessageBuilder().User("test").Build()
+	base := func() *RequestBuilder { return NewRequest("gpt-4.1").Messages(messages) }
+
+	cases := []struct {
+		field string
+		req   *ChatRequest
+	}{
+		{"presence_penalty", base().PresencePenalty(2.5).Build()},
+		{"frequency_penalty", base().FrequencyPenalty(-3).Build()},
+		{"logit_bias", base().LogitBias(map[string]int{"50256": -101}).Build()},
+		{"logit_bias", base().LogitBias(map[string]int{"hello": 1}).Build()},
+		{"top_logprobs", base().Logprobs(21).Build()},
+		{"top_logprobs", &ChatRequest{Model: "gpt-4.1", Messages: messages, TopLogprobs: &[]int{2}[0]}},
+		{"reasoning_effort", base().ReasoningEffort("extreme").Build()},
+		{"modalities", base().Modalities("video").Build()},
+		{"audio", base().Modalities(ModalityText, ModalityAudio).Build()},
+		{"service_tier", base().ServiceTier("gold").Build()},
+		{"max_tokens", base().MaxTokens(0).Build()},
+	}
+
+	for _, tc := range cases {
+		err := ValidateRequest(tc.req)
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) || validationErr.Field != tc.field {
+			t.Errorf("期望字段%s的验证错误，实际%v", tc.field, err)
+		}
+	}
+
+	valid := base().
+		Seed(1).
+		PresencePenalty(-2).
+		FrequencyPenalty(2).
+		LogitBias(map[string]int{"50256": -100}).
+		Logprobs(20).
+		Modalities(ModalityText, ModalityAudio).
+		Audio("alloy", "wav").
+		Prediction("已知文本").
+		Store(true).
+		ServiceTier(ServiceTierFlex).
+		Build()
+	if err := ValidateRequest(valid); err != nil {
+		t.Errorf("有效请求不应该有验证错误: %v", err)
+	}
+
+	t.Logf("扩展字段校验测试通过")
+}
@@ -0,0 +1,63 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestResponseDetails 测试对数概率、系统指纹、令牌明细和原始响应体
+func TestResponseDetails(t *testing.T) {
+	raw := loadTestdata(t, "logprobs_response.json")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(raw)
+	}))
+	defer server.Close()
+
+	client := NewClient(NewConfig(server.URL, "test-key"))
+	req := NewRequest("gpt-4.1").
+		Messages(NewMessageBuilder().User("请说'测试成功'").Build()).
+		Logprobs(2).
+		Build()
+
+	resp, err := client.ChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+
+	if resp.SystemFingerprint != "fp_b3f1157249" || resp.ServiceTier != "default" {
+		t.Errorf("系统指纹或服务等级丢失: %q %q", resp.SystemFingerprint, resp.ServiceTier)
+	}
+	if resp.Usage.CachedTokens() != 1024 || resp.Usage.ReasoningTokens() != 128 {
+		t.Errorf("令牌明细丢失: %+v", resp.Usage)
+	}
+
+	logprobs := resp.Choices[0].Logprobs
+	if logprobs == nil || len(logprobs.Content) != 2 || len(logprobs.Content[0].TopLogprobs) != 2 {
+		t.Fatalf("对数概率丢失: %+v", logprobs)
+	}
+	if logprobs.Content[0].Token != "测试" || logprobs.Content[0].TopLogprobs[1].Logprob != -6.9 {
+		t.Errorf("对数概率解析错误: %+v", logprobs.Content[0])
+	}
+
+	var gateway struct {
+		ChannelID int     `json:"channel_id"`
+		QuotaCost float64 `json:"quota_cost"`
+	}
+	found, err := resp.RawField("x_gateway", &gateway)
+	if err != nil || !found || gateway.ChannelID != 7 {
+		t.Errorf("厂商扩展字段读取失败: %v %v %+v", found, err, gateway)
+	}
+	if found, _ := resp.RawField("not_exist", &gateway); found {
+		t.Error("不存在的字段应该返回false")
+	}
+
+	var nilUsage *Usage
+	if nilUsage.CachedTokens() != 0 || nilUsage.ReasoningTokens() != 0 {
+		t.Error("空的使用统计应该返回0")
+	}
+
+	t.Logf("响应明细测试通过")
+}
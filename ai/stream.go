@@ -14,22 +14,59 @@ type StreamReader struct {
 	reader  io.ReadCloser
 	scanner *bufio.Scanner
 	ctx     context.Context
+
+	// 注册了完成回调时累积数据块，读到流结束后回调完整响应
+	accumulator *StreamAccumulator
+	onComplete  []func(*ChatResponse) error
+	completed   bool
+	// completeErr 完成回调返回的第一个错误，流结束时代替 io.EOF 返回
+	completeErr error
+
+	// onDone 流结束或关闭时调用一次，用于归还密钥并记录用量
+	onDone func(usage *Usage, err error)
+	usage  *Usage
+	done   bool
+
+	servedModel string
+	cacheHit    bool
+}
+
+// ServedModel 返回实际处理请求的模型，发生回退时与原请求不同
+func (s *StreamReader) ServedModel() string {
+	return s.servedModel
+}
+
+// CacheHit 返回流是否由缓存的响应重放
+func (s *StreamReader) CacheHit() bool {
+	return s.cacheHit
 }
 
 // StreamResponse 流式响应
 type StreamResponse struct {
-	ID      string         `json:"id"`
-	Object  string         `json:"object"`
-	Created int64          `json:"created"`
-	Model   string         `json:"model"`
-	Choices []StreamChoice `json:"choices"`
+	ID                string         `json:"id"`
+	Object            string         `json:"object"`
+	Created           int64          `json:"created"`
+	Model             string         `json:"model"`
+	Choices           []StreamChoice `json:"choices"`
+	Usage             *Usage         `json:"usage,omitempty"`
+	SystemFingerprint string         `json:"system_fingerprint,omitempty"`
+	ServiceTier       string         `json:"service_tier,omitempty"`
+
+	// Raw 原始数据块
+	Raw json.RawMessage `json:"-"`
+}
+
+// RawField 从原始数据块中解析顶层字段，字段不存在时返回 false
+func (r *StreamResponse) RawField(name string, v interface{}) (bool, error) {
+	return rawField(r.Raw, name, v)
 }
 
 // StreamChoice 流式选择
 type StreamChoice struct {
-	Index        int      `json:"index"`
-	Delta        *Message `json:"delta"`
-	FinishReason string   `json:"finish_reason,omitempty"`
+	Index        int       `json:"index"`
+	Delta        *Message  `json:"delta"`
+	FinishReason string    `json:"finish_reason,omitempty"`
+	Logprobs     *Logprobs `json:"logprobs,omitempty"`
 }
 
 // Recv 接收下一个流式响应
@@ -45,26 +82,244 @@ func (s *StreamReader) Recv() (*StreamResponse, error) {
 			data := strings.TrimPrefix(line, "data: ")
 
 			if data == "[DONE]" {
-				return nil, io.EOF
+				return nil, s.complete()
 			}
 
 			var response StreamResponse
 			if err := json.Unmarshal([]byte(data), &response); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal stream response: %w", err)
+				err = fmt.Errorf("failed to unmarshal stream response: %w", err)
+				s.finish(err)
+				return nil, err
+			}
+			response.Raw = json.RawMessage(data)
+			if response.Usage != nil {
+				s.usage = response.Usage
 			}
 
+			if s.accumulator != nil {
+				s.accumulator.Add(&response)
+			}
 			return &response, nil
 		}
 	}
 
 	if err := s.scanner.Err(); err != nil {
+		s.finish(err)
 		return nil, err
 	}
 
-	return nil, io.EOF
+	return nil, s.complete()
+}
+
+// finish 触发结束回调
+func (s *StreamReader) finish(err error) {
+	if s.done {
+		return
+	}
+	s.done = true
+	if s.onDone != nil {
+		s.onDone(s.usage, err)
+	}
+}
+
+// OnComplete 注册流正常结束时的回调，参数为由所有数据块合并而成的完整响应
+//
+// 必须在第一次调用 Recv 之前注册。
+func (s *StreamReader) OnComplete(fn func(*ChatResponse)) {
+	s.onCompleteErr(func(resp *ChatResponse) error {
+		fn(resp)
+		return nil
+	})
+}
+
+// onCompleteErr 注册可能失败的完成回调，回调返回的错误在流结束时由 Recv 和 Collect 代替 io.EOF 返回
+func (s *StreamReader) onCompleteErr(fn func(*ChatResponse) error) {
+	if s.accumulator == nil {
+		s.accumulator = NewStreamAccumulator()
+	}
+	s.onComplete = append(s.onComplete, fn)
+}
+
+// complete 触发完成回调，返回 io.EOF 或回调返回的第一个错误
+func (s *StreamReader) complete() error {
+	s.finish(nil)
+	if s.completed || s.accumulator == nil {
+		if s.completeErr != nil {
+			return s.completeErr
+		}
+		return io.EOF
+	}
+	s.completed = true
+	response := s.accumulator.Response()
+	response.ServedModel = s.servedModel
+	response.CacheHit = s.cacheHit
+	for _, fn := range s.onComplete {
+		if err := fn(response); err != nil && s.completeErr == nil {
+			s.completeErr = err
+		}
+	}
+	if s.completeErr != nil {
+		return s.completeErr
+	}
+	return io.EOF
+}
+
+// Collect 读取剩余的全部数据块并合并为完整响应，读取完成后关闭流
+func (s *StreamReader) Collect() (*ChatResponse, error) {
+	defer s.Close()
+
+	accumulator := s.accumulator
+	if accumulator == nil {
+		accumulator = NewStreamAccumulator()
+	}
+	for {
+		chunk, err := s.Recv()
+		if err == io.EOF {
+			response := accumulator.Response()
+			response.ServedModel = s.servedModel
+			response.CacheHit = s.cacheHit
+			return response, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if accumulator != s.accumulator {
+			accumulator.Add(chunk)
+		}
+	}
 }
 
 // Close 关闭流
 func (s *StreamReader) Close() error {
+	s.finish(nil)
 	return s.reader.Close()
 }
+
+// StreamAccumulator 将流式数据块合并为完整响应
+type StreamAccumulator struct {
+	response ChatResponse
+	choices  map[int]*Choice
+	order    []int
+}
+
+// NewStreamAccumulator 创建流式响应合并器
+func NewStreamAccumulator() *StreamAccumulator {
+	return &StreamAccumulator{
+		response: ChatResponse{Object: "chat.completion"},
+		choices:  make(map[int]*Choice),
+	}
+}
+
+// Add 合并一个数据块
+func (a *StreamAccumulator) Add(chunk *StreamResponse) {
+	if a.response.ID == "" {
+		a.response.ID = chunk.ID
+	}
+	if a.response.Model == "" {
+		a.response.Model = chunk.Model
+	}
+	if a.response.Created == 0 {
+		a.response.Created = chunk.Created
+	}
+	if chunk.SystemFingerprint != "" {
+		a.response.SystemFingerprint = chunk.SystemFingerprint
+	}
+	if chunk.ServiceTier != "" {
+		a.response.ServiceTier = chunk.ServiceTier
+	}
+	if chunk.Usage != nil {
+		a.response.Usage = chunk.Usage
+	}
+
+	for _, sc := range chunk.Choices {
+		choice, ok := a.choices[sc.Index]
+		if !ok {
+			choice = &Choice{Index: sc.Index, Message: &Message{Role: "assistant"}}
+			a.choices[sc.Index] = choice
+			a.order = append(a.order, sc.Index)
+		}
+		if sc.FinishReason != "" {
+			choice.FinishReason = sc.FinishReason
+		}
+		if sc.Logprobs != nil {
+			if choice.Logprobs == nil {
+				choice.Logprobs = &Logprobs{}
+			}
+			choice.Logprobs.Content = append(choice.Logprobs.Content, sc.Logprobs.Content...)
+			choice.Logprobs.Refusal = append(choice.Logprobs.Refusal, sc.Logprobs.Refusal...)
+		}
+		if sc.Delta != nil {
+			mergeDelta(choice.Message, sc.Delta)
+		}
+	}
+}
+
+// mergeDelta 合并消息增量
+func mergeDelta(msg *Message, delta *Message) {
+	if delta.Role != "" {
+		msg.Role = delta.Role
+	}
+	if delta.Content.IsMultiPart() {
+		msg.Content.Parts = append(msg.Content.Parts, delta.Content.Parts...)
+	} else if delta.Content.Text != "" {
+		msg.Content = TextContent(msg.Content.Text + delta.Content.Text)
+	}
+	msg.Refusal += delta.Refusal
+	msg.ReasoningContent += delta.ReasoningContent
+
+	for _, tc := range delta.ToolCalls {
+		target := findToolCallDelta(msg.ToolCalls, tc)
+		if target == nil {
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+			continue
+		}
+		if tc.ID != "" {
+			target.ID = tc.ID
+		}
+		if tc.Type != "" {
+			target.Type = tc.Type
+		}
+		target.Function.Name += tc.Function.Name
+		target.Function.Arguments += tc.Function.Arguments
+	}
+}
+
+// findToolCallDelta 按索引（或 ID）查找已累积的工具调用
+func findToolCallDelta(calls []ToolCall, delta ToolCall) *ToolCall {
+	for i := range calls {
+		if delta.Index != nil && calls[i].Index != nil && *calls[i].Index == *delta.Index {
+			return &calls[i]
+		}
+		if delta.Index == nil && delta.ID != "" && calls[i].ID == delta.ID {
+			return &calls[i]
+		}
+	}
+	if delta.Index == nil && delta.ID == "" && len(calls) > 0 {
+		return &calls[len(calls)-1]
+	}
+	return nil
+}
+
+// Response 返回合并后的完整响应
+func (a *StreamAccumulator) Response() *ChatResponse {
+	response := a.response
+	response.Choices = make([]Choice, 0, len(a.order))
+	for _, index := range a.order {
+		choice := *a.choices[index]
+		message := *choice.Message
+		if len(message.ToolCalls) > 0 {
+			calls := make([]ToolCall, len(message.ToolCalls))
+			copy(calls, message.ToolCalls)
+			for i := range calls {
+				calls[i].Index = nil
+				if calls[i].Type == "" {
+					calls[i].Type = "function"
+				}
+			}
+			message.ToolCalls = calls
+		}
+		choice.Message = &message
+		response.Choices = append(response.Choices, choice)
+	}
+	return &response
+}
@@ -0,0 +1,331 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultStructuredRetries ChatInto 在解析或校验失败后重新提示模型的默认次数
+const DefaultStructuredRetries = 2
+
+// StructuredOutputError 结构化输出解析或校验失败
+type StructuredOutputError struct {
+	Attempts int
+	Content  string
+	Problems []string
+}
+
+func (e *StructuredOutputError) Error() string {
+	return fmt.Sprintf("structured output invalid after %d attempts: %s", e.Attempts, strings.Join(e.Problems, "; "))
+}
+
+// ChatInto 以 T 生成的 JSON Schema 请求结构化输出并解码到 T
+func ChatInto[T any](ctx context.Context, client *Client, req *ChatRequest) (T, error) {
+	return ChatIntoWithRetries[T](ctx, client, req, DefaultStructuredRetries)
+}
+
+// ChatIntoWithRetries 同 ChatInto，可指定失败后重新提示的次数
+//
+// 请求未设置 ResponseFormat 时会自动使用 strict 模式的 json_schema。
+// 回复无法解析或不符合 Schema 时，会把错误作为新一轮用户消息发给模型，最多重试 maxRetries 次。
+func ChatIntoWithRetries[T any](ctx context.Context, client *Client, req *ChatRequest, maxRetries int) (T, error) {
+	var result T
+
+	structured := *req
+	structured.Messages = append([]Message(nil), req.Messages...)
+
+	var schema interface{}
+	if structured.ResponseFormat == nil {
+		generated, err := SchemaFor[T](true)
+		if err != nil {
+			return result, err
+		}
+		schema = generated
+		strict := true
+		structured.ResponseFormat = &ResponseFormat{
+			Type: ResponseFormatJSONSchema,
+			JSONSchema: &JSONSchemaFormat{
+				Name:   schemaName(reflect.TypeOf((*T)(nil)).Elem()),
+				Schema: generated,
+				Strict: &strict,
+			},
+		}
+	} else if structured.ResponseFormat.JSONSchema != nil {
+		schema = structured.ResponseFormat.JSONSchema.Schema
+	}
+
+	var lastErr *StructuredOutputError
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		resp, err := client.ChatCompletion(ctx, &structured)
+		if err != nil {
+			return result, err
+		}
+		if len(resp.Choices) == 0 || resp.Choices[0].Message == nil {
+			return result, fmt.Errorf("structured output: response has no choices")
+		}
+
+		message := resp.Choices[0].Message
+		if message.Refusal != "" {
+			return result, fmt.Errorf("structured output refused by model: %s", message.Refusal)
+		}
+
+		content := ExtractContent(message)
+		problems := decodeStructured(content, schema, &result)
+		if len(problems) == 0 {
+			return result, nil
+		}
+
+		lastErr = &StructuredOutputError{Attempts: attempt + 1, Content: content, Problems: problems}
+		structured.Messages = append(structured.Messages,
+			Message{Role: "assistant", Content: TextContent(content)},
+			Message{Role: "user", Content: TextContent(structuredRetryPrompt(problems))},
+		)
+	}
+
+	return result, lastErr
+}
+
+// decodeStructured 解析、校验并解码模型回复，返回所有问题
+func decodeStructured(content string, schema interface{}, out interface{}) []string {
+	text := strings.TrimSpace(content)
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.TrimPrefix(text, "```")
+	text = strings.TrimSuffix(text, "```")
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return []string{fmt.Sprintf("reply is not valid JSON: %v", err)}
+	}
+
+	if schema != nil {
+		if problems := ValidateJSONSchema(schema, value); len(problems) > 0 {
+			return problems
+		}
+	}
+
+	if err := json.Unmarshal([]byte(text), out); err != nil {
+		return []string{fmt.Sprintf("reply does not match the expected structure: %v", err)}
+	}
+	return nil
+}
+
+// structuredRetryPrompt 生成纠错提示
+func structuredRetryPrompt(problems []string) string {
+	return "Your previous reply could not be accepted:\n- " + strings.Join(problems, "\n- ") +
+		"\nReply again with only a JSON value that satisfies the required schema."
+}
+
+var schemaNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// schemaName 由类型名生成 Schema 名称
+func schemaName(t reflect.Type) string {
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice) {
+		t = t.Elem()
+	}
+	name := "response"
+	if t != nil && t.Name() != "" {
+		name = schemaNameInvalid.ReplaceAllString(t.Name(), "_")
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// GenerateSchema 根据 Go 类型生成 JSON Schema
+//
+// 字段名取自 json 标签，description 标签作为字段说明，enum 标签（逗号分隔）限定取值。
+// strict 为 true 时按结构化输出的 strict 模式生成：所有字段必填、禁止额外字段，
+// 指针和 omitempty 字段允许为 null；否则只有非 omitempty 的字段是必填的。
+// strict 模式不支持的类型会返回错误而不是等到服务端拒绝：根类型必须是结构体，
+// 字段中不能出现 map、interface{} 和 json.RawMessage。
+func GenerateSchema(v interface{}, strict bool) (map[string]interface{}, error) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil, fmt.Errorf("cannot generate schema for nil")
+	}
+	if strict {
+		root := t
+		for root.Kind() == reflect.Ptr {
+			root = root.Elem()
+		}
+		if root.Kind() != reflect.Struct || root == timeType {
+			return nil, fmt.Errorf("strict schema requires a struct root, got %s: wrap it in a struct field", root)
+		}
+	}
+	g := &schemaGenerator{strict: strict, visiting: make(map[reflect.Type]bool)}
+	return g.schemaFor(t)
+}
+
+// SchemaFor 根据类型参数生成 JSON Schema
+func SchemaFor[T any](strict bool) (map[string]interface{}, error) {
+	var zero T
+	return GenerateSchema(&zero, strict)
+}
+
+// schemaGenerator Schema 生成器
+type schemaGenerator struct {
+	strict   bool
+	visiting map[reflect.Type]bool
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (g *schemaGenerator) schemaFor(t reflect.Type) (map[string]interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+	case rawMessageType:
+		if g.strict {
+			return nil, fmt.Errorf("strict schema does not support json.RawMessage")
+		}
+		return map[string]interface{}{}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.Interface:
+		if g.strict {
+			return nil, fmt.Errorf("strict schema does not support %s", t)
+		}
+		return map[string]interface{}{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}, nil
+		}
+		items, err := g.schemaFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if g.strict {
+			return nil, fmt.Errorf("strict schema does not support %s: additionalProperties must be false", t)
+		}
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("cannot generate schema for map with %s keys", t.Key())
+		}
+		values, err := g.schemaFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		return g.structSchema(t)
+	}
+
+	return nil, fmt.Errorf("cannot generate schema for %s", t)
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) (map[string]interface{}, error) {
+	if g.visiting[t] {
+		return nil, fmt.Errorf("cannot generate schema for recursive type %s", t)
+	}
+	g.visiting[t] = true
+	defer delete(g.visiting, t)
+
+	properties := make(map[string]interface{})
+	required := make([]string, 0)
+
+	if err := g.collectFields(t, properties, &required); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}, nil
+}
+
+// collectFields 收集结构体字段，匿名嵌入的结构体字段会被展开
+func (g *schemaGenerator) collectFields(t reflect.Type, properties map[string]interface{}, required *[]string) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		omitempty := strings.Contains(opts, "omitempty")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if err := g.collectFields(embedded, properties, required); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop, err := g.schemaFor(field.Type)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		if desc := field.Tag.Get("description"); desc != "" {
+			prop["description"] = desc
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			values := strings.Split(enum, ",")
+			for i := range values {
+				values[i] = strings.TrimSpace(values[i])
+			}
+			prop["enum"] = values
+		}
+
+		optional := omitempty || field.Type.Kind() == reflect.Ptr
+		if g.strict {
+			if optional {
+				if typ, ok := prop["type"].(string); ok {
+					prop["type"] = []string{typ, "null"}
+				}
+				// 可为 null 的字段在 enum 中也要允许 null，否则 null 会被拒绝
+				if values, ok := prop["enum"].([]string); ok {
+					enum := make([]interface{}, 0, len(values)+1)
+					for _, v := range values {
+						enum = append(enum, v)
+					}
+					prop["enum"] = append(enum, nil)
+				}
+			}
+			*required = append(*required, name)
+		} else if !optional {
+			*required = append(*required, name)
+		}
+
+		properties[name] = prop
+	}
+	return nil
+}
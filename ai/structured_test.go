@@ -0,0 +1,190 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// personInfo 结构化输出测试类型
+type personInfo struct {
+	Name       string   `json:"name" description:"姓名"`
+	Age        int      `json:"age"`
+	Occupation string   `json:"occupation" enum:"engineer,teacher,doctor"`
+	Hobbies    []string `json:"hobbies,omitempty"`
+	Nickname   *string  `json:"nickname"`
+}
+
+// newTestServer 启动返回预设回复的模拟服务器，并记录收到的请求
+func newTestServer(t *testing.T, replies ...string) (*Client, *[]map[string]interface{}) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		mu.Lock()
+		requests = append(requests, body)
+		reply := replies[(len(requests)-1)%len(replies)]
+		mu.Unlock()
+
+		resp := ChatResponse{
+			ID:     fmt.Sprintf("chatcmpl-%d", len(requests)),
+			Object: "chat.completion",
+			Model:  fmt.Sprint(body["model"]),
+			Choices: []Choice{{
+				Message:      &Message{Role: "assistant", Content: TextContent(reply)},
+				FinishReason: "stop",
+			}},
+			Usage: &Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewClient(NewConfig(server.URL, "test-key")), &requests
+}
+
+// TestGenerateSchema 测试从 Go 类型生成 Schema
+func TestGenerateSchema(t *testing.T) {
+	schema, err := SchemaFor[personInfo](true)
+	if err != nil {
+		t.Fatalf("生成Schema失败: %v", err)
+	}
+
+	props := schema["properties"].(map[string]interface{})
+	if len(schema["required"].([]string)) != 5 || schema["additionalProperties"] != false {
+		t.Errorf("strict模式下所有字段都应该必填: %v", schema["required"])
+	}
+	if props["name"].(map[string]interface{})["description"] != "姓名" {
+		t.Errorf("description标签未生效: %v", props["name"])
+	}
+	if enum := props["occupation"].(map[string]interface{})["enum"].([]string); len(enum) != 3 {
+		t.Errorf("enum标签未生效: %v", enum)
+	}
+	if typ := props["nickname"].(map[string]interface{})["type"].([]string); typ[1] != "null" {
+		t.Errorf("指针字段应该允许null: %v", typ)
+	}
+
+	loose, _ := SchemaFor[personInfo](false)
+	if required := loose["required"].([]string); len(required) != 3 {
+		t.Errorf("非strict模式下omitempty和指针字段不应必填: %v", required)
+	}
+
+	// strict 模式下可选的 enum 字段同时允许 null
+	type ticket struct {
+		Priority *string `json:"priority" enum:"low,high"`
+		Status   string  `json:"status,omitempty" enum:"open,closed"`
+	}
+	tickets, err := SchemaFor[ticket](true)
+	if err != nil {
+		t.Fatalf("生成Schema失败: %v", err)
+	}
+	for _, name := range []string{"priority", "status"} {
+		prop := tickets["properties"].(map[string]interface{})[name].(map[string]interface{})
+		if enum, ok := prop["enum"].([]interface{}); !ok || len(enum) != 3 || enum[2] != nil {
+			t.Errorf("%s的enum应该包含null: %v", name, prop["enum"])
+		}
+	}
+	tickets, _ = SchemaFor[ticket](false)
+	if enum := tickets["properties"].(map[string]interface{})["priority"].(map[string]interface{})["enum"]; !reflect.DeepEqual(enum, []string{"low", "high"}) {
+		t.Errorf("非strict模式下enum不应包含null: %v", enum)
+	}
+
+	type node struct {
+		Children []node `json:"children"`
+	}
+	if _, err := SchemaFor[node](true); err == nil {
+		t.Error("递归类型应该返回错误")
+	}
+
+	// strict 模式不支持的类型在本地报错
+	type withMap struct {
+		Labels map[string]string `json:"labels"`
+	}
+	type withInterface struct {
+		Value interface{} `json:"value"`
+	}
+	type withRaw struct {
+		Raw json.RawMessage `json:"raw"`
+	}
+	strictCases := map[string]func() error{
+		"map":       func() error { _, err := SchemaFor[withMap](true); return err },
+		"interface": func() error { _, err := SchemaFor[withInterface](true); return err },
+		"raw":       func() error { _, err := SchemaFor[withRaw](true); return err },
+		"slice":     func() error { _, err := SchemaFor[[]personInfo](true); return err },
+		"string":    func() error { _, err := SchemaFor[string](true); return err },
+	}
+	for name, generate := range strictCases {
+		if err := generate(); err == nil || !strings.Contains(err.Error(), "strict schema") {
+			t.Errorf("%s: strict模式应该返回错误，实际%v", name, err)
+		}
+	}
+	if schema, err := SchemaFor[withMap](false); err != nil || schema["properties"].(map[string]interface{})["labels"].(map[string]interface{})["additionalProperties"] == nil {
+		t.Errorf("非strict模式应该支持map: %v", err)
+	}
+	if _, err := SchemaFor[[]personInfo](false); err != nil {
+		t.Errorf("非strict模式应该支持非对象的根类型: %v", err)
+	}
+	if _, err := ChatInto[[]personInfo](context.Background(), NewClient(NewConfig("http://127.0.0.1:1", "k")), NewRequest("m").Build()); err == nil || !strings.Contains(err.Error(), "strict schema") {
+		t.Errorf("ChatInto应该在发送前返回本地错误: %v", err)
+	}
+
+	t.Logf("Schema生成测试通过")
+}
+
+// TestChatInto 测试结构化输出解码和失败重试
+func TestChatInto(t *testing.T) {
+	client, requests := newTestServer(t,
+		`{"name": "张三", "age": "三十"}`,
+		"```json\n{\"name\":\"张三\",\"age\":30,\"occupation\":\"engineer\",\"hobbies\":[\"围棋\"],\"nickname\":null}\n```",
+	)
+
+	req := NewRequest("gpt-4.1").
+		Messages(NewMessageBuilder().User("描述一个人").Build()).
+		Build()
+
+	person, err := ChatInto[personInfo](context.Background(), client, req)
+	if err != nil {
+		t.Fatalf("结构化输出失败: %v", err)
+	}
+	if person.Name != "张三" || person.Age != 30 || person.Occupation != "engineer" {
+		t.Errorf("解码结果错误: %+v", person)
+	}
+
+	if len(*requests) != 2 {
+		t.Fatalf("期望重试1次共2个请求，实际%d个", len(*requests))
+	}
+	first := (*requests)[0]
+	format := first["response_format"].(map[string]interface{})
+	if format["type"] != "json_schema" || format["json_schema"].(map[string]interface{})["name"] != "personInfo" {
+		t.Errorf("response_format设置错误: %v", format)
+	}
+	retry := (*requests)[1]["messages"].([]interface{})
+	if len(retry) != 3 || !strings.Contains(fmt.Sprint(retry[2]), "expected integer") {
+		t.Errorf("重试请求应该包含校验错误: %v", retry)
+	}
+	if len(req.Messages) != 1 {
+		t.Errorf("不应该修改调用方的请求")
+	}
+
+	// 重试次数耗尽
+	client, _ = newTestServer(t, `not json`)
+	_, err = ChatIntoWithRetries[personInfo](context.Background(), client, req, 1)
+	var structErr *StructuredOutputError
+	if !errors.As(err, &structErr) || structErr.Attempts != 2 {
+		t.Errorf("期望StructuredOutputError，实际%v", err)
+	}
+
+	t.Logf("结构化输出测试通过")
+}
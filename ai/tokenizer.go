@@ -0,0 +1,510 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// 支持的编码名称
+const (
+	EncodingCL100K = "cl100k_base"
+	EncodingO200K  = "o200k_base"
+)
+
+// TiktokenDirEnv 存放 .tiktoken 秩表文件的目录的环境变量
+const TiktokenDirEnv = "TIKTOKEN_DIR"
+
+// whitespaceClass Unicode 空白字符（Go 正则的 \s 只匹配 ASCII）
+const whitespaceClass = `\t\n\v\f\r \x{85}\x{A0}\x{1680}\x{2000}-\x{200A}\x{2028}\x{2029}\x{202F}\x{205F}\x{3000}`
+
+// 预分词规则，与 tiktoken 一致；\s+(?!\S) 分支由 splitPieces 手工处理
+var (
+	cl100kPattern = regexp.MustCompile(strings.ReplaceAll(
+		`^(?:(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^WS\p{L}\p{N}]+[\r\n]*|[WS]*[\r\n]+)`,
+		"WS", whitespaceClass))
+
+	o200kPattern = regexp.MustCompile(strings.ReplaceAll(
+		`^(?:[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?`+
+			`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?`+
+			`|\p{N}{1,3}| ?[^WS\p{L}\p{N}]+[\r\n/]*|[WS]*[\r\n]+)`,
+		"WS", whitespaceClass))
+)
+
+// Encoding BPE 编码器
+type Encoding struct {
+	Name    string
+	ranks   map[string]int
+	decoder map[int]string
+	pattern *regexp.Regexp
+}
+
+var (
+	encodingsMu sync.RWMutex
+	encodings   = make(map[string]*Encoding)
+)
+
+// LoadEncoding 从 .tiktoken 格式（每行“base64 令牌 秩”）读取秩表并创建编码器
+func LoadEncoding(name string, r io.Reader) (*Encoding, error) {
+	pattern := cl100kPattern
+	if name == EncodingO200K {
+		pattern = o200kPattern
+	}
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("%s line %d: expected '<base64 token> <rank>'", name, line)
+		}
+		raw, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", name, line, err)
+		}
+		value, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", name, line, err)
+		}
+		ranks[string(raw)] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("%s: empty rank table", name)
+	}
+
+	decoder := make(map[int]string, len(ranks))
+	for token, rank := range ranks {
+		decoder[rank] = token
+	}
+
+	return &Encoding{Name: name, ranks: ranks, decoder: decoder, pattern: pattern}, nil
+}
+
+// RegisterEncoding 注册编码器，之后可通过 GetEncoding 获取
+func RegisterEncoding(enc *Encoding) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	encodings[enc.Name] = enc
+}
+
+// GetEncoding 获取编码器
+//
+// 依次查找：已注册的编码器、嵌入的 cl100k_base 和 o200k_base 秩表（见 tiktoken 目录）、
+// TIKTOKEN_DIR 目录下的 <name>.tiktoken 文件。
+// cl100k_base 和 o200k_base 的秩表会按官方的 SHA-256 校验。
+func GetEncoding(name string) (*Encoding, error) {
+	encodingsMu.RLock()
+	enc, ok := encodings[name]
+	encodingsMu.RUnlock()
+	if ok {
+		return enc, nil
+	}
+
+	data, ok, err := embeddedRanks(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		dir := os.Getenv(TiktokenDirEnv)
+		if dir == "" {
+			return nil, fmt.Errorf("encoding %s not available: register it or set %s", name, TiktokenDirEnv)
+		}
+		if data, err = os.ReadFile(filepath.Join(dir, name+".tiktoken")); err != nil {
+			return nil, fmt.Errorf("encoding %s not available: %w", name, err)
+		}
+	}
+	if err := verifyRanks(name, data); err != nil {
+		return nil, err
+	}
+
+	enc, err = LoadEncoding(name, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	RegisterEncoding(enc)
+	return enc, nil
+}
+
+// EncodingForModel 返回模型使用的编码名称，未知模型按 o200k_base 处理
+func EncodingForModel(model string) string {
+	m := strings.ToLower(model)
+	if idx := strings.LastIndex(m, "/"); idx >= 0 {
+		m = m[idx+1:]
+	}
+	for _, prefix := range []string{"gpt-4-", "gpt-4", "gpt-3.5", "text-embedding-3", "text-embedding-ada"} {
+		if strings.HasPrefix(m, prefix) && !strings.HasPrefix(m, "gpt-4o") && !strings.HasPrefix(m, "gpt-4.") {
+			return EncodingCL100K
+		}
+	}
+	return EncodingO200K
+}
+
+// Encode 将文本编码为令牌序列
+func (e *Encoding) Encode(text string) []int {
+	var tokens []int
+	for _, piece := range splitPieces(e.pattern, text) {
+		if rank, ok := e.ranks[piece]; ok {
+			tokens = append(tokens, rank)
+			continue
+		}
+		tokens = append(tokens, e.bytePairEncode(piece)...)
+	}
+	return tokens
+}
+
+// Count 返回文本的令牌数
+func (e *Encoding) Count(text string) int {
+	count := 0
+	for _, piece := range splitPieces(e.pattern, text) {
+		if _, ok := e.ranks[piece]; ok {
+			count++
+			continue
+		}
+		count += len(e.bytePairEncode(piece))
+	}
+	return count
+}
+
+// Decode 将令牌序列解码为文本
+func (e *Encoding) Decode(tokens []int) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteString(e.decoder[token])
+	}
+	return b.String()
+}
+
+// bytePairEncode 对单个预分词片段执行 BPE 合并
+func (e *Encoding) bytePairEncode(piece string) []int {
+	parts := make([]string, 0, len(piece))
+	for i := 0; i < len(piece); i++ {
+		parts = append(parts, piece[i:i+1])
+	}
+
+	for len(parts) > 1 {
+		best, bestRank := -1, 0
+		for i := 0; i < len(parts)-1; i++ {
+			rank, ok := e.ranks[parts[i]+parts[i+1]]
+			if ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+
+	tokens := make([]int, 0, len(parts))
+	for _, part := range parts {
+		if rank, ok := e.ranks[part]; ok {
+			tokens = append(tokens, rank)
+		}
+	}
+	return tokens
+}
+
+// splitPieces 按预分词规则切分文本
+func splitPieces(pattern *regexp.Regexp, text string) []string {
+	var pieces []string
+	for i := 0; i < len(text); {
+		if loc := pattern.FindStringIndex(text[i:]); loc != nil && loc[1] > 0 {
+			pieces = append(pieces, text[i:i+loc[1]])
+			i += loc[1]
+			continue
+		}
+
+		// \s+(?!\S)：空白串后跟非空白时留下最后一个空白字符给下一个片段
+		end := i
+		var last int
+		for end < len(text) {
+			r, size := utf8.DecodeRuneInString(text[end:])
+			if !isTokenizerSpace(r) {
+				break
+			}
+			last = size
+			end += size
+		}
+		if end > i {
+			if end < len(text) && end-last > i {
+				end -= last
+			}
+			pieces = append(pieces, text[i:end])
+			i = end
+			continue
+		}
+
+		// 理论上不会到达，保证前进
+		_, size := utf8.DecodeRuneInString(text[i:])
+		pieces = append(pieces, text[i:i+size])
+		i += size
+	}
+	return pieces
+}
+
+// isTokenizerSpace 判断是否为 Unicode 空白字符
+func isTokenizerSpace(r rune) bool {
+	switch r {
+	case '\t', '\n', '\v', '\f', '\r', ' ', 0x85, 0xA0, 0x1680, 0x2028, 0x2029, 0x202F, 0x205F, 0x3000:
+		return true
+	}
+	return r >= 0x2000 && r <= 0x200A
+}
+
+// 聊天格式的固定开销，参见 OpenAI cookbook 的计算方法
+const (
+	tokensPerMessage   = 3
+	tokensPerName      = 1
+	tokensReplyPrimer  = 3
+	tokensPerToolCall  = 3
+	tokensImageLow     = 85
+	tokensImageTile    = 170
+	tokensImageDefault = 765
+	tokensFunctionInit = 7
+	tokensFunctionEnd  = 12
+	tokensPropertyInit = 3
+	tokensPropertyKey  = 3
+	tokensEnumInit     = -3
+	tokensEnumItem     = 3
+)
+
+// CountMessageTokens 计算消息在聊天格式下的令牌数，包含每条消息的固定开销和图片
+//
+// 模型对应的编码不可用时返回错误；只需要粗略值时使用 EstimateTokens。
+func CountMessageTokens(messages []Message, model string) (int, error) {
+	enc, err := GetEncoding(EncodingForModel(model))
+	if err != nil {
+		return 0, err
+	}
+	return countMessageTokens(enc, messages), nil
+}
+
+// countMessageTokens 用指定编码计算消息的令牌数
+func countMessageTokens(enc *Encoding, messages []Message) int {
+	total := tokensReplyPrimer
+	for _, msg := range messages {
+		total += tokensPerMessage + enc.Count(msg.Role)
+		if msg.Name != "" {
+			total += tokensPerName + enc.Count(msg.Name)
+		}
+		total += enc.Count(msg.Content.Text)
+		for _, part := range msg.Content.Parts {
+			total += countPartTokens(enc, part)
+		}
+		total += enc.Count(msg.ReasoningContent)
+		for _, call := range msg.ToolCalls {
+			total += tokensPerToolCall + enc.Count(call.Function.Name) + enc.Count(call.Function.Arguments)
+		}
+		if msg.ToolCallID != "" {
+			total += enc.Count(msg.ToolCallID)
+		}
+	}
+	return total
+}
+
+// countPartTokens 计算多模态片段的令牌数
+func countPartTokens(enc *Encoding, part ContentPart) int {
+	switch part.Type {
+	case ContentTypeText:
+		return enc.Count(part.Text)
+	case ContentTypeRefusal:
+		return enc.Count(part.Refusal)
+	case ContentTypeImageURL:
+		if part.ImageURL == nil {
+			return 0
+		}
+		return ImageTokens(part.ImageURL)
+	case ContentTypeInputAudio:
+		if part.InputAudio == nil {
+			return 0
+		}
+		// 约每秒 10 个令牌，按 16kHz 16bit 单声道估算时长
+		seconds := base64.StdEncoding.DecodedLen(len(part.InputAudio.Data)) / 32000
+		return 10 * (seconds + 1)
+	default:
+		return tokensImageDefault
+	}
+}
+
+// ImageTokens 按 OpenAI 的分块规则计算图片令牌数，无法得知尺寸时按 1024x1024 估算
+func ImageTokens(img *ImageURL) int {
+	if img.Detail == ImageDetailLow {
+		return tokensImageLow
+	}
+
+	width, height := 1024, 1024
+	if strings.HasPrefix(img.URL, "data:") {
+		if _, payload, ok := strings.Cut(img.URL, ","); ok {
+			if data, err := base64.StdEncoding.DecodeString(payload); err == nil {
+				if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+					width, height = cfg.Width, cfg.Height
+				}
+			}
+		}
+	}
+
+	// 先缩放到 2048x2048 以内，再把短边缩放到 768
+	w, h := float64(width), float64(height)
+	if w > 2048 || h > 2048 {
+		scale := 2048 / max(w, h)
+		w, h = w*scale, h*scale
+	}
+	if short := min(w, h); short > 768 {
+		scale := 768 / short
+		w, h = w*scale, h*scale
+	}
+
+	tiles := ((int(w) + 511) / 512) * ((int(h) + 511) / 512)
+	return tokensImageLow + tokensImageTile*tiles
+}
+
+// CountToolTokens 计算工具定义的令牌数（近似），模型对应的编码不可用时返回错误
+func CountToolTokens(tools []Tool, model string) (int, error) {
+	if len(tools) == 0 {
+		return 0, nil
+	}
+	enc, err := GetEncoding(EncodingForModel(model))
+	if err != nil {
+		return 0, err
+	}
+	return countToolTokens(enc.Count, tools), nil
+}
+
+// countToolTokens 用 count 计算工具定义的令牌数
+func countToolTokens(count func(string) int, tools []Tool) int {
+	if len(tools) == 0 {
+		return 0
+	}
+	total := 0
+	for _, tool := range tools {
+		total += tokensFunctionInit + count(tool.Function.Name) + count(tool.Function.Description)
+
+		schema, err := normalizeSchema(tool.Function.Parameters)
+		if err != nil {
+			continue
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		if len(props) > 0 {
+			total += tokensPropertyInit
+		}
+		for name, raw := range props {
+			prop, _ := raw.(map[string]interface{})
+			total += tokensPropertyKey + count(name)
+			if t, ok := prop["type"].(string); ok {
+				total += count(t)
+			}
+			if desc, ok := prop["description"].(string); ok {
+				total += count(desc)
+			}
+			if enum, ok := prop["enum"].([]interface{}); ok {
+				total += tokensEnumInit
+				for _, item := range enum {
+					total += tokensEnumItem + count(fmt.Sprint(item))
+				}
+			}
+		}
+	}
+	return total + tokensFunctionEnd
+}
+
+// CountRequestTokens 计算请求的输入令牌数（消息和工具定义），模型对应的编码不可用时返回错误
+func CountRequestTokens(req *ChatRequest) (int, error) {
+	enc, err := GetEncoding(EncodingForModel(req.Model))
+	if err != nil {
+		return 0, err
+	}
+	return countMessageTokens(enc, req.Messages) + countToolTokens(enc.Count, req.Tools), nil
+}
+
+// TokenCounterFor 返回按指定模型计数的 TokenCounter，可用于 Conversation.SetTokenBudget
+//
+// 模型对应的编码不可用时返回错误。
+func TokenCounterFor(model string) (TokenCounter, error) {
+	enc, err := GetEncoding(EncodingForModel(model))
+	if err != nil {
+		return nil, err
+	}
+	return func(messages []Message) int {
+		return countMessageTokens(enc, messages)
+	}, nil
+}
+
+// contextWindows 常见模型的上下文窗口，按前缀匹配，越具体的前缀越靠前
+var contextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-4.1", 1047576},
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4-32k", 32768},
+	{"gpt-4", 8192},
+	{"gpt-3.5-turbo", 16385},
+	{"gpt-5", 400000},
+	{"o1-mini", 128000},
+	{"o1", 200000},
+	{"o3", 200000},
+	{"o4-mini", 200000},
+	{"deepseek", 65536},
+	{"claude", 200000},
+	{"qwen", 131072},
+}
+
+// ContextWindow 返回模型的上下文窗口大小，未知模型返回 0
+func ContextWindow(model string) int {
+	m := strings.ToLower(model)
+	if idx := strings.LastIndex(m, "/"); idx >= 0 {
+		m = m[idx+1:]
+	}
+	for _, w := range contextWindows {
+		if strings.HasPrefix(m, w.prefix) {
+			return w.tokens
+		}
+	}
+	return 0
+}
+
+// ValidateContextWindow 检查请求的输入令牌加上 MaxTokens 是否超出模型的上下文窗口
+//
+// window 为 0 时使用 ContextWindow 的内置值，模型未知时不做检查。
+func ValidateContextWindow(req *ChatRequest, window int) error {
+	if window <= 0 {
+		window = ContextWindow(req.Model)
+	}
+	if window <= 0 {
+		return nil
+	}
+
+	needed, err := CountRequestTokens(req)
+	if err != nil {
+		return err
+	}
+	if req.MaxTokens != nil {
+		needed += *req.MaxTokens
+	}
+	if needed > window {
+		return &ValidationError{
+			Field:   "messages",
+			Message: fmt.Sprintf("request needs about %d tokens but %s has a context window of %d", needed, req.Model, window),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package ai
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+//go:generate go run gen_tiktoken.go
+
+// tiktokenFS 嵌入的 gzip 压缩秩表，文件随源码提交，go generate 用于重新下载和校验
+//
+//go:embed tiktoken/*.tiktoken.gz
+var tiktokenFS embed.FS
+
+// tiktokenSHA256 秩表文件的 SHA-256，与 tiktoken 官方实现中的 expected_hash 相同
+var tiktokenSHA256 = map[string]string{
+	EncodingCL100K: "223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7",
+	EncodingO200K:  "446a9538cb6c348e3516120d7c08b09f57c36495e2acfffe59a5bf8b0cfb1a2d",
+}
+
+// embeddedRanks 返回解压后的嵌入秩表，没有嵌入该编码时返回 false
+func embeddedRanks(name string) ([]byte, bool, error) {
+	compressed, err := tiktokenFS.ReadFile("tiktoken/" + name + ".tiktoken.gz")
+	if err != nil {
+		return nil, false, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, true, fmt.Errorf("encoding %s: failed to decompress rank table: %w", name, err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, true, fmt.Errorf("encoding %s: failed to decompress rank table: %w", name, err)
+	}
+	return data, true, nil
+}
+
+// verifyRanks 校验已知编码的秩表内容，避免使用下载不完整或被替换的文件
+func verifyRanks(name string, data []byte) error {
+	want, ok := tiktokenSHA256[name]
+	if !ok {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("encoding %s: rank table checksum mismatch (got %s, want %s)", name, got, want)
+	}
+	return nil
+}
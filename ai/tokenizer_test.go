@@ -0,0 +1,220 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testRankTable 生成包含全部单字节和少量合并规则的秩表
+func testRankTable(merges ...string) string {
+	var b strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, merge := range merges {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(merge)), 256+i)
+	}
+	return b.String()
+}
+
+// useTestEncoding 临时注册测试编码器
+func useTestEncoding(t *testing.T, name string, merges ...string) *Encoding {
+	t.Helper()
+	enc, err := LoadEncoding(name, strings.NewReader(testRankTable(merges...)))
+	if err != nil {
+		t.Fatalf("加载秩表失败: %v", err)
+	}
+	RegisterEncoding(enc)
+	t.Cleanup(func() {
+		encodingsMu.Lock()
+		delete(encodings, name)
+		encodingsMu.Unlock()
+	})
+	return enc
+}
+
+// TestPretokenize 测试与 tiktoken 一致的预分词
+func TestPretokenize(t *testing.T) {
+	got := splitPieces(cl100kPattern, "Hello, world!  How's it going?\n\n123456")
+	want := []string{"Hello", ",", " world", "!", " ", " How", "'s", " it", " going", "?\n\n", "123", "456"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cl100k预分词错误\n期望: %q\n实际: %q", want, got)
+	}
+
+	got = splitPieces(cl100kPattern, "缩进:\n    return x  ")
+	want = []string{"缩进", ":\n", "   ", " return", " x", "  "}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("空白处理错误\n期望: %q\n实际: %q", want, got)
+	}
+
+	got = splitPieces(o200kPattern, "HelloWorld I'M here")
+	want = []string{"Hello", "World", " I'M", " here"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("o200k预分词错误\n期望: %q\n实际: %q", want, got)
+	}
+
+	t.Logf("预分词测试通过")
+}
+
+// TestBytePairEncoding 测试 BPE 合并、编码和解码
+func TestBytePairEncoding(t *testing.T) {
+	enc := useTestEncoding(t, EncodingCL100K, "he", "ll", "hell", " w", " wo")
+
+	tokens := enc.Encode("hello wow")
+	want := []int{258, 'o', 260, 'w'}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("编码错误，期望%v，实际%v", want, tokens)
+	}
+	if enc.Decode(tokens) != "hello wow" || enc.Count("hello wow") != 4 {
+		t.Errorf("解码或计数错误: %q %d", enc.Decode(tokens), enc.Count("hello wow"))
+	}
+	if n := enc.Count("你好"); n != 6 {
+		t.Errorf("未合并的多字节字符应该按字节计数，实际%d", n)
+	}
+
+	if _, err := LoadEncoding("bad", strings.NewReader("not-a-rank-line\n")); err == nil {
+		t.Error("格式错误的秩表应该返回错误")
+	}
+
+	if EncodingForModel("gpt-4") != EncodingCL100K || EncodingForModel("gpt-4o-mini") != EncodingO200K ||
+		EncodingForModel("gpt-4.1") != EncodingO200K || EncodingForModel("openai/gpt-3.5-turbo") != EncodingCL100K {
+		t.Error("模型编码映射错误")
+	}
+
+	t.Logf("BPE编码测试通过")
+}
+
+// TestCountMessageTokens 测试聊天格式的令牌计数和上下文窗口检查
+func TestCountMessageTokens(t *testing.T) {
+	useTestEncoding(t, EncodingCL100K)
+
+	messages := NewMessageBuilder().
+		System("abc").
+		UserWithParts(TextPart("hi"), ImagePart("https://example.com/a.png", ImageDetailLow)).
+		Build()
+
+	// 回复起始 3 + 每条消息 3 + 角色 + 内容（测试秩表中每个字节一个令牌）
+	want := 3 + (3 + 6 + 3) + (3 + 4 + 2 + tokensImageLow)
+	if got, err := CountMessageTokens(messages, "gpt-4"); err != nil || got != want {
+		t.Errorf("消息令牌数错误，期望%d，实际%d: %v", want, got, err)
+	}
+	counter, err := TokenCounterFor("gpt-4")
+	if err != nil || counter(messages) != want {
+		t.Errorf("TokenCounterFor 的计数错误: %v", err)
+	}
+
+	if ImageTokens(&ImageURL{URL: "https://example.com/a.png"}) != tokensImageLow+tokensImageTile*4 {
+		t.Error("默认图片尺寸应该按1024x1024计算4个分块")
+	}
+
+	tools := NewToolBuilder().AddWeatherFunction().Build()
+	if got, err := CountToolTokens(tools, "gpt-4"); err != nil || got <= tokensFunctionInit+tokensFunctionEnd {
+		t.Error("工具定义令牌数应该包含参数")
+	}
+
+	req := NewRequest("gpt-4").Messages(messages).MaxTokens(100).Build()
+	if err := ValidateContextWindow(req, 0); err != nil {
+		t.Errorf("未超出窗口不应该报错: %v", err)
+	}
+	err = ValidateContextWindow(req, 120)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Errorf("超出窗口应该返回ValidationError，实际%v", err)
+	}
+	if ContextWindow("unknown-model") != 0 || ValidateContextWindow(NewRequest("unknown-model").MaxTokens(1<<30).Build(), 0) != nil {
+		t.Error("未知模型不应该检查上下文窗口")
+	}
+
+	t.Logf("消息令牌计数测试通过")
+}
+
+// loadRealEncoding 加载嵌入的官方秩表，秩表缺失时测试失败
+func loadRealEncoding(t *testing.T, name string) *Encoding {
+	t.Helper()
+	data, ok, err := embeddedRanks(name)
+	if err != nil || !ok {
+		t.Fatalf("%s 秩表没有嵌入: %v", name, err)
+	}
+	if err := verifyRanks(name, data); err != nil {
+		t.Fatalf("秩表校验失败: %v", err)
+	}
+	enc, err := LoadEncoding(name, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("加载秩表失败: %v", err)
+	}
+	return enc
+}
+
+// TestTiktokenKnownOutputs 与官方 tiktoken 的编码结果对比
+func TestTiktokenKnownOutputs(t *testing.T) {
+	cases := []struct {
+		encoding string
+		text     string
+		want     []int
+	}{
+		{EncodingCL100K, "hello world", []int{15339, 1917}},
+		{EncodingCL100K, "tiktoken is great!", []int{83, 1609, 5963, 374, 2294, 0}},
+		{EncodingO200K, "hello world", []int{24912, 2375}},
+		{EncodingO200K, "tiktoken is great!", []int{83, 8251, 2488, 382, 2212, 0}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.encoding+"/"+tc.text, func(t *testing.T) {
+			enc := loadRealEncoding(t, tc.encoding)
+			if got := enc.Encode(tc.text); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("编码结果错误: got %v, want %v", got, tc.want)
+			}
+			if got := enc.Count(tc.text); got != len(tc.want) {
+				t.Errorf("计数错误: got %d, want %d", got, len(tc.want))
+			}
+			if got := enc.Decode(tc.want); got != tc.text {
+				t.Errorf("解码错误: %q", got)
+			}
+		})
+	}
+	t.Logf("官方秩表测试通过")
+}
+
+// TestRankTableChecksum 测试秩表校验和不可用时的错误
+func TestRankTableChecksum(t *testing.T) {
+	if err := verifyRanks(EncodingCL100K, []byte(testRankTable())); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("内容不符的秩表应该报错: %v", err)
+	}
+	if err := verifyRanks("custom", []byte(testRankTable())); err != nil {
+		t.Errorf("未知编码不做校验: %v", err)
+	}
+
+	// 嵌入的秩表可以直接使用
+	enc, err := GetEncoding(EncodingO200K)
+	if err != nil || enc.Name != EncodingO200K {
+		t.Fatalf("嵌入的秩表应该可用: %v", err)
+	}
+	messages := []Message{{Role: "user", Content: TextContent("hello world")}}
+	if got, err := CountMessageTokens(messages, "gpt-4o"); err != nil || got != 3+3+1+2 {
+		t.Errorf("gpt-4o 的消息令牌数错误: %d %v", got, err)
+	}
+
+	// 没有嵌入的编码从 TIKTOKEN_DIR 读取，未设置时报错
+	t.Setenv(TiktokenDirEnv, "")
+	if _, err := GetEncoding("p50k_base"); err == nil || !strings.Contains(err.Error(), TiktokenDirEnv) {
+		t.Errorf("没有嵌入的编码应该提示设置 %s: %v", TiktokenDirEnv, err)
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "p50k_base.tiktoken"), []byte(testRankTable()), 0o644)
+	t.Setenv(TiktokenDirEnv, dir)
+	t.Cleanup(func() {
+		encodingsMu.Lock()
+		delete(encodings, "p50k_base")
+		encodingsMu.Unlock()
+	})
+	if _, err := GetEncoding("p50k_base"); err != nil {
+		t.Errorf("应该从 %s 加载: %v", TiktokenDirEnv, err)
+	}
+	t.Logf("秩表校验测试通过")
+}
@@ -0,0 +1,436 @@
+package ai
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 本文件实现一个无依赖的 TOML 子集解析器，用于配置文件。
+// 支持：键值对、点分键、[table]、[[array.of.tables]]、基本和字面量字符串（含三引号多行形式）、
+// 整数、浮点数、布尔值、数组（可跨行）和行内表。不支持日期时间类型。
+
+// parseTOML 解析 TOML，返回 map[string]interface{}
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	text := strings.TrimPrefix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\ufeff")
+	p := &tomlParser{s: text, line: 1}
+	root := make(map[string]interface{})
+	current := root
+
+	for {
+		p.skipWhitespaceAndComments()
+		if p.eof() {
+			return root, nil
+		}
+
+		if p.peek() == '[' {
+			table, err := p.parseTableHeader(root)
+			if err != nil {
+				return nil, err
+			}
+			current = table
+		} else {
+			if err := p.parseKeyValue(current); err != nil {
+				return nil, err
+			}
+		}
+
+		// 每条语句后只能是注释或换行
+		p.skipInlineSpace()
+		if !p.eof() && p.peek() == '#' {
+			p.skipComment()
+		}
+		if !p.eof() && p.peek() != '\n' {
+			return nil, p.errorf("unexpected %q after statement", p.peek())
+		}
+	}
+}
+
+// tomlParser 按字符解析 TOML
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *tomlParser) peek() byte {
+	return p.s[p.pos]
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("toml line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) advance() {
+	if p.s[p.pos] == '\n' {
+		p.line++
+	}
+	p.pos++
+}
+
+func (p *tomlParser) skipInlineSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+func (p *tomlParser) skipComment() {
+	for !p.eof() && p.peek() != '\n' {
+		p.pos++
+	}
+}
+
+func (p *tomlParser) skipWhitespaceAndComments() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\n':
+			p.advance()
+		case '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+// parseTableHeader 解析 [a.b] 或 [[a.b]]，返回后续键值对所属的表
+func (p *tomlParser) parseTableHeader(root map[string]interface{}) (map[string]interface{}, error) {
+	arrayTable := strings.HasPrefix(p.s[p.pos:], "[[")
+	if arrayTable {
+		p.pos += 2
+	} else {
+		p.pos++
+	}
+
+	keys, err := p.parseKey()
+	if err != nil {
+		return nil, err
+	}
+	p.skipInlineSpace()
+	closing := "]"
+	if arrayTable {
+		closing = "]]"
+	}
+	if !strings.HasPrefix(p.s[p.pos:], closing) {
+		return nil, p.errorf("expected %s", closing)
+	}
+	p.pos += len(closing)
+
+	parent, err := p.descend(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+
+	if arrayTable {
+		table := make(map[string]interface{})
+		switch existing := parent[last].(type) {
+		case nil:
+			parent[last] = []interface{}{table}
+		case []interface{}:
+			parent[last] = append(existing, table)
+		default:
+			return nil, p.errorf("key %q is not an array of tables", last)
+		}
+		return table, nil
+	}
+
+	switch existing := parent[last].(type) {
+	case nil:
+		table := make(map[string]interface{})
+		parent[last] = table
+		return table, nil
+	case map[string]interface{}:
+		return existing, nil
+	default:
+		return nil, p.errorf("key %q is already defined as a value", last)
+	}
+}
+
+// descend 沿点分键进入（必要时创建）子表，数组表取最后一个元素
+func (p *tomlParser) descend(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, key := range keys {
+		switch next := table[key].(type) {
+		case nil:
+			child := make(map[string]interface{})
+			table[key] = child
+			table = child
+		case map[string]interface{}:
+			table = next
+		case []interface{}:
+			if len(next) == 0 {
+				return nil, p.errorf("key %q is not a table", key)
+			}
+			last, ok := next[len(next)-1].(map[string]interface{})
+			if !ok {
+				return nil, p.errorf("key %q is not a table", key)
+			}
+			table = last
+		default:
+			return nil, p.errorf("key %q is already defined as a value", key)
+		}
+	}
+	return table, nil
+}
+
+// parseKey 解析可能带点和引号的键
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipInlineSpace()
+		if p.eof() {
+			return nil, p.errorf("expected key")
+		}
+		switch p.peek() {
+		case '"', '\'':
+			key, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		default:
+			start := p.pos
+			for !p.eof() && isTOMLBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, p.errorf("invalid key character %q", p.peek())
+			}
+			keys = append(keys, p.s[start:p.pos])
+		}
+		p.skipInlineSpace()
+		if p.eof() || p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isTOMLBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// parseKeyValue 解析 key = value 并写入表
+func (p *tomlParser) parseKeyValue(table map[string]interface{}) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if p.eof() || p.peek() != '=' {
+		return p.errorf("expected '=' after key %q", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skipInlineSpace()
+
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	parent, err := p.descend(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, exists := parent[last]; exists {
+		return p.errorf("duplicate key %q", strings.Join(keys, "."))
+	}
+	parent[last] = value
+	return nil
+}
+
+// parseValue 解析值
+func (p *tomlParser) parseValue() (interface{}, error) {
+	if p.eof() {
+		return nil, p.errorf("expected value")
+	}
+	switch p.peek() {
+	case '"', '\'':
+		return p.parseString()
+	case '[':
+		return p.parseArray()
+	case '{':
+		return p.parseInlineTable()
+	}
+
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\n,]}#", rune(p.peek())) {
+		p.pos++
+	}
+	raw := p.s[start:p.pos]
+	switch raw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf", "-inf", "nan", "+nan", "-nan":
+		return nil, p.errorf("unsupported float %q", raw)
+	}
+	clean := strings.ReplaceAll(raw, "_", "")
+	if n, err := strconv.ParseInt(clean, 0, 64); err == nil && !(len(clean) > 1 && clean[0] == '0' && clean[1] >= '0' && clean[1] <= '9') {
+		return int(n), nil
+	}
+	if f, err := strconv.ParseFloat(clean, 64); err == nil {
+		return f, nil
+	}
+	return nil, p.errorf("invalid value %q", raw)
+}
+
+// parseString 解析基本字符串、字面量字符串及其多行形式
+func (p *tomlParser) parseString() (string, error) {
+	quote := p.peek()
+	multi := strings.HasPrefix(p.s[p.pos:], strings.Repeat(string(quote), 3))
+	if multi {
+		p.pos += 3
+		// 紧跟开头引号的换行会被忽略
+		if !p.eof() && p.peek() == '\n' {
+			p.advance()
+		}
+	} else {
+		p.pos++
+	}
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		if multi && strings.HasPrefix(p.s[p.pos:], strings.Repeat(string(quote), 3)) {
+			p.pos += 3
+			return b.String(), nil
+		}
+		if !multi && c == quote {
+			p.pos++
+			return b.String(), nil
+		}
+		if !multi && c == '\n' {
+			return "", p.errorf("newline in single-line string")
+		}
+		if quote == '"' && c == '\\' {
+			p.pos++
+			if p.eof() {
+				return "", p.errorf("unterminated escape")
+			}
+			escaped, err := p.parseEscape(multi)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(escaped)
+			continue
+		}
+		b.WriteByte(c)
+		p.advance()
+	}
+}
+
+// parseEscape 解析反斜杠之后的转义序列
+func (p *tomlParser) parseEscape(multi bool) (string, error) {
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		return "\b", nil
+	case 't':
+		return "\t", nil
+	case 'n':
+		return "\n", nil
+	case 'f':
+		return "\f", nil
+	case 'r':
+		return "\r", nil
+	case '"':
+		return "\"", nil
+	case '\\':
+		return "\\", nil
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.s) {
+			return "", p.errorf("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(p.s[p.pos:p.pos+size], 16, 32)
+		if err != nil {
+			return "", p.errorf("invalid unicode escape %q", p.s[p.pos:p.pos+size])
+		}
+		p.pos += size
+		return string(rune(code)), nil
+	case ' ', '\t', '\n':
+		// 多行字符串中行尾的反斜杠会去掉换行和后续空白
+		if multi {
+			p.pos--
+			for !p.eof() && (p.peek() == ' ' || p.peek() == '\t' || p.peek() == '\n') {
+				p.advance()
+			}
+			return "", nil
+		}
+	}
+	return "", p.errorf("invalid escape \\%c", c)
+}
+
+// parseArray 解析数组，可跨行并包含注释
+func (p *tomlParser) parseArray() ([]interface{}, error) {
+	p.pos++ // [
+	result := make([]interface{}, 0)
+	for {
+		p.skipWhitespaceAndComments()
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return result, nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+		p.skipWhitespaceAndComments()
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("unexpected %q in array", p.peek())
+		}
+	}
+}
+
+// parseInlineTable 解析行内表 {a = 1, b = "x"}
+func (p *tomlParser) parseInlineTable() (map[string]interface{}, error) {
+	p.pos++ // {
+	result := make(map[string]interface{})
+	p.skipInlineSpace()
+	if !p.eof() && p.peek() == '}' {
+		p.pos++
+		return result, nil
+	}
+	for {
+		if err := p.parseKeyValue(result); err != nil {
+			return nil, err
+		}
+		p.skipInlineSpace()
+		if p.eof() {
+			return nil, p.errorf("unterminated inline table")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return result, nil
+		default:
+			return nil, p.errorf("unexpected %q in inline table", p.peek())
+		}
+	}
+}
@@ -0,0 +1,701 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ToolArgumentError 工具调用参数错误，可作为工具消息回传给模型以便其修正
+type ToolArgumentError struct {
+	ToolCallID string
+	Function   string
+	Arguments  string
+	Problems   []string
+}
+
+func (e *ToolArgumentError) Error() string {
+	return fmt.Sprintf("invalid arguments for tool '%s': %s", e.Function, strings.Join(e.Problems, "; "))
+}
+
+// ToolMessage 生成回传给模型的纠错工具消息
+func (e *ToolArgumentError) ToolMessage() Message {
+	payload := map[string]interface{}{
+		"error":    "invalid_arguments",
+		"function": e.Function,
+		"problems": e.Problems,
+		"hint":     "arguments must be a JSON object matching the declared parameters schema; please fix them and call the tool again",
+	}
+	content, _ := json.Marshal(payload)
+
+	return Message{
+		Role:       "tool",
+		Content:    TextContent(string(content)),
+		ToolCallID: e.ToolCallID,
+	}
+}
+
+// FindTool 按函数名查找工具定义
+func FindTool(tools []Tool, name string) *Tool {
+	for i := range tools {
+		if tools[i].Function.Name == name {
+			return &tools[i]
+		}
+	}
+	return nil
+}
+
+// PrepareToolCall 在分发前修复并校验工具调用参数
+func PrepareToolCall(tools []Tool, call *ToolCall) (map[string]interface{}, error) {
+	tool := FindTool(tools, call.Function.Name)
+	if tool == nil {
+		return nil, &ToolArgumentError{
+			ToolCallID: call.ID,
+			Function:   call.Function.Name,
+			Arguments:  call.Function.Arguments,
+			Problems:   []string{fmt.Sprintf("unknown function '%s'", call.Function.Name)},
+		}
+	}
+	return ParseToolArguments(tool, call)
+}
+
+// ParseToolArguments 修复并校验工具调用参数，成功时会把修复后的 JSON 写回 call.Function.Arguments
+func ParseToolArguments(tool *Tool, call *ToolCall) (map[string]interface{}, error) {
+	newErr := func(problems ...string) error {
+		return &ToolArgumentError{
+			ToolCallID: call.ID,
+			Function:   call.Function.Name,
+			Arguments:  call.Function.Arguments,
+			Problems:   problems,
+		}
+	}
+
+	repaired, err := RepairJSON(call.Function.Arguments)
+	if err != nil {
+		return nil, newErr(err.Error())
+	}
+
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(repaired), &args); err != nil {
+		return nil, newErr("arguments must be a JSON object")
+	}
+
+	if tool.Function.Parameters != nil {
+		if problems := ValidateJSONSchema(tool.Function.Parameters, args); len(problems) > 0 {
+			return nil, newErr(problems...)
+		}
+	}
+
+	call.Function.Arguments = repaired
+	return args, nil
+}
+
+// RepairJSON 宽松修复常见的 JSON 格式问题
+//
+// 支持：Markdown 代码块、前后多余文字、单引号字符串、未加引号的键、
+// 尾随逗号、缺失的逗号或冒号、Python 风格字面量以及被截断的字符串和括号。
+// 空输入会被视为空对象。
+func RepairJSON(input string) (string, error) {
+	s := strings.TrimSpace(input)
+	s = strings.TrimPrefix(s, "```json")
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimSuffix(s, "```")
+	s = strings.TrimSpace(s)
+
+	if s == "" {
+		return "{}", nil
+	}
+	if json.Valid([]byte(s)) {
+		return s, nil
+	}
+
+	start := strings.IndexAny(s, "{[")
+	if start < 0 {
+		return "", fmt.Errorf("arguments are not valid JSON: %q", truncateForError(input))
+	}
+
+	r := &jsonRepairer{src: s[start:]}
+	out := r.repair()
+	if !json.Valid([]byte(out)) {
+		return "", fmt.Errorf("arguments are not valid JSON and could not be repaired: %q", truncateForError(input))
+	}
+	return out, nil
+}
+
+// truncateForError 截断过长的错误上下文
+func truncateForError(s string) string {
+	const max = 200
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "..."
+}
+
+const (
+	repairExpectKey = iota
+	repairExpectColon
+	repairExpectValue
+	repairAfterValue
+)
+
+// repairFrame 修复过程中的容器状态
+type repairFrame struct {
+	open  byte
+	state int
+}
+
+// jsonRepairer JSON 修复器
+type jsonRepairer struct {
+	src   string
+	out   strings.Builder
+	stack []repairFrame
+}
+
+func (r *jsonRepairer) repair() string {
+	src := r.src
+	started := false
+
+	for i := 0; i < len(src); {
+		if started && len(r.stack) == 0 {
+			break // 顶层值已结束，忽略后续多余内容
+		}
+
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			r.out.WriteByte(c)
+			i++
+
+		case c == '"' || c == '\'':
+			str, next := readRepairString(src, i)
+			isKey := r.beforeValue(true)
+			r.out.WriteString(str)
+			r.afterValue(isKey)
+			i = next
+
+		case c == '{' || c == '[':
+			r.beforeValue(false)
+			r.out.WriteByte(c)
+			state := repairExpectValue
+			if c == '{' {
+				state = repairExpectKey
+			}
+			r.stack = append(r.stack, repairFrame{open: c, state: state})
+			started = true
+			i++
+
+		case c == '}' || c == ']':
+			if len(r.stack) > 0 {
+				r.closeTop()
+			}
+			i++
+
+		case c == ',':
+			if top := r.top(); top != nil && top.state == repairAfterValue {
+				r.out.WriteByte(',')
+				if top.open == '{' {
+					top.state = repairExpectKey
+				} else {
+					top.state = repairExpectValue
+				}
+			}
+			i++
+
+		case c == ':':
+			if top := r.top(); top != nil && top.open == '{' && top.state == repairExpectColon {
+				r.out.WriteByte(':')
+				top.state = repairExpectValue
+			}
+			i++
+
+		case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+			j := i
+			for j < len(src) && strings.IndexByte("0123456789+-.eE", src[j]) >= 0 {
+				j++
+			}
+			isKey := r.beforeValue(true)
+			num := normalizeRepairNumber(src[i:j])
+			if isKey {
+				num = `"` + num + `"`
+			}
+			r.out.WriteString(num)
+			r.afterValue(isKey)
+			i = j
+
+		case isRepairWordByte(c):
+			j := i
+			for j < len(src) && isRepairWordByte(src[j]) {
+				j++
+			}
+			word := src[i:j]
+			isKey := r.beforeValue(true)
+			if isKey {
+				r.out.WriteString(quoteJSON(word))
+			} else {
+				switch word {
+				case "true", "True":
+					r.out.WriteString("true")
+				case "false", "False":
+					r.out.WriteString("false")
+				case "null", "None", "undefined":
+					r.out.WriteString("null")
+				default:
+					r.out.WriteString(quoteJSON(word))
+				}
+			}
+			r.afterValue(isKey)
+			i = j
+
+		default:
+			i++ // 丢弃无法识别的字符
+		}
+	}
+
+	for len(r.stack) > 0 {
+		r.closeTop()
+	}
+
+	return strings.TrimSpace(r.out.String())
+}
+
+// top 返回栈顶容器
+func (r *jsonRepairer) top() *repairFrame {
+	if len(r.stack) == 0 {
+		return nil
+	}
+	return &r.stack[len(r.stack)-1]
+}
+
+// beforeValue 在写入一个值之前补齐缺失的逗号或冒号，返回该值是否处于键的位置
+func (r *jsonRepairer) beforeValue(scalar bool) bool {
+	top := r.top()
+	if top == nil {
+		return false
+	}
+
+	if top.state == repairAfterValue {
+		r.out.WriteByte(',')
+		if top.open == '{' {
+			top.state = repairExpectKey
+		} else {
+			top.state = repairExpectValue
+		}
+	}
+
+	if top.open == '{' {
+		switch top.state {
+		case repairExpectKey:
+			if scalar {
+				return true
+			}
+			// 对象中缺少键时无法修复，写入占位键
+			r.out.WriteString(`"_":`)
+			top.state = repairExpectValue
+		case repairExpectColon:
+			r.out.WriteByte(':')
+			top.state = repairExpectValue
+		}
+	}
+	return false
+}
+
+// afterValue 在写入一个值之后更新容器状态
+func (r *jsonRepairer) afterValue(isKey bool) {
+	top := r.top()
+	if top == nil {
+		return
+	}
+	if isKey {
+		top.state = repairExpectColon
+		return
+	}
+	top.state = repairAfterValue
+}
+
+// closeTop 关闭栈顶容器，并处理悬空的键和尾随逗号
+func (r *jsonRepairer) closeTop() {
+	top := r.top()
+	if top.open == '{' && (top.state == repairExpectColon || top.state == repairExpectValue) {
+		if top.state == repairExpectColon {
+			r.out.WriteByte(':')
+		}
+		r.out.WriteString("null")
+	}
+	r.trimTrailingComma()
+
+	if top.open == '{' {
+		r.out.WriteByte('}')
+	} else {
+		r.out.WriteByte(']')
+	}
+	r.stack = r.stack[:len(r.stack)-1]
+	r.afterValue(false)
+}
+
+// trimTrailingComma 删除输出末尾的逗号
+func (r *jsonRepairer) trimTrailingComma() {
+	out := strings.TrimRight(r.out.String(), " \t\r\n")
+	if strings.HasSuffix(out, ",") {
+		out = out[:len(out)-1]
+		r.out.Reset()
+		r.out.WriteString(out)
+	}
+}
+
+// readRepairString 读取单引号或双引号字符串并转换为合法的 JSON 字符串，未闭合时自动补齐
+func readRepairString(src string, start int) (string, int) {
+	quote := src[start]
+	var b strings.Builder
+	b.WriteByte('"')
+
+	j := start + 1
+	for j < len(src) {
+		c := src[j]
+		switch {
+		case c == '\\':
+			if j+1 >= len(src) {
+				j++
+				continue
+			}
+			next := src[j+1]
+			if next == '\'' {
+				b.WriteByte('\'')
+			} else if strings.IndexByte(`"\/bfnrtu`, next) >= 0 {
+				b.WriteByte('\\')
+				b.WriteByte(next)
+			} else {
+				b.WriteString(`\\`)
+				b.WriteByte(next)
+			}
+			j += 2
+			continue
+		case c == quote:
+			b.WriteByte('"')
+			return b.String(), j + 1
+		case c == '"':
+			b.WriteString(`\"`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c < 0x20:
+			fmt.Fprintf(&b, `\u%04x`, c)
+		default:
+			b.WriteByte(c)
+		}
+		j++
+	}
+
+	// 字符串被截断，去掉不完整的 \u 转义后补齐引号
+	out := b.String()
+	if idx := strings.LastIndex(out, `\u`); idx >= 0 && len(out)-idx < 6 {
+		out = out[:idx]
+	}
+	return out + `"`, j
+}
+
+// normalizeRepairNumber 规范化数字字面量，无法解析时退化为 0
+func normalizeRepairNumber(num string) string {
+	num = strings.TrimPrefix(num, "+")
+	num = strings.TrimRight(num, "+-eE.")
+	if strings.HasPrefix(num, ".") {
+		num = "0" + num
+	} else if strings.HasPrefix(num, "-.") {
+		num = "-0" + num[1:]
+	}
+
+	var f float64
+	if err := json.Unmarshal([]byte(num), &f); err != nil {
+		return "0"
+	}
+	return num
+}
+
+// isRepairWordByte 判断是否为裸词字符
+func isRepairWordByte(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= 0x80
+}
+
+// quoteJSON 将字符串编码为 JSON 字符串
+func quoteJSON(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// ValidateJSONSchema 按 JSON Schema 校验数据，返回所有问题
+//
+// 支持 type、properties、required、additionalProperties、enum、const、
+// minimum/maximum、exclusiveMinimum/exclusiveMaximum、minLength/maxLength、
+// pattern、items、minItems/maxItems 以及 anyOf/oneOf/allOf。
+func ValidateJSONSchema(schema interface{}, value interface{}) []string {
+	normalized, err := normalizeSchema(schema)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid schema: %v", err)}
+	}
+
+	var problems []string
+	validateSchemaNode(normalized, value, "$", &problems)
+	return problems
+}
+
+// normalizeSchema 将任意形式的 Schema 统一为 map 结构
+func normalizeSchema(schema interface{}) (map[string]interface{}, error) {
+	var data []byte
+	switch s := schema.(type) {
+	case json.RawMessage:
+		data = s
+	case []byte:
+		data = s
+	case string:
+		data = []byte(s)
+	default:
+		b, err := json.Marshal(schema)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	}
+
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// validateSchemaNode 递归校验单个节点
+func validateSchemaNode(schema map[string]interface{}, value interface{}, path string, problems *[]string) {
+	report := func(format string, args ...interface{}) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if sub, ok := schema["allOf"].([]interface{}); ok {
+		for _, s := range sub {
+			if m, ok := s.(map[string]interface{}); ok {
+				validateSchemaNode(m, value, path, problems)
+			}
+		}
+	}
+	for _, key := range []string{"anyOf", "oneOf"} {
+		if sub, ok := schema[key].([]interface{}); ok && len(sub) > 0 {
+			matched := false
+			for _, s := range sub {
+				m, ok := s.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				var subProblems []string
+				validateSchemaNode(m, value, path, &subProblems)
+				if len(subProblems) == 0 {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				report("value does not match any of the allowed schemas")
+			}
+		}
+	}
+
+	if t, ok := schema["type"]; ok && !matchesSchemaType(t, value) {
+		report("expected %s, got %s", describeSchemaType(t), jsonTypeName(value))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("value %s is not one of %s", compactJSON(value), compactJSON(enum))
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, value) {
+		report("value must be %s", compactJSON(c))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		props, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				name, _ := r.(string)
+				if _, exists := v[name]; !exists {
+					report("missing required field '%s'", name)
+				}
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			propSchema, ok := props[k].(map[string]interface{})
+			if ok {
+				validateSchemaNode(propSchema, v[k], path+"."+k, problems)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					report("unexpected field '%s'", k)
+				}
+			case map[string]interface{}:
+				validateSchemaNode(extra, v[k], path+"."+k, problems)
+			}
+		}
+
+	case []interface{}:
+		if min, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < min {
+			report("expected at least %v items, got %d", min, len(v))
+		}
+		if max, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > max {
+			report("expected at most %v items, got %d", max, len(v))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validateSchemaNode(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+
+	case string:
+		length := len([]rune(v))
+		if min, ok := schemaNumber(schema, "minLength"); ok && float64(length) < min {
+			report("string shorter than %v characters", min)
+		}
+		if max, ok := schemaNumber(schema, "maxLength"); ok && float64(length) > max {
+			report("string longer than %v characters", max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				report("string does not match pattern %q", pattern)
+			}
+		}
+
+	case float64:
+		if min, ok := schemaNumber(schema, "minimum"); ok && v < min {
+			report("value %v is less than minimum %v", v, min)
+		}
+		if max, ok := schemaNumber(schema, "maximum"); ok && v > max {
+			report("value %v is greater than maximum %v", v, max)
+		}
+		if min, ok := schemaNumber(schema, "exclusiveMinimum"); ok && v <= min {
+			report("value %v must be greater than %v", v, min)
+		}
+		if max, ok := schemaNumber(schema, "exclusiveMaximum"); ok && v >= max {
+			report("value %v must be less than %v", v, max)
+		}
+	}
+}
+
+// matchesSchemaType 判断值是否匹配 type 声明（字符串或字符串数组）
+func matchesSchemaType(t interface{}, value interface{}) bool {
+	switch tt := t.(type) {
+	case string:
+		return matchesSingleType(tt, value)
+	case []interface{}:
+		for _, item := range tt {
+			if name, ok := item.(string); ok && matchesSingleType(name, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// matchesSingleType 判断值是否匹配单个类型
+func matchesSingleType(t string, value interface{}) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+// describeSchemaType 描述 type 声明
+func describeSchemaType(t interface{}) string {
+	switch tt := t.(type) {
+	case string:
+		return tt
+	case []interface{}:
+		names := make([]string, 0, len(tt))
+		for _, item := range tt {
+			names = append(names, fmt.Sprint(item))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+// jsonTypeName 返回值的 JSON 类型名
+func jsonTypeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// schemaNumber 读取 Schema 中的数值约束
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	f, ok := schema[key].(float64)
+	return f, ok
+}
+
+// jsonEqual 比较两个 JSON 值是否相等
+func jsonEqual(a, b interface{}) bool {
+	return compactJSON(a) == compactJSON(b)
+}
+
+// compactJSON 紧凑编码 JSON 值
+func compactJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,109 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestRepairJSON 测试宽松 JSON 修复
+func TestRepairJSON(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"合法JSON", `{"location":"北京"}`, `{"location":"北京"}`},
+		{"空参数", ``, `{}`},
+		{"单引号", `{'location': '北京', 'unit': 'celsius'}`, `{"location":"北京","unit":"celsius"}`},
+		{"尾随逗号", `{"location": "北京", "tags": [1, 2,],}`, `{"location":"北京","tags":[1,2]}`},
+		{"截断字符串", `{"location": "北`, `{"location":"北"}`},
+		{"截断对象", `{"query": "go", "max_results": 5, "filters": {"lang": "zh"`, `{"query":"go","max_results":5,"filters":{"lang":"zh"}}`},
+		{"悬空键", `{"query": "go", "max_results":`, `{"query":"go","max_results":null}`},
+		{"裸键和Python字面量", `{query: 'go', exact: True, page: None}`, `{"query":"go","exact":true,"page":null}`},
+		{"代码块", "```json\n{\"a\": 1}\n```", `{"a":1}`},
+		{"缺失逗号", `{"a": 1 "b": 2}`, `{"a":1,"b":2}`},
+		{"前置文字", `好的，参数如下：{"a": 1}`, `{"a":1}`},
+	}
+
+	for _, tc := range cases {
+		got, err := RepairJSON(tc.input)
+		if err != nil {
+			t.Errorf("%s: 修复失败: %v", tc.name, err)
+			continue
+		}
+
+		var gotValue, wantValue interface{}
+		if err := json.Unmarshal([]byte(got), &gotValue); err != nil {
+			t.Errorf("%s: 修复结果不是合法JSON: %s", tc.name, got)
+			continue
+		}
+		json.Unmarshal([]byte(tc.want), &wantValue)
+		if compactJSON(gotValue) != compactJSON(wantValue) {
+			t.Errorf("%s: 期望%s，实际%s", tc.name, tc.want, got)
+		}
+	}
+
+	if _, err := RepairJSON("not json at all"); err == nil {
+		t.Error("无法修复的输入应该返回错误")
+	}
+
+	t.Logf("JSON修复测试通过")
+}
+
+// TestPrepareToolCall 测试工具参数校验
+func TestPrepareToolCall(t *testing.T) {
+	tools := NewToolBuilder().
+		AddWeatherFunction().
+		AddSearchFunction().
+		Build()
+
+	// 可修复的参数
+	call := &ToolCall{
+		ID:       "call_1",
+		Type:     "function",
+		Function: FunctionCall{Name: "get_weather", Arguments: `{'location': '北京', 'unit': 'celsius',`},
+	}
+	args, err := PrepareToolCall(tools, call)
+	if err != nil {
+		t.Fatalf("可修复的参数不应该报错: %v", err)
+	}
+	if args["location"] != "北京" {
+		t.Errorf("参数解析错误: %v", args)
+	}
+	if !json.Valid([]byte(call.Function.Arguments)) {
+		t.Errorf("修复后的参数应该写回调用: %s", call.Function.Arguments)
+	}
+
+	// 缺少必需字段、枚举错误、超出范围
+	badCalls := []*ToolCall{
+		{ID: "call_2", Function: FunctionCall{Name: "get_weather", Arguments: `{"unit": "kelvin"}`}},
+		{ID: "call_3", Function: FunctionCall{Name: "web_search", Arguments: `{"query": "go", "max_results": 50}`}},
+		{ID: "call_4", Function: FunctionCall{Name: "web_search", Arguments: `{"query": 42}`}},
+		{ID: "call_5", Function: FunctionCall{Name: "unknown_tool", Arguments: `{}`}},
+	}
+	for _, bad := range badCalls {
+		_, err := PrepareToolCall(tools, bad)
+		var argErr *ToolArgumentError
+		if !errors.As(err, &argErr) {
+			t.Errorf("%s: 期望ToolArgumentError，实际%v", bad.ID, err)
+			continue
+		}
+		if argErr.ToolCallID != bad.ID || len(argErr.Problems) == 0 {
+			t.Errorf("%s: 错误信息不完整: %+v", bad.ID, argErr)
+		}
+		t.Logf("%s: %v", bad.ID, argErr)
+	}
+
+	// 纠错消息
+	_, err = PrepareToolCall(tools, badCalls[0])
+	var argErr *ToolArgumentError
+	errors.As(err, &argErr)
+	msg := argErr.ToolMessage()
+	if msg.Role != "tool" || !strings.Contains(ExtractContent(&msg), "missing required field 'location'") {
+		t.Errorf("纠错消息不正确: %+v", msg)
+	}
+
+	t.Logf("工具参数校验测试通过")
+}
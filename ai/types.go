@@ -1,5 +1,7 @@
 package ai
 
+import "encoding/json"
+
 // ChatRequest 聊天请求
 type ChatRequest struct {
 	Model       string      `json:"model"`
@@ -13,38 +15,171 @@ type ChatRequest struct {
 	Tools       []Tool      `json:"tools,omitempty"`
 	ToolChoice  interface{} `json:"tool_choice,omitempty"`
 
-	// 扩展参数
+	ResponseFormat    *ResponseFormat   `json:"response_format,omitempty"`
+	Seed              *int              `json:"seed,omitempty"`
+	PresencePenalty   *float64          `json:"presence_penalty,omitempty"`
+	FrequencyPenalty  *float64          `json:"frequency_penalty,omitempty"`
+	LogitBias         map[string]int    `json:"logit_bias,omitempty"`
+	Logprobs          *bool             `json:"logprobs,omitempty"`
+	TopLogprobs       *int              `json:"top_logprobs,omitempty"`
+	User              string            `json:"user,omitempty"`
+	ParallelToolCalls *bool             `json:"parallel_tool_calls,omitempty"`
+	ReasoningEffort   string            `json:"reasoning_effort,omitempty"`
+	Modalities        []string          `json:"modalities,omitempty"`
+	Audio             *AudioOutput      `json:"audio,omitempty"`
+	Prediction        *Prediction       `json:"prediction,omitempty"`
+	Metadata          map[string]string `json:"metadata,omitempty"`
+	Store             *bool             `json:"store,omitempty"`
+	ServiceTier       string            `json:"service_tier,omitempty"`
+
+	// 扩展参数，序列化时合并到请求体中，可覆盖同名的可选字段
 	Extra map[string]interface{} `json:"-"`
+
+	// Fallbacks 模型失败时依次尝试的模型或角色，不发送给服务端；为 nil 时使用配置中的回退列表
+	Fallbacks []string `json:"-"`
+	// NoCache 为 true 时不读取也不写入响应缓存
+	NoCache bool `json:"-"`
+}
+
+// AudioOutput 音频输出参数
+type AudioOutput struct {
+	Voice  string `json:"voice"`
+	Format string `json:"format"`
+}
+
+// Prediction 预测输出内容，用于加速重新生成大段已知文本
+type Prediction struct {
+	Type    string         `json:"type"`
+	Content MessageContent `json:"content"`
+}
+
+// 推理强度
+const (
+	ReasoningEffortMinimal = "minimal"
+	ReasoningEffortLow     = "low"
+	ReasoningEffortMedium  = "medium"
+	ReasoningEffortHigh    = "high"
+)
+
+// 输出模态
+const (
+	ModalityText  = "text"
+	ModalityAudio = "audio"
+)
+
+// 服务等级
+const (
+	ServiceTierAuto     = "auto"
+	ServiceTierDefault  = "default"
+	ServiceTierFlex     = "flex"
+	ServiceTierPriority = "priority"
+)
+
+// 响应格式类型
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+// ResponseFormat 响应格式
+type ResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+// JSONSchemaFormat 结构化输出的 JSON Schema 定义
+type JSONSchemaFormat struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Schema      interface{} `json:"schema"`
+	Strict      *bool       `json:"strict,omitempty"`
 }
 
 // ChatResponse 聊天响应
 type ChatResponse struct {
-	ID      string   `json:"id"`
-	Object  string   `json:"object"`
-	Created int64    `json:"created"`
-	Model   string   `json:"model"`
-	Choices []Choice `json:"choices"`
-	Usage   *Usage   `json:"usage,omitempty"`
+	ID                string   `json:"id"`
+	Object            string   `json:"object"`
+	Created           int64    `json:"created"`
+	Model             string   `json:"model"`
+	Choices           []Choice `json:"choices"`
+	Usage             *Usage   `json:"usage,omitempty"`
+	SystemFingerprint string   `json:"system_fingerprint,omitempty"`
+	ServiceTier       string   `json:"service_tier,omitempty"`
+
+	// Raw 完整的原始响应体，可用于读取网关返回的厂商扩展字段
+	Raw json.RawMessage `json:"-"`
+	// ServedModel 实际处理请求的模型，即请求中使用的模型名，发生回退时与原请求不同
+	ServedModel string `json:"-"`
+	// CacheHit 响应是否来自缓存
+	CacheHit bool `json:"-"`
+}
+
+// RawField 从原始响应体中解析顶层字段，字段不存在时返回 false
+func (r *ChatResponse) RawField(name string, v interface{}) (bool, error) {
+	return rawField(r.Raw, name, v)
+}
+
+// rawField 从原始 JSON 对象中解析顶层字段
+func rawField(raw json.RawMessage, name string, v interface{}) (bool, error) {
+	if len(raw) == 0 {
+		return false, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return false, err
+	}
+	value, ok := fields[name]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(value, v)
 }
 
 // Choice 选择项
 type Choice struct {
-	Index        int      `json:"index"`
-	Message      *Message `json:"message,omitempty"`
-	Delta        *Message `json:"delta,omitempty"`
-	FinishReason string   `json:"finish_reason,omitempty"`
+	Index        int       `json:"index"`
+	Message      *Message  `json:"message,omitempty"`
+	Delta        *Message  `json:"delta,omitempty"`
+	FinishReason string    `json:"finish_reason,omitempty"`
+	Logprobs     *Logprobs `json:"logprobs,omitempty"`
+}
+
+// Logprobs 输出令牌的对数概率
+type Logprobs struct {
+	Content []TokenLogprob `json:"content,omitempty"`
+	Refusal []TokenLogprob `json:"refusal,omitempty"`
+}
+
+// TokenLogprob 单个令牌的对数概率
+type TokenLogprob struct {
+	Token       string       `json:"token"`
+	Logprob     float64      `json:"logprob"`
+	Bytes       []int        `json:"bytes,omitempty"`
+	TopLogprobs []TopLogprob `json:"top_logprobs,omitempty"`
+}
+
+// TopLogprob 候选令牌的对数概率
+type TopLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+	Bytes   []int   `json:"bytes,omitempty"`
 }
 
 // Message 消息
 type Message struct {
-	Role      string      `json:"role"`
-	Content   interface{} `json:"content"`
-	Name      string      `json:"name,omitempty"`
-	ToolCalls []ToolCall  `json:"tool_calls,omitempty"`
+	Role             string         `json:"role"`
+	Content          MessageContent `json:"content"`
+	Name             string         `json:"name,omitempty"`
+	ToolCalls        []ToolCall     `json:"tool_calls,omitempty"`
+	ToolCallID       string         `json:"tool_call_id,omitempty"`
+	Refusal          string         `json:"refusal,omitempty"`
+	ReasoningContent string         `json:"reasoning_content,omitempty"`
 }
 
 // ToolCall 工具调用
 type ToolCall struct {
+	Index    *int         `json:"index,omitempty"` // 仅出现在流式增量中
 	ID       string       `json:"id"`
 	Type     string       `json:"type"`
 	Function FunctionCall `json:"function"`
@@ -71,7 +206,39 @@ type ToolFunction struct {
 
 // Usage 使用统计
 type Usage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens            int                      `json:"prompt_tokens"`
+	CompletionTokens        int                      `json:"completion_tokens"`
+	TotalTokens             int                      `json:"total_tokens"`
+	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+}
+
+// PromptTokensDetails 输入令牌明细
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+	AudioTokens  int `json:"audio_tokens,omitempty"`
+}
+
+// CompletionTokensDetails 输出令牌明细
+type CompletionTokensDetails struct {
+	ReasoningTokens          int `json:"reasoning_tokens"`
+	AudioTokens              int `json:"audio_tokens,omitempty"`
+	AcceptedPredictionTokens int `json:"accepted_prediction_tokens,omitempty"`
+	RejectedPredictionTokens int `json:"rejected_prediction_tokens,omitempty"`
+}
+
+// CachedTokens 返回命中缓存的输入令牌数
+func (u *Usage) CachedTokens() int {
+	if u == nil || u.PromptTokensDetails == nil {
+		return 0
+	}
+	return u.PromptTokensDetails.CachedTokens
+}
+
+// ReasoningTokens 返回推理令牌数
+func (u *Usage) ReasoningTokens() int {
+	if u == nil || u.CompletionTokensDetails == nil {
+		return 0
+	}
+	return u.CompletionTokensDetails.ReasoningTokens
 }
@@ -162,25 +162,12 @@ func ExtractContent(message *Message) string {
 		return ""
 	}
 
-	switch content := message.Content.(type) {
-	case string:
-		return content
-	case []interface{}:
-		// 处理多模态内容，提取文本部分
-		var textParts []string
-		for _, part := range content {
-			if partMap, ok := part.(map[string]interface{}); ok {
-				if partMap["type"] == "text" {
-					if text, ok := partMap["text"].(string); ok {
-						textParts = append(textParts, text)
-					}
-				}
-			}
-		}
-		return fmt.Sprintf("[%s]", join(textParts, " "))
-	default:
-		return fmt.Sprintf("%v", content)
+	if !message.Content.IsMultiPart() {
+		return message.Content.Text
 	}
+
+	// 处理多模态内容，提取文本部分
+	return fmt.Sprintf("[%s]", join(message.Content.TextParts(), " "))
 }
 
 // join 字符串连接辅助函数
@@ -0,0 +1,533 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 本文件实现一个无依赖的 YAML 子集解析器，用于提示词文件和配置文件。
+// 支持：块映射、块序列（包括序列中的映射）、| 和 > 块标量、单双引号字符串、
+// 行内 [a, b] 和 {k: v}、注释以及 null、布尔值和数字的解析。
+// 不支持锚点、别名、标签和多文档。
+
+// decodeYAML 解析 YAML 并按 JSON 标签解码到 v
+func decodeYAML(data []byte, v interface{}) error {
+	value, err := parseYAML(data)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		return nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, v)
+}
+
+// parseYAML 解析 YAML，返回 map[string]interface{}、[]interface{} 或标量
+func parseYAML(data []byte) (interface{}, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.TrimPrefix(text, "\ufeff")
+	lines := strings.Split(text, "\n")
+
+	// 去掉文档起止标记
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if trimmed == "---" {
+			lines[i] = ""
+		}
+		break
+	}
+	for i, line := range lines {
+		if strings.TrimRight(line, " ") == "..." {
+			lines = lines[:i]
+			break
+		}
+	}
+
+	p := &yamlParser{lines: lines}
+	p.skipBlank()
+	if p.eof() {
+		return nil, nil
+	}
+	value, err := p.parseBlock(p.indent())
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank()
+	if !p.eof() {
+		return nil, p.errorf("unexpected content %q", strings.TrimSpace(p.lines[p.pos]))
+	}
+	return value, nil
+}
+
+// yamlParser 按行解析 YAML
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+func (p *yamlParser) eof() bool {
+	return p.pos >= len(p.lines)
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("yaml line %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+// skipBlank 跳过空行和注释行
+func (p *yamlParser) skipBlank() {
+	for !p.eof() {
+		trimmed := strings.TrimSpace(p.lines[p.pos])
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return
+		}
+		p.pos++
+	}
+}
+
+// indent 返回当前行的缩进
+func (p *yamlParser) indent() int {
+	line := p.lines[p.pos]
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// content 返回当前行去掉缩进后的内容
+func (p *yamlParser) content() string {
+	return strings.TrimRight(strings.TrimLeft(p.lines[p.pos], " "), " \t")
+}
+
+// parseBlock 解析从当前行开始、缩进为 indent 的块
+func (p *yamlParser) parseBlock(indent int) (interface{}, error) {
+	if strings.HasPrefix(strings.TrimLeft(p.lines[p.pos], " "), "\t") {
+		return nil, p.errorf("tabs are not allowed for indentation")
+	}
+	if isSequenceItem(p.content()) {
+		return p.parseSequence(indent)
+	}
+	if _, _, ok := splitMappingKey(p.content()); ok {
+		return p.parseMapping(indent)
+	}
+	// 多行普通标量
+	var parts []string
+	for !p.eof() {
+		p.skipBlank()
+		if p.eof() || p.indent() < indent {
+			break
+		}
+		parts = append(parts, stripYAMLComment(p.content()))
+		p.pos++
+	}
+	return resolveYAMLScalar(strings.Join(parts, " ")), nil
+}
+
+// isSequenceItem 判断是否为序列项
+func isSequenceItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+// parseMapping 解析块映射
+func (p *yamlParser) parseMapping(indent int) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	for {
+		p.skipBlank()
+		if p.eof() || p.indent() < indent {
+			return result, nil
+		}
+		if p.indent() > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		content := p.content()
+		if isSequenceItem(content) {
+			return result, nil
+		}
+
+		key, rest, ok := splitMappingKey(content)
+		if !ok {
+			return nil, p.errorf("expected \"key: value\", got %q", content)
+		}
+		if _, exists := result[key]; exists {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+
+		value, err := p.parseValue(stripYAMLComment(rest), indent, true)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+	}
+}
+
+// parseSequence 解析块序列
+func (p *yamlParser) parseSequence(indent int) ([]interface{}, error) {
+	result := make([]interface{}, 0)
+	for {
+		p.skipBlank()
+		if p.eof() || p.indent() != indent || !isSequenceItem(p.content()) {
+			if !p.eof() && p.indent() > indent {
+				return nil, p.errorf("unexpected indentation")
+			}
+			return result, nil
+		}
+
+		content := p.content()
+		item := strings.TrimLeft(strings.TrimPrefix(content, "-"), " ")
+		offset := indent + len(content) - len(item)
+
+		// 序列项是映射或嵌套序列时，把当前行改写为对应缩进的块继续解析
+		if _, _, isMap := splitMappingKey(item); isMap || isSequenceItem(item) {
+			p.lines[p.pos] = strings.Repeat(" ", offset) + item
+			value, err := p.parseBlock(offset)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, value)
+			continue
+		}
+
+		p.pos++
+		value, err := p.parseValue(stripYAMLComment(item), indent, false)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+}
+
+// parseValue 解析键或序列项之后的值，可能是行内值、块标量或下一级块
+func (p *yamlParser) parseValue(rest string, indent int, inMapping bool) (interface{}, error) {
+	if strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">") {
+		return p.parseBlockScalar(rest, indent)
+	}
+	if rest != "" {
+		return parseYAMLFlow(rest)
+	}
+
+	p.skipBlank()
+	if p.eof() {
+		return nil, nil
+	}
+	next := p.indent()
+	if next > indent {
+		return p.parseBlock(next)
+	}
+	// 映射的值可以是与键同级缩进的序列
+	if inMapping && next == indent && isSequenceItem(p.content()) {
+		return p.parseSequence(indent)
+	}
+	return nil, nil
+}
+
+// parseBlockScalar 解析 | 或 > 块标量
+func (p *yamlParser) parseBlockScalar(header string, parentIndent int) (string, error) {
+	folded := header[0] == '>'
+	chomp := byte(0)
+	for _, c := range []byte(strings.TrimSpace(header[1:])) {
+		switch {
+		case c == '-' || c == '+':
+			chomp = c
+		case c >= '1' && c <= '9':
+			// 显式缩进指示符按自动检测处理
+		default:
+			return "", p.errorf("invalid block scalar header %q", header)
+		}
+	}
+
+	var raw []string
+	blockIndent := -1
+	for !p.eof() {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line) == "" {
+			raw = append(raw, "")
+			p.pos++
+			continue
+		}
+		lineIndent := len(line) - len(strings.TrimLeft(line, " "))
+		if lineIndent <= parentIndent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = lineIndent
+		}
+		if lineIndent < blockIndent {
+			break
+		}
+		raw = append(raw, line[blockIndent:])
+		p.pos++
+	}
+
+	// 末尾空行由 chomp 规则处理
+	trailing := 0
+	for len(raw) > 0 && raw[len(raw)-1] == "" {
+		raw = raw[:len(raw)-1]
+		trailing++
+	}
+
+	var text string
+	if folded {
+		var b strings.Builder
+		for i, line := range raw {
+			switch {
+			case i == 0:
+			case line == "":
+				b.WriteByte('\n')
+			case raw[i-1] == "":
+				// 空行已经换行
+			case strings.HasPrefix(line, " ") || strings.HasPrefix(raw[i-1], " "):
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(' ')
+			}
+			b.WriteString(line)
+		}
+		text = b.String()
+	} else {
+		text = strings.Join(raw, "\n")
+	}
+
+	switch {
+	case len(raw) == 0:
+		return "", nil
+	case chomp == '-':
+		return text, nil
+	case chomp == '+':
+		return text + strings.Repeat("\n", trailing+1), nil
+	default:
+		return text + "\n", nil
+	}
+}
+
+// splitMappingKey 拆分 "key: value"，键可以带引号
+func splitMappingKey(content string) (key, rest string, ok bool) {
+	if content == "" || content[0] == '[' || content[0] == '{' || content[0] == '#' {
+		return "", "", false
+	}
+	if content[0] == '"' || content[0] == '\'' {
+		end := closingQuote(content, 0)
+		if end < 0 || end+1 >= len(content) || content[end+1] != ':' {
+			return "", "", false
+		}
+		after := content[end+2:]
+		if after != "" && after[0] != ' ' {
+			return "", "", false
+		}
+		unquoted, err := unquoteYAML(content[:end+1])
+		if err != nil {
+			return "", "", false
+		}
+		return unquoted, strings.TrimSpace(after), true
+	}
+
+	for i := 0; i < len(content); i++ {
+		if content[i] == ':' && (i+1 == len(content) || content[i+1] == ' ') {
+			return strings.TrimSpace(content[:i]), strings.TrimSpace(content[i+1:]), true
+		}
+		if content[i] == ' ' && i+1 < len(content) && content[i+1] == '#' {
+			return "", "", false
+		}
+	}
+	return "", "", false
+}
+
+// closingQuote 返回从 start 开始的引号字符串的结束位置
+func closingQuote(s string, start int) int {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote:
+			if quote == '\'' && i+1 < len(s) && s[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// stripYAMLComment 去掉引号外的行尾注释
+func stripYAMLComment(s string) string {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			if end := closingQuote(s, i); end > 0 {
+				i = end
+			}
+		case '#':
+			if i == 0 || s[i-1] == ' ' || s[i-1] == '\t' {
+				return strings.TrimRight(s[:i], " \t")
+			}
+		}
+	}
+	return s
+}
+
+// unquoteYAML 解析带引号的字符串
+func unquoteYAML(s string) (string, error) {
+	if s[0] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return strconv.Unquote(s)
+}
+
+// parseYAMLFlow 解析行内值：标量、[a, b] 或 {k: v}
+func parseYAMLFlow(s string) (interface{}, error) {
+	f := &yamlFlow{s: s}
+	value, err := f.value()
+	if err != nil {
+		return nil, err
+	}
+	f.space()
+	if f.pos < len(f.s) {
+		if s[0] == '[' || s[0] == '{' || s[0] == '"' || s[0] == '\'' {
+			return nil, fmt.Errorf("yaml: unexpected %q after value", f.s[f.pos:])
+		}
+		// 普通标量中可以包含逗号和括号
+		return resolveYAMLScalar(s), nil
+	}
+	return value, nil
+}
+
+// yamlFlow 行内值解析器
+type yamlFlow struct {
+	s   string
+	pos int
+}
+
+func (f *yamlFlow) space() {
+	for f.pos < len(f.s) && (f.s[f.pos] == ' ' || f.s[f.pos] == '\t') {
+		f.pos++
+	}
+}
+
+func (f *yamlFlow) value() (interface{}, error) {
+	f.space()
+	if f.pos >= len(f.s) {
+		return nil, nil
+	}
+	switch f.s[f.pos] {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '"', '\'':
+		end := closingQuote(f.s, f.pos)
+		if end < 0 {
+			return nil, fmt.Errorf("yaml: unterminated string %s", f.s[f.pos:])
+		}
+		text, err := unquoteYAML(f.s[f.pos : end+1])
+		if err != nil {
+			return nil, fmt.Errorf("yaml: invalid string %s: %w", f.s[f.pos:end+1], err)
+		}
+		f.pos = end + 1
+		return text, nil
+	}
+	start := f.pos
+	for f.pos < len(f.s) && !strings.ContainsRune(",]}", rune(f.s[f.pos])) {
+		if f.s[f.pos] == ':' && (f.pos+1 == len(f.s) || f.s[f.pos+1] == ' ') {
+			break
+		}
+		f.pos++
+	}
+	return resolveYAMLScalar(strings.TrimSpace(f.s[start:f.pos])), nil
+}
+
+func (f *yamlFlow) sequence() (interface{}, error) {
+	f.pos++ // [
+	result := make([]interface{}, 0)
+	for {
+		f.space()
+		if f.pos < len(f.s) && f.s[f.pos] == ']' {
+			f.pos++
+			return result, nil
+		}
+		value, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+		f.space()
+		if f.pos >= len(f.s) {
+			return nil, fmt.Errorf("yaml: unterminated sequence")
+		}
+		switch f.s[f.pos] {
+		case ',':
+			f.pos++
+		case ']':
+		default:
+			return nil, fmt.Errorf("yaml: unexpected %q in sequence", f.s[f.pos])
+		}
+	}
+}
+
+func (f *yamlFlow) mapping() (interface{}, error) {
+	f.pos++ // {
+	result := make(map[string]interface{})
+	for {
+		f.space()
+		if f.pos < len(f.s) && f.s[f.pos] == '}' {
+			f.pos++
+			return result, nil
+		}
+		key, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		f.space()
+		if f.pos >= len(f.s) || f.s[f.pos] != ':' {
+			return nil, fmt.Errorf("yaml: expected ':' in mapping")
+		}
+		f.pos++
+		value, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		result[fmt.Sprint(key)] = value
+		f.space()
+		if f.pos >= len(f.s) {
+			return nil, fmt.Errorf("yaml: unterminated mapping")
+		}
+		switch f.s[f.pos] {
+		case ',':
+			f.pos++
+		case '}':
+		default:
+			return nil, fmt.Errorf("yaml: unexpected %q in mapping", f.s[f.pos])
+		}
+	}
+}
+
+// resolveYAMLScalar 把普通标量解析为 nil、布尔值、整数、浮点数或字符串
+func resolveYAMLScalar(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	// 以 0 开头的数字串（如编号、邮编）保持为字符串
+	if len(s) > 1 && s[0] == '0' && s[1] >= '0' && s[1] <= '9' {
+		return s
+	}
+	if n, err := strconv.ParseInt(strings.ReplaceAll(s, "_", ""), 0, 64); err == nil && s[0] != '_' {
+		return int(n)
+	}
+	if strings.ContainsAny(s, "0123456789") {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}